@@ -27,21 +27,71 @@ func SurroundingBox(box0, box1 AABB) *AABB {
 	return &AABB{small, big}
 }
 
-func (box AABB) hit(r Ray, tMin, tMax float64) bool {
+// hit is the slab test. The reciprocal of the ray direction is passed in so that it is only
+// computed once per ray rather than once per box.
+func (box AABB) hit(origin, inverseDirection Vec3, tMin, tMax float64) bool {
 	for a := 0; a < 3; a++ {
-		minT := (box.min.get(a) - r.origin().get(a)) / r.direction().get(a)
-		maxT := (box.max.get(a) - r.origin().get(a)) / r.direction().get(a)
+		var low, high, o, inverse float64
 
-		t0 := math.Min(minT, maxT)
-		t1 := math.Max(minT, maxT)
+		switch a {
+		case 0:
+			low, high, o, inverse = box.min.e0, box.max.e0, origin.e0, inverseDirection.e0
+		case 1:
+			low, high, o, inverse = box.min.e1, box.max.e1, origin.e1, inverseDirection.e1
+		default:
+			low, high, o, inverse = box.min.e2, box.max.e2, origin.e2, inverseDirection.e2
+		}
+
+		t0 := (low - o) * inverse
+		t1 := (high - o) * inverse
+
+		if inverse < 0 {
+			t0, t1 = t1, t0
+		}
 
-		min := math.Max(t0, tMin)
-		max := math.Min(t1, tMax)
+		// NaNs from rays in the plane of a slab fail these comparisons and are ignored.
+		if t0 > tMin {
+			tMin = t0
+		}
 
-		if max <= min {
+		if t1 < tMax {
+			tMax = t1
+		}
+
+		if tMax < tMin {
 			return false
 		}
 	}
 
 	return true
 }
+
+func (box AABB) surfaceArea() float64 {
+	extent := box.max.subtract(box.min)
+
+	return 2 * (extent.x()*extent.y() + extent.y()*extent.z() + extent.z()*extent.x())
+}
+
+func (box AABB) centroid() Vec3 {
+	return box.min.add(box.max).multiplyScalar(0.5)
+}
+
+// longestAxis returns 0, 1 or 2 for whichever of x, y and z the box is longest along.
+func (box AABB) longestAxis() int {
+	extent := box.max.subtract(box.min)
+
+	if extent.x() >= extent.y() && extent.x() >= extent.z() {
+		return 0
+	}
+
+	if extent.y() >= extent.z() {
+		return 1
+	}
+
+	return 2
+}
+
+// PointBox returns an empty AABB at a point, to grow with SurroundingBox.
+func PointBox(p Vec3) AABB {
+	return AABB{p, p}
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Interpolation is how a Track moves from one keyframe to the next.
+type Interpolation int
+
+// The supported interpolations. Linear moves at a steady rate, Bezier eases through
+// each key along a smooth curve, and step holds each value until the next key.
+const (
+	InterpolationLinear Interpolation = iota
+	InterpolationBezier
+	InterpolationStep
+)
+
+var interpolationNames = []string{"linear", "bezier", "step"}
+
+// ParseInterpolation parses the name of an interpolation.
+func ParseInterpolation(s string) (Interpolation, error) {
+	for i, name := range interpolationNames {
+		if name == s {
+			return Interpolation(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown interpolation %q, expected one of %v", s, interpolationNames)
+}
+
+func (i Interpolation) String() string {
+	if i >= 0 && int(i) < len(interpolationNames) {
+		return interpolationNames[i]
+	}
+
+	return fmt.Sprintf("Interpolation(%d)", int(i))
+}
+
+// Keyframe is the value of a Track at a time, and how it moves on to the next key.
+type Keyframe struct {
+	time          float64
+	value         Vec3
+	interpolation Interpolation
+}
+
+// Track is a value keyframed over time, its keys in order of time. It holds the first
+// value before the first key and the last after the last. Numbers are kept in x.
+type Track []Keyframe
+
+// animated reports whether the Track has more than one key to move between.
+func (t Track) animated() bool {
+	return len(t) > 1
+}
+
+// at returns the value of the Track at a time.
+func (t Track) at(time float64) Vec3 {
+	if time <= t[0].time {
+		return t[0].value
+	}
+
+	for i := 1; i < len(t); i++ {
+		if time < t[i].time {
+			return t.segment(i-1, (time-t[i-1].time)/(t[i].time-t[i-1].time))
+		}
+	}
+
+	return t[len(t)-1].value
+}
+
+// number returns the value of a Track of numbers at a time.
+func (t Track) number(time float64) float64 {
+	return t.at(time).x()
+}
+
+// segment returns the value u of the way from key i to the next.
+func (t Track) segment(i int, u float64) Vec3 {
+	switch t[i].interpolation {
+	case InterpolationStep:
+		return t[i].value
+	case InterpolationBezier:
+		p1, p2 := t.handles(i)
+		v := 1 - u
+
+		return t[i].value.multiplyScalar(v * v * v).
+			add(p1.multiplyScalar(3 * v * v * u)).
+			add(p2.multiplyScalar(3 * v * u * u)).
+			add(t[i+1].value.multiplyScalar(u * u * u))
+	}
+
+	return t[i].value.multiplyScalar(1 - u).add(t[i+1].value.multiplyScalar(u))
+}
+
+// handles returns the inner control points of the Bezier curve from key i to the next,
+// a third of the way along it in the direction of each key's slope.
+func (t Track) handles(i int) (Vec3, Vec3) {
+	width := t[i+1].time - t[i].time
+
+	return t[i].value.add(t.slope(i).multiplyScalar(width / 3)),
+		t[i+1].value.subtract(t.slope(i + 1).multiplyScalar(width / 3))
+}
+
+// slope returns the rate of change through key i, which runs from the key before to
+// the key after so that the curve is smooth, and is flat at the first and last keys.
+func (t Track) slope(i int) Vec3 {
+	if i == 0 || i == len(t)-1 {
+		return Vec3{}
+	}
+
+	return t[i+1].value.subtract(t[i-1].value).divideScalar(t[i+1].time - t[i-1].time)
+}
+
+// extremes returns values whose bounds contain every value of the Track from t0 to t1.
+// Linear and step keys reach their extremes at the keys, while a Bezier curve lies
+// within its control points.
+func (t Track) extremes(t0, t1 float64) []Vec3 {
+	values := []Vec3{t.at(t0), t.at(t1)}
+
+	for i, key := range t {
+		if key.time > t0 && key.time < t1 {
+			values = append(values, key.value)
+		}
+
+		if i < len(t)-1 && key.interpolation == InterpolationBezier && key.time < t1 && t[i+1].time > t0 {
+			p1, p2 := t.handles(i)
+			values = append(values, p1, p2)
+		}
+	}
+
+	return values
+}
+
+// AnimatedTranslate moves a Hitable by an offset keyframed over time. As a light it is
+// sampled where it is at lightTime, which for a scene built for a frame of an animation
+// is halfway through the frame's exposure.
+type AnimatedTranslate struct {
+	hitable   Hitable
+	offset    Track
+	lightTime float64
+}
+
+func (at AnimatedTranslate) hit(r Ray, tMin, tMax float64, record *Hit, sampler Sampler) bool {
+	return Translate{at.hitable, at.offset.at(r.time())}.hit(r, tMin, tMax, record, sampler)
+}
+
+func (at AnimatedTranslate) boundingBox(t0, t1 float64) (bool, *AABB) {
+	hasBox, boundingBox := at.hitable.boundingBox(t0, t1)
+
+	if !hasBox {
+		return false, nil
+	}
+
+	var box *AABB
+
+	for _, offset := range at.offset.extremes(t0, t1) {
+		moved := AABB{boundingBox.min.add(offset), boundingBox.max.add(offset)}
+
+		if box == nil {
+			box = &moved
+		} else {
+			box = SurroundingBox(*box, moved)
+		}
+	}
+
+	return true, box
+}
+
+func (at AnimatedTranslate) pdfValue(o, direction Vec3) float64 {
+	return Translate{at.hitable, at.offset.at(at.lightTime)}.pdfValue(o, direction)
+}
+
+func (at AnimatedTranslate) random(o Vec3, sampler Sampler) Vec3 {
+	return Translate{at.hitable, at.offset.at(at.lightTime)}.random(o, sampler)
+}
+
+// AnimatedRotateY turns a Hitable about the Y axis by an angle in degrees keyframed
+// over time, sampled as a light at lightTime as AnimatedTranslate is.
+type AnimatedRotateY struct {
+	hitable   Hitable
+	angle     Track
+	lightTime float64
+}
+
+// rotation returns the RotateY at a time, without the bounding box it does not need
+// to hit.
+func (ar AnimatedRotateY) rotation(time float64) RotateY {
+	radians := ar.angle.number(time) * math.Pi / 180
+
+	return RotateY{ar.hitable, math.Sin(radians), math.Cos(radians), false, AABB{}}
+}
+
+func (ar AnimatedRotateY) hit(r Ray, tMin, tMax float64, record *Hit, sampler Sampler) bool {
+	return ar.rotation(r.time()).hit(r, tMin, tMax, record, sampler)
+}
+
+// boundingBox turns the box as RotateY does while the angle holds still, and otherwise
+// bounds the whole circle the box could sweep about the axis.
+func (ar AnimatedRotateY) boundingBox(t0, t1 float64) (bool, *AABB) {
+	extremes := ar.angle.extremes(t0, t1)
+	still := true
+
+	for _, angle := range extremes {
+		still = still && angle == extremes[0]
+	}
+
+	if still {
+		rotated := NewRotateY(ar.hitable, extremes[0].x())
+
+		return rotated.hasBox, &rotated.bbox
+	}
+
+	hasBox, boundingBox := ar.hitable.boundingBox(t0, t1)
+
+	if !hasBox {
+		return false, nil
+	}
+
+	radius := 0.0
+
+	for _, x := range []float64{boundingBox.min.x(), boundingBox.max.x()} {
+		for _, z := range []float64{boundingBox.min.z(), boundingBox.max.z()} {
+			radius = math.Max(radius, math.Hypot(x, z))
+		}
+	}
+
+	return true, &AABB{
+		Vec3{-radius, boundingBox.min.y(), -radius},
+		Vec3{radius, boundingBox.max.y(), radius},
+	}
+}
+
+func (ar AnimatedRotateY) pdfValue(o, direction Vec3) float64 {
+	return ar.rotation(ar.lightTime).pdfValue(o, direction)
+}
+
+func (ar AnimatedRotateY) random(o Vec3, sampler Sampler) Vec3 {
+	return ar.rotation(ar.lightTime).random(o, sampler)
+}
+
+// MaterialKind is the kind of Material an AnimatedMaterial is.
+type MaterialKind int
+
+// The kinds of Material that can be keyframed.
+const (
+	MaterialLambertian MaterialKind = iota
+	MaterialMetal
+	MaterialDielectric
+	MaterialLight
+	MaterialIsotropic
+)
+
+// AnimatedMaterial is a Material whose parameters are keyframed: the color, which is
+// the albedo or the light emitted, and the number, which is the fuzz of a Metal or the
+// index of a Dielectric. The tracks are evaluated at the time of each ray straight into
+// values, so that hitting it does not allocate.
+type AnimatedMaterial struct {
+	kind   MaterialKind
+	color  Track
+	number Track
+}
+
+// NewAnimatedMaterial returns an AnimatedMaterial of the tracks, or the Material they
+// hold still at when neither is animated.
+func NewAnimatedMaterial(kind MaterialKind, color, number Track) Material {
+	am := AnimatedMaterial{kind, color, number}
+
+	if color.animated() || number.animated() {
+		return am
+	}
+
+	return am.at(0)
+}
+
+// at returns the Material at a time.
+func (am AnimatedMaterial) at(time float64) Material {
+	switch am.kind {
+	case MaterialMetal:
+		return NewMetal(am.color.at(time), am.number.number(time))
+	case MaterialDielectric:
+		return NewDielectric(am.number.number(time))
+	case MaterialLight:
+		return DiffuseLight{ConstantTexture{am.color.at(time)}}
+	case MaterialIsotropic:
+		return Isotropic{ConstantTexture{am.color.at(time)}}
+	}
+
+	return NewLambertian(ConstantTexture{am.color.at(time)})
+}
+
+func (am AnimatedMaterial) scatter(rayIn Ray, hit Hit, sampler Sampler) (didScatter bool, scatter Scatter) {
+	time := rayIn.time()
+
+	switch am.kind {
+	case MaterialMetal:
+		return NewMetal(am.color.at(time), am.number.number(time)).scatter(rayIn, hit, sampler)
+	case MaterialDielectric:
+		return NewDielectric(am.number.number(time)).scatter(rayIn, hit, sampler)
+	case MaterialLight:
+		return DiffuseLight{}.scatter(rayIn, hit, sampler)
+	case MaterialIsotropic:
+		return true, Scatter{Ray{}, false, am.color.at(time), SpherePdf{}}
+	}
+
+	return true, Scatter{Ray{}, false, am.color.at(time), NewCosinePdf(hit.normal)}
+}
+
+func (am AnimatedMaterial) scatteringPdf(rayIn Ray, hit Hit, scattered Ray) float64 {
+	switch am.kind {
+	case MaterialLambertian:
+		return Lambertian{}.scatteringPdf(rayIn, hit, scattered)
+	case MaterialIsotropic:
+		return Isotropic{}.scatteringPdf(rayIn, hit, scattered)
+	}
+
+	return 0
+}
+
+func (am AnimatedMaterial) emitted(rayIn Ray, hit Hit, u, v float64, p Vec3) Vec3 {
+	if am.kind == MaterialLight && hit.normal.dot(rayIn.direction()) < 0.0 {
+		return am.color.at(rayIn.time())
+	}
+
+	return EmitBlack()
+}
+
+func (am AnimatedMaterial) albedoAt(rayIn Ray, hit Hit) Vec3 {
+	if am.kind == MaterialDielectric {
+		return Vec3{1, 1, 1}
+	}
+
+	return am.color.at(rayIn.time())
+}
+
+// CameraAnimation holds the keyframed camera settings, each left empty when it holds
+// still at the configured value.
+type CameraAnimation struct {
+	from     Track
+	at       Track
+	up       Track
+	fov      Track
+	aperture Track
+	focus    Track
+}
+
+// animated reports whether any of the camera settings move.
+func (ca CameraAnimation) animated() bool {
+	for _, track := range []Track{ca.from, ca.at, ca.up, ca.fov, ca.aperture, ca.focus} {
+		if track.animated() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AnimatedCamera moves a Camera through its animation while the shutter is open. The
+// Camera posed halfway through the exposure draws each ray's time, and the ray is then
+// traced by the Camera posed at that time from the same draws of the sampler.
+type AnimatedCamera struct {
+	camera Camera
+	pose   func(time float64) Camera
+}
+
+func (ac AnimatedCamera) getRay(s, t float64, sampler Sampler) (Ray, bool) {
+	draws := cameraDraws{sampler: sampler}
+
+	r, ok := ac.camera.getRay(s, t, &draws)
+
+	if !ok {
+		return r, ok
+	}
+
+	draws.replay()
+
+	return ac.pose(r.time()).getRay(s, t, &draws)
+}
+
+// cameraDraws records what a Camera draws from a Sampler, so that the same draws can be
+// replayed to another.
+type cameraDraws struct {
+	sampler Sampler
+	values  []float64
+	next    int
+}
+
+// replay starts handing back the recorded draws.
+func (d *cameraDraws) replay() {
+	d.sampler = nil
+	d.next = 0
+}
+
+func (d *cameraDraws) Float64() float64 {
+	if d.sampler == nil {
+		d.next++
+
+		return d.values[d.next-1]
+	}
+
+	d.values = append(d.values, d.sampler.Float64())
+
+	return d.values[len(d.values)-1]
+}
+
+func (d *cameraDraws) float64Pair() (float64, float64) {
+	if d.sampler == nil {
+		return d.Float64(), d.Float64()
+	}
+
+	u, v := Float64Pair(d.sampler)
+	d.values = append(d.values, u, v)
+
+	return u, v
+}
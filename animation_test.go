@@ -0,0 +1,193 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTrackInterpolation(t *testing.T) {
+	linear := Track{{1, Vec3{2, 0, 0}, InterpolationLinear}, {3, Vec3{6, 0, 0}, InterpolationStep}, {4, Vec3{0, 0, 0}, InterpolationLinear}}
+
+	for _, test := range []struct {
+		time     float64
+		expected float64
+	}{
+		{0, 2},
+		{1, 2},
+		{2, 4},
+		{3, 6},
+		{3.9, 6},
+		{4, 0},
+		{5, 0},
+	} {
+		if value := linear.number(test.time); value != test.expected {
+			t.Errorf("Track at %v is %v, expected %v", test.time, value, test.expected)
+		}
+	}
+
+	bezier := Track{{0, Vec3{0, 0, 0}, InterpolationBezier}, {1, Vec3{1, 2, 0}, InterpolationBezier}, {3, Vec3{0, 0, 4}, InterpolationLinear}}
+
+	if bezier.at(1) != (Vec3{1, 2, 0}) || bezier.at(3) != (Vec3{0, 0, 4}) {
+		t.Errorf("Bezier track misses its keys, %v and %v", bezier.at(1), bezier.at(3))
+	}
+
+	// It eases out of the first key, and passes smoothly through the second.
+	const h = 1e-6
+
+	if start := bezier.at(h).length() / h; start > 1e-3 {
+		t.Errorf("Bezier track leaves its first key at %v", start)
+	}
+
+	before := bezier.at(1).subtract(bezier.at(1 - h)).divideScalar(h)
+	after := bezier.at(1 + h).subtract(bezier.at(1)).divideScalar(h)
+
+	if before.subtract(after).length() > 1e-4 {
+		t.Errorf("Bezier track turns at its second key, from %v to %v", before, after)
+	}
+}
+
+func TestTrackExtremes(t *testing.T) {
+	// The slope through the middle key carries the curve past the first.
+	track := Track{{0, Vec3{1, 0, 0}, InterpolationBezier}, {1, Vec3{0, 0, 0}, InterpolationBezier}, {5, Vec3{5, 0, 0}, InterpolationLinear}}
+
+	for _, span := range [][2]float64{{0, 5}, {0.2, 0.8}, {2, 3}, {-1, 0.5}} {
+		low, high := math.Inf(1), math.Inf(-1)
+
+		for _, value := range track.extremes(span[0], span[1]) {
+			low = math.Min(low, value.x())
+			high = math.Max(high, value.x())
+		}
+
+		for time := span[0]; time <= span[1]; time += 0.01 {
+			if value := track.number(time); value < low-1e-12 || value > high+1e-12 {
+				t.Errorf("Track at %v is %v, outside [%v, %v] for %v", time, value, low, high, span)
+			}
+		}
+	}
+}
+
+func TestAnimatedTransforms(t *testing.T) {
+	sphere := NewStationarySphere(Vec3{0, 0, 0}, 1, MaterialZero{})
+	moving := AnimatedTranslate{sphere, Track{{0, Vec3{0, 0, 0}, InterpolationLinear}, {1, Vec3{10, 0, 0}, InterpolationLinear}}, 0}
+
+	var hit Hit
+
+	if !moving.hit(Ray{Vec3{5, 0, -5}, Vec3{0, 0, 1}, 0.5}, 0.001, math.MaxFloat64, &hit, nil) {
+		t.Errorf("Expected to hit the sphere halfway along its path")
+	}
+
+	if moving.hit(Ray{Vec3{5, 0, -5}, Vec3{0, 0, 1}, 0}, 0.001, math.MaxFloat64, &hit, nil) {
+		t.Errorf("Expected to miss the sphere where it starts")
+	}
+
+	if _, box := moving.boundingBox(0.25, 1); box.min != (Vec3{1.5, -1, -1}) || box.max != (Vec3{11, 1, 1}) {
+		t.Errorf("Moving sphere bounded by %v", box)
+	}
+
+	// A box off the axis turns through its path, always within its bounds.
+	box := NewBox(Vec3{2, 0, 0}, Vec3{3, 1, 1}, MaterialZero{})
+	turning := AnimatedRotateY{box, Track{{0, Vec3{0, 0, 0}, InterpolationLinear}, {1, Vec3{90, 0, 0}, InterpolationLinear}}, 0}
+
+	if !turning.hit(Ray{Vec3{0.5, 0.5, 10}, Vec3{0, 0, -1}, 1}, 0.001, math.MaxFloat64, &hit, nil) || math.Abs(hit.p.z()+2) > 1e-9 {
+		t.Errorf("Expected to hit the box turned a quarter onto -z, got %v", hit.p)
+	}
+
+	_, bounds := turning.boundingBox(0, 1)
+
+	for time := 0.0; time <= 1; time += 0.1 {
+		_, turned := NewRotateY(box, 90*time).boundingBox(0, 1)
+
+		if turned.min.x() < bounds.min.x() || turned.min.z() < bounds.min.z() || turned.max.x() > bounds.max.x() || turned.max.z() > bounds.max.z() {
+			t.Errorf("Box at %v is %v, outside %v", time, turned, bounds)
+		}
+	}
+}
+
+func TestAnimatedMaterial(t *testing.T) {
+	albedo := Track{{0, Vec3{1, 0, 0}, InterpolationLinear}, {1, Vec3{0, 0, 1}, InterpolationLinear}}
+
+	material := NewAnimatedMaterial(MaterialLambertian, albedo, nil)
+	r := Ray{Vec3{}, Vec3{0, 0, 1}, 0.25}
+
+	if color := material.albedoAt(r, Hit{}); color != (Vec3{0.75, 0, 0.25}) {
+		t.Errorf("Albedo a quarter of the way is %v", color)
+	}
+
+	if _, still := NewAnimatedMaterial(MaterialMetal, Track{{}}, Track{{}}).(Metal); !still {
+		t.Errorf("Expected a material without keyframes to be built once")
+	}
+
+	// Evaluating the tracks allocates nothing beyond what the Material itself does.
+	light := NewAnimatedMaterial(MaterialLight, albedo, nil)
+	hit := Hit{normal: Vec3{0, 0, -1}}
+
+	if allocations := testing.AllocsPerRun(100, func() {
+		material.albedoAt(r, hit)
+		light.emitted(r, hit, 0, 0, Vec3{})
+	}); allocations != 0 {
+		t.Errorf("Expected no allocations per hit, got %v", allocations)
+	}
+
+	still := NewLambertian(ConstantTexture{Vec3{1, 1, 1}})
+
+	if animated, static := testing.AllocsPerRun(100, func() { material.scatter(r, hit, nil) }), testing.AllocsPerRun(100, func() { still.scatter(r, hit, nil) }); animated > static {
+		t.Errorf("Expected scattering to allocate no more than a Lambertian, got %v and %v", animated, static)
+	}
+}
+
+func TestFrameFilename(t *testing.T) {
+	for _, test := range []struct {
+		filename string
+		frame    int
+		expected string
+	}{
+		{"output.png", 7, "output_0007.png"},
+		{"shots/take_##.exr", 7, "shots/take_07.exr"},
+		{"f#_###.pfm", 1234, "f#_1234.pfm"},
+		{"render", 12, "render_0012"},
+	} {
+		if filename := frameFilename(test.filename, test.frame); filename != test.expected {
+			t.Errorf("Frame %d of %q is %q, expected %q", test.frame, test.filename, filename, test.expected)
+		}
+	}
+}
+
+func TestAnimatedCameraBlursMotion(t *testing.T) {
+	config := Config{
+		width:     4,
+		height:    4,
+		at:        Vec3{0, 0, -10},
+		up:        Vec3{0, 1, 0},
+		fov:       40,
+		timeStart: 0,
+		timeEnd:   1,
+		cameraAnimation: CameraAnimation{
+			from: Track{{0, Vec3{0, 0, 0}, InterpolationLinear}, {1, Vec3{4, 0, 0}, InterpolationLinear}},
+		},
+	}
+
+	camera := config.posed(0.5).camera()
+	sampler := NewSampler(SamplerIndependent, 1, 16)
+	times := make(map[float64]bool)
+
+	// Each ray leaves from where the camera is at its own time.
+	for s := 0; s < 16; s++ {
+		sampler.startSample(0, s)
+
+		r, ok := camera.getRay(0.5, 0.5, sampler)
+
+		if !ok || r.origin().subtract(Vec3{4 * r.time(), 0, 0}).length() > 1e-9 {
+			t.Fatalf("Ray at %v leaves from %v", r.time(), r.origin())
+		}
+
+		times[r.time()] = true
+	}
+
+	if len(times) < 2 {
+		t.Errorf("Expected rays spread over the shutter interval, got times %v", times)
+	}
+
+	if _, still := (Config{from: Vec3{0, 0, 1}, up: Vec3{0, 1, 0}, fov: 40, width: 4, height: 4}).camera().(PerspectiveCamera); !still {
+		t.Errorf("Expected a camera without animation to be built once")
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AOV is an arbitrary output variable, something besides color accumulated for each pixel.
+type AOV int
+
+// The supported AOVs. Depth, normal, albedo and UV are averaged over the samples whose
+// camera ray hit something, IDs are those of the first sample, the direct and indirect
+// light add up to the color, and the sample count is how many samples each pixel took.
+const (
+	AOVDepth AOV = iota
+	AOVNormal
+	AOVAlbedo
+	AOVObjectID
+	AOVMaterialID
+	AOVUV
+	AOVDirect
+	AOVIndirect
+	AOVSampleCount
+)
+
+var aovNames = []string{"depth", "normal", "albedo", "object-id", "material-id", "uv", "direct", "indirect", "samples"}
+
+// ParseAOVs parses a comma separated list of AOV names, or "all".
+func ParseAOVs(s string) ([]AOV, error) {
+	var aovs []AOV
+
+	if s == "all" {
+		for i := range aovNames {
+			aovs = append(aovs, AOV(i))
+		}
+
+		return aovs, nil
+	}
+
+	for _, name := range strings.Split(s, ",") {
+		aov, err := ParseAOV(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+
+		aovs = append(aovs, aov)
+	}
+
+	return aovs, nil
+}
+
+// ParseAOV parses the name of an AOV.
+func ParseAOV(s string) (AOV, error) {
+	for i, name := range aovNames {
+		if name == s {
+			return AOV(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown AOV %q, expected one of %v", s, aovNames)
+}
+
+func (a AOV) String() string {
+	if a >= 0 && int(a) < len(aovNames) {
+		return aovNames[a]
+	}
+
+	return fmt.Sprintf("AOV(%d)", int(a))
+}
+
+// channels returns the names of the components of the AOV that are stored.
+func (a AOV) channels() []string {
+	switch a {
+	case AOVDepth:
+		return []string{"Z"}
+	case AOVNormal:
+		return []string{"X", "Y", "Z"}
+	case AOVObjectID, AOVMaterialID:
+		return []string{"id"}
+	case AOVSampleCount:
+		return []string{"count"}
+	case AOVUV:
+		return []string{"U", "V"}
+	}
+
+	return []string{"R", "G", "B"}
+}
+
+// firstHit reports whether the AOV describes the surface first hit by the camera ray.
+func (a AOV) firstHit() bool {
+	return a == AOVDepth || a == AOVNormal || a == AOVAlbedo || a == AOVUV
+}
+
+// isID reports whether the AOV holds integer IDs, which cannot be averaged.
+func (a AOV) isID() bool {
+	return a == AOVObjectID || a == AOVMaterialID
+}
+
+// isLight reports whether the AOV is a share of the light making up the color.
+func (a AOV) isLight() bool {
+	return a == AOVDirect || a == AOVIndirect
+}
+
+// PathRecord collects what a path learned besides its color, for the AOVs.
+type PathRecord struct {
+	hit        bool
+	depth      float64
+	normal     Vec3
+	albedo     Vec3
+	uv         Vec3
+	objectID   int
+	materialID int
+	direct     Vec3
+	indirect   Vec3
+}
+
+// recordFirstHit stores the surface the camera ray hit.
+func (p *PathRecord) recordFirstHit(r Ray, hit Hit) {
+	p.hit = true
+	p.depth = hit.t * r.direction().length()
+	p.normal = hit.normal
+	p.albedo = hit.material.albedoAt(r, hit)
+	p.uv = Vec3{hit.u, hit.v, 0}
+	p.objectID = hit.objectID
+	p.materialID = materialID(hit.material)
+}
+
+// addLight splits light reaching the camera by the number of bounces it took, counting
+// light seen directly or after a single bounce as direct.
+func (p *PathRecord) addLight(bounce int, light Vec3) {
+	if bounce <= 1 {
+		p.direct.inPlaceAdd(light)
+	} else {
+		p.indirect.inPlaceAdd(light)
+	}
+}
+
+// value returns the AOV from the record.
+func (p *PathRecord) value(aov AOV) Vec3 {
+	switch aov {
+	case AOVDepth:
+		return Vec3{p.depth, p.depth, p.depth}
+	case AOVNormal:
+		return p.normal
+	case AOVAlbedo:
+		return p.albedo
+	case AOVObjectID:
+		id := float64(p.objectID)
+
+		return Vec3{id, id, id}
+	case AOVMaterialID:
+		id := float64(p.materialID)
+
+		return Vec3{id, id, id}
+	case AOVUV:
+		return p.uv
+	case AOVDirect:
+		return p.direct
+	}
+
+	return p.indirect
+}
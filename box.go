@@ -90,8 +90,8 @@ func NewBox(p0, p1 Vec3, material Material) Box {
 	}
 }
 
-func (b Box) hit(r Ray, tMin, tMax float64) (bool, *Hit) {
-	return b.hitables.hit(r, tMin, tMax)
+func (b Box) hit(r Ray, tMin, tMax float64, record *Hit, sampler Sampler) bool {
+	return b.hitables.hit(r, tMin, tMax, record, sampler)
 }
 
 func (b Box) boundingBox(t0, t1 float64) (hasBox bool, box *AABB) {
@@ -107,6 +107,6 @@ func (b Box) pdfValue(o, direction Vec3) float64 {
 	return 0.0
 }
 
-func (b Box) random(o Vec3) Vec3 {
+func (b Box) random(o Vec3, sampler Sampler) Vec3 {
 	return Vec3{1, 0, 0}
 }
@@ -0,0 +1,123 @@
+package main
+
+// BuiltinScene is one of the scenes defined in scene.go, along with a camera that frames it.
+type BuiltinScene struct {
+	name        string
+	description string
+	frame       func(config Config) Config
+	build       func(config Config) (world, lightShapes Hitable, err error)
+}
+
+// BuiltinScenes are the scenes that can be rendered by name.
+var BuiltinScenes = []BuiltinScene{
+	{
+		"simple",
+		"Diffuse, metal and hollow glass spheres on a checkered ground",
+		lookAt(Vec3{-2, 2, 1}, Vec3{0, 0, -1}, 90),
+		withoutLights(SimpleScene),
+	},
+	{
+		"random",
+		"Many small random spheres around three large ones",
+		func(config Config) Config {
+			config = lookAt(Vec3{13, 2, 3}, Vec3{0, 0, 0}, 20)(config)
+			config.aperture = 0.1
+			config.focus = 10
+
+			return config
+		},
+		withoutLights(RandomScene),
+	},
+	{
+		"two-spheres",
+		"Two marble spheres",
+		lookAt(Vec3{13, 2, 3}, Vec3{0, 0, 0}, 20),
+		withoutLights(TwoSpheres),
+	},
+	{
+		"earth",
+		"A sphere textured with earth.jpg from the working directory",
+		lookAt(Vec3{13, 2, 3}, Vec3{0, 0, 0}, 20),
+		func(config Config) (Hitable, Hitable, error) {
+			world, err := EarthSphere(config, "earth.jpg")
+
+			return world, nil, err
+		},
+	},
+	{
+		"simple-light",
+		"Noise textured spheres lit by a sphere and a rectangle",
+		lookAt(Vec3{26, 3, 6}, Vec3{0, 2, 0}, 20),
+		withoutLights(SimpleLight),
+	},
+	{
+		"cornell-box",
+		"The Cornell box with a glass sphere and an aluminum box",
+		lookAt(Vec3{278, 278, -800}, Vec3{278, 278, 0}, 40),
+		withLights(CornellBox),
+	},
+	{
+		"cornell-smoke",
+		"The Cornell box with two blocks of smoke",
+		lookAt(Vec3{278, 278, -800}, Vec3{278, 278, 0}, 40),
+		withLights(CornellSmoke),
+	},
+}
+
+// FindBuiltinScene looks up a BuiltinScene by name.
+func FindBuiltinScene(name string) (BuiltinScene, bool) {
+	for _, scene := range BuiltinScenes {
+		if scene.name == name {
+			return scene, true
+		}
+	}
+
+	return BuiltinScene{}, false
+}
+
+// load frames the scene with its camera and builds it, after override changes the
+// settings when there is one. It fails when the scene needs a file it cannot read.
+func (bs BuiltinScene) load(config Config, override func(Config) Config) (Scene, error) {
+	config = bs.frame(config)
+
+	if override != nil {
+		config = override(config)
+	}
+
+	config.scene = bs.name
+	world, lightShapes, err := bs.build(config)
+	if err != nil {
+		return Scene{}, err
+	}
+
+	if list, ok := world.(HitableList); ok {
+		world = NumberObjects(list)
+	}
+
+	return Scene{config, world, lightShapes, nil}, nil
+}
+
+func lookAt(from, at Vec3, fov float64) func(config Config) Config {
+	return func(config Config) Config {
+		config.from = from
+		config.at = at
+		config.up = Vec3{0, 1, 0}
+		config.fov = fov
+
+		return config
+	}
+}
+
+func withoutLights(build func(config Config) Hitable) func(config Config) (Hitable, Hitable, error) {
+	return func(config Config) (Hitable, Hitable, error) {
+		return build(config), nil, nil
+	}
+}
+
+func withLights(build func(config Config) (Hitable, Hitable)) func(config Config) (Hitable, Hitable, error) {
+	return func(config Config) (Hitable, Hitable, error) {
+		world, lightShapes := build(config)
+
+		return world, lightShapes, nil
+	}
+}
@@ -1,99 +1,318 @@
 package main
 
-import (
-	"math/rand"
-	"sort"
+import "sort"
+
+const (
+	// bvhBins is the number of buckets candidate splits are evaluated at, per axis.
+	bvhBins = 12
+	// bvhMaxLeafSize is the most primitives a leaf may hold.
+	bvhMaxLeafSize = 4
+	// bvhTraversalCost is the cost of visiting a node relative to testing a primitive.
+	bvhTraversalCost = 0.125
 )
 
-// BVHNode represents a node in a Bounding Volume Hierarchy
+// BVHNode is a Bounding Volume Hierarchy flattened into an array in depth-first order,
+// so that every interior node is directly followed by its first child.
 type BVHNode struct {
-	left  Hitable
-	right Hitable
-	box   *AABB
+	nodes      []linearBVHNode
+	primitives HitableList
 }
 
-func (n *BVHNode) newBVHNode(hList *HitableList, time0, time1 float64) *BVHNode {
-	list := *hList
-	axis := int(3 * rand.Float64())
+// linearBVHNode is a node of a flattened BVHNode. Leaves hold count primitives starting
+// at offset. Interior nodes have a count of zero, their second child at offset, and the
+// axis they were split along.
+type linearBVHNode struct {
+	box    AABB
+	offset int
+	count  int
+	axis   int
+}
 
-	if axis == 0 {
-		sort.Sort(SortByX(list))
-	} else if axis == 1 {
-		sort.Sort(SortByY(list))
-	} else if axis == 2 {
-		sort.Sort(SortByZ(list))
-	} else {
-		panic("Unexpected axis!")
+// bvhPrimitive caches the bounds of a Hitable while building a BVH.
+type bvhPrimitive struct {
+	hitable  Hitable
+	box      AABB
+	centroid Vec3
+}
+
+// bvhBin accumulates the primitives whose centroids fall in one bucket.
+type bvhBin struct {
+	count int
+	box   AABB
+}
+
+// NewBVHNode builds a BVH with the binned surface area heuristic, which splits where
+// the chance of a ray hitting each side times the number of primitives inside is least.
+func NewBVHNode(hitables HitableList, time0, time1 float64) *BVHNode {
+	if len(hitables) == 0 {
+		panic("No Hitables in BVHNode constructor")
 	}
 
-	length := len(list)
+	primitives := make([]bvhPrimitive, len(hitables))
 
-	if length == 1 {
-		n.left = list[0]
-		n.right = list[0]
-	} else if length == 2 {
-		n.left = list[0]
-		n.right = list[1]
-	} else {
-		firstHalf := list[:length/2]
-		secondHalf := list[length/2:]
+	for i, hitable := range hitables {
+		hasBox, box := hitable.boundingBox(time0, time1)
 
-		n.left = *n.newBVHNode(&firstHalf, time0, time1)
-		n.right = *n.newBVHNode(&secondHalf, time0, time1)
-	}
+		if !hasBox {
+			panic("No BoundingBox in BVHNode constructor")
+		}
 
-	hasLeftBox, leftBox := n.left.boundingBox(time0, time1)
-	hasRightBox, rightBox := n.right.boundingBox(time0, time1)
+		primitives[i] = bvhPrimitive{hitable, *box, box.centroid()}
+	}
 
-	if !hasLeftBox || !hasRightBox {
-		panic("No BoundingBox in BVHNode constructor")
+	n := &BVHNode{
+		primitives: make(HitableList, 0, len(hitables)),
 	}
 
-	n.box = SurroundingBox(*leftBox, *rightBox)
+	n.build(primitives)
 
 	return n
 }
 
-func (n BVHNode) hit(r Ray, tMin, tMax float64) (bool, *Hit) {
-	didHit := n.box.hit(r, tMin, tMax)
+// build appends the subtree for the primitives, reordering them, and returns the index of its root.
+func (n *BVHNode) build(primitives []bvhPrimitive) int {
+	index := len(n.nodes)
+	n.nodes = append(n.nodes, linearBVHNode{})
+
+	box := primitives[0].box
+	centroids := PointBox(primitives[0].centroid)
+
+	for _, primitive := range primitives[1:] {
+		box = *SurroundingBox(box, primitive.box)
+		centroids = *SurroundingBox(centroids, PointBox(primitive.centroid))
+	}
+
+	axis, split, cost := bestBVHSplit(primitives, box, centroids)
+	leafCost := float64(len(primitives))
+
+	if len(primitives) == 1 || (len(primitives) <= bvhMaxLeafSize && leafCost <= cost) {
+		n.nodes[index] = linearBVHNode{box, len(n.primitives), len(primitives), 0}
+
+		for _, primitive := range primitives {
+			n.primitives.add(primitive.hitable)
+		}
+
+		return index
+	}
+
+	var middle int
+
+	if axis < 0 {
+		// Every centroid is in the same bucket, so split the list in half.
+		axis = centroids.longestAxis()
+		middle = len(primitives) / 2
+
+		sort.SliceStable(primitives, func(i, j int) bool {
+			return primitives[i].centroid.get(axis) < primitives[j].centroid.get(axis)
+		})
+	} else {
+		middle = partitionBVH(primitives, axis, split, centroids)
+	}
+
+	n.build(primitives[:middle])
+	second := n.build(primitives[middle:])
+
+	n.nodes[index] = linearBVHNode{box, second, 0, axis}
+
+	return index
+}
+
+// bestBVHSplit returns the axis and bucket to split after with the lowest cost,
+// or an axis of -1 if the centroids cannot be told apart.
+func bestBVHSplit(primitives []bvhPrimitive, box, centroids AABB) (axis, split int, cost float64) {
+	axis = -1
+	cost = float64(len(primitives))
+
+	for a := 0; a < 3; a++ {
+		low := centroids.min.get(a)
+		extent := centroids.max.get(a) - low
+
+		if extent <= 0 {
+			continue
+		}
 
-	if didHit {
-		left := n.left
-		right := n.right
+		var bins [bvhBins]bvhBin
 
-		didHitLeft, leftHit := left.hit(r, tMin, tMax)
-		didHitRight, rightHit := right.hit(r, tMin, tMax)
+		for _, primitive := range primitives {
+			b := bvhBinIndex(primitive.centroid.get(a), low, extent)
 
-		if didHitLeft && didHitRight {
-			if leftHit.t < rightHit.t {
-				return true, leftHit
+			if bins[b].count == 0 {
+				bins[b].box = primitive.box
+			} else {
+				bins[b].box = *SurroundingBox(bins[b].box, primitive.box)
 			}
 
-			return true, rightHit
+			bins[b].count++
 		}
 
-		if didHitLeft {
-			return true, leftHit
+		for s := 0; s < bvhBins-1; s++ {
+			leftCount, leftArea := bvhBinsSummary(bins[:s+1])
+			rightCount, rightArea := bvhBinsSummary(bins[s+1:])
+
+			if leftCount == 0 || rightCount == 0 {
+				continue
+			}
+
+			splitCost := bvhTraversalCost +
+				(float64(leftCount)*leftArea+float64(rightCount)*rightArea)/box.surfaceArea()
+
+			if axis < 0 || splitCost < cost {
+				axis = a
+				split = s
+				cost = splitCost
+			}
 		}
+	}
 
-		if didHitRight {
-			return true, rightHit
+	return axis, split, cost
+}
+
+// bvhBinsSummary returns the number of primitives in some buckets and the area of their bounds.
+func bvhBinsSummary(bins []bvhBin) (int, float64) {
+	count := 0
+
+	var box AABB
+
+	for _, bin := range bins {
+		if bin.count == 0 {
+			continue
 		}
 
-		return false, nil
+		if count == 0 {
+			box = bin.box
+		} else {
+			box = *SurroundingBox(box, bin.box)
+		}
+
+		count += bin.count
+	}
+
+	if count == 0 {
+		return 0, 0
+	}
+
+	return count, box.surfaceArea()
+}
+
+func bvhBinIndex(value, low, extent float64) int {
+	b := int(bvhBins * (value - low) / extent)
+
+	if b >= bvhBins {
+		return bvhBins - 1
+	}
+
+	return b
+}
+
+// partitionBVH moves the primitives in buckets up to split to the front and returns how many there are.
+func partitionBVH(primitives []bvhPrimitive, axis, split int, centroids AABB) int {
+	low := centroids.min.get(axis)
+	extent := centroids.max.get(axis) - low
+
+	middle := 0
+
+	for i := range primitives {
+		if bvhBinIndex(primitives[i].centroid.get(axis), low, extent) <= split {
+			primitives[i], primitives[middle] = primitives[middle], primitives[i]
+			middle++
+		}
 	}
 
-	return false, nil
+	return middle
 }
 
-func (n BVHNode) boundingBox(t0, t1 float64) (bool, *AABB) {
-	return true, n.box
+// hit walks the tree nearest child first, so that once something is hit the shrunken
+// tMax lets the farther children be skipped.
+func (n *BVHNode) hit(r Ray, tMin, tMax float64, record *Hit, sampler Sampler) bool {
+	origin := r.origin()
+	direction := r.direction()
+	inverseDirection := Vec3{1 / direction.e0, 1 / direction.e1, 1 / direction.e2}
+	directionIsNegative := [3]bool{direction.e0 < 0, direction.e1 < 0, direction.e2 < 0}
+
+	var stackArray [64]int
+
+	stack := stackArray[:0]
+	current := 0
+	didHit := false
+
+	for {
+		node := &n.nodes[current]
+
+		if node.box.hit(origin, inverseDirection, tMin, tMax) {
+			if node.count > 0 {
+				for i := node.offset; i < node.offset+node.count; i++ {
+					if n.primitives[i].hit(r, tMin, tMax, record, sampler) {
+						didHit = true
+						tMax = record.t
+					}
+				}
+			} else if directionIsNegative[node.axis] {
+				stack = append(stack, current+1)
+				current = node.offset
+
+				continue
+			} else {
+				stack = append(stack, node.offset)
+				current++
+
+				continue
+			}
+		}
+
+		if len(stack) == 0 {
+			return didHit
+		}
+
+		current = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+	}
+}
+
+// crossing appends to primitives those in every leaf whose box the ray crosses between
+// tMin and tMax, which are all it could hit there, and returns them.
+func (n *BVHNode) crossing(r Ray, tMin, tMax float64, primitives HitableList) HitableList {
+	origin := r.origin()
+	direction := r.direction()
+	inverseDirection := Vec3{1 / direction.e0, 1 / direction.e1, 1 / direction.e2}
+
+	var stackArray [64]int
+
+	stack := stackArray[:0]
+	current := 0
+
+	for {
+		node := &n.nodes[current]
+
+		if node.box.hit(origin, inverseDirection, tMin, tMax) {
+			if node.count > 0 {
+				primitives = append(primitives, n.primitives[node.offset:node.offset+node.count]...)
+			} else {
+				stack = append(stack, node.offset)
+				current++
+
+				continue
+			}
+		}
+
+		if len(stack) == 0 {
+			return primitives
+		}
+
+		current = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+	}
+}
+
+func (n *BVHNode) boundingBox(t0, t1 float64) (bool, *AABB) {
+	box := n.nodes[0].box
+
+	return true, &box
 }
 
-func (n BVHNode) pdfValue(o, direction Vec3) float64 {
+func (n *BVHNode) pdfValue(o, direction Vec3) float64 {
 	return 0.0
 }
 
-func (n BVHNode) random(o Vec3) Vec3 {
+func (n *BVHNode) random(o Vec3, sampler Sampler) Vec3 {
 	return Vec3{1, 0, 0}
 }
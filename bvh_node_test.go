@@ -0,0 +1,85 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func randomSpheres(count int) HitableList {
+	rng := NewRand(3)
+	spheres := NewHitableList(0)
+
+	for i := 0; i < count; i++ {
+		center := Vec3{rng.Float64() * 20, rng.Float64() * 20, rng.Float64() * 20}
+
+		// Bunch some of the spheres together to give the heuristic something to do.
+		if i%3 == 0 {
+			center = center.multiplyScalar(0.1)
+		}
+
+		spheres.add(NewStationarySphere(center, 0.1+rng.Float64(), MaterialZero{}))
+	}
+
+	return spheres
+}
+
+func TestBVHNodeMatchesHitableList(t *testing.T) {
+	spheres := randomSpheres(200)
+	bvh := NewBVHNode(spheres, 0, 1)
+	rng := NewRand(4)
+
+	for i := 0; i < 1000; i++ {
+		r := Ray{
+			Vec3{-5, rng.Float64() * 20, rng.Float64() * 20},
+			Vec3{1, rng.Float64() - 0.5, rng.Float64() - 0.5},
+			0,
+		}
+
+		var expected, actual Hit
+
+		expectedHit := spheres.hit(r, 0.001, math.MaxFloat64, &expected, rng)
+		actualHit := bvh.hit(r, 0.001, math.MaxFloat64, &actual, rng)
+
+		if expectedHit != actualHit || (expectedHit && expected.t != actual.t) {
+			t.Fatalf("Ray %v: BVH hit %v at %v, list hit %v at %v", r, actualHit, actual, expectedHit, expected)
+		}
+	}
+}
+
+func TestBVHNodeIsDeterministic(t *testing.T) {
+	first := NewBVHNode(randomSpheres(100), 0, 1)
+	second := NewBVHNode(randomSpheres(100), 0, 1)
+
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("Building the same BVH twice gave different trees")
+	}
+}
+
+func TestBVHNodeSingleHitable(t *testing.T) {
+	sphere := NewStationarySphere(Vec3Zero(), 1, MaterialZero{})
+	bvh := NewBVHNode(HitableList{sphere}, 0, 1)
+
+	var hit Hit
+
+	didHit := bvh.hit(Ray{Vec3{0, 0, -5}, Vec3{0, 0, 1}, 0}, 0.001, math.MaxFloat64, &hit, nil)
+
+	if !didHit || hit.t != 4 {
+		t.Errorf("Expected a hit at 4, got %v %v", didHit, hit)
+	}
+}
+
+func TestBVHNodeHitDoesNotAllocate(t *testing.T) {
+	bvh := NewBVHNode(randomSpheres(200), 0, 1)
+	r := Ray{Vec3{-5, 10, 10}, Vec3{1, 0.01, 0.02}, 0}
+
+	var hit Hit
+
+	allocations := testing.AllocsPerRun(100, func() {
+		bvh.hit(r, 0.001, math.MaxFloat64, &hit, nil)
+	})
+
+	if allocations != 0 {
+		t.Errorf("Expected no allocations per hit, got %v", allocations)
+	}
+}
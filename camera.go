@@ -1,68 +1,263 @@
 package main
 
 import (
+	"fmt"
 	"math"
-	"math/rand"
 )
 
-// Camera represents the viewpoint of our scene.
-type Camera struct {
+// Camera turns a point on the image, s across and t up from the bottom left, each in
+// [0, 1], into a Ray leaving the camera at a time chosen by its Shutter. It reports
+// false for points the projection does not see.
+type Camera interface {
+	getRay(s, t float64, sampler Sampler) (Ray, bool)
+}
+
+// Projection picks how a Camera maps the scene onto the image.
+type Projection int
+
+// The supported projections.
+const (
+	ProjectionPerspective Projection = iota
+	ProjectionOrthographic
+	ProjectionFisheye
+	ProjectionEquirectangular
+)
+
+var projectionNames = []string{"perspective", "orthographic", "fisheye", "equirectangular"}
+
+// ParseProjection parses the name of a camera projection.
+func ParseProjection(s string) (Projection, error) {
+	for i, name := range projectionNames {
+		if name == s {
+			return Projection(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown projection %q, expected one of %v", s, projectionNames)
+}
+
+func (p Projection) String() string {
+	if p >= 0 && int(p) < len(projectionNames) {
+		return projectionNames[p]
+	}
+
+	return fmt.Sprintf("Projection(%d)", int(p))
+}
+
+// maxFov returns the limit on the field of view in degrees of the projection.
+func (p Projection) maxFov() float64 {
+	if p == ProjectionFisheye {
+		return 360
+	}
+
+	return 180
+}
+
+// cameraFrame is the position, orientation and Shutter every projection shares. The
+// camera looks down -w, with u to its right and v up.
+type cameraFrame struct {
+	origin  Vec3
+	u       Vec3
+	v       Vec3
+	w       Vec3
+	shutter Shutter
+}
+
+func newCameraFrame(from, at, up Vec3, shutter Shutter) cameraFrame {
+	w := from.subtract(at).unitVector()
+	u := up.cross(w).unitVector()
+	v := w.cross(u)
+
+	return cameraFrame{from, u, v, w, shutter}
+}
+
+// toWorld turns a direction in the camera's axes into the scene's.
+func (f cameraFrame) toWorld(x, y, z float64) Vec3 {
+	return f.u.multiplyScalar(x).add(f.v.multiplyScalar(y)).add(f.w.multiplyScalar(z))
+}
+
+// shutterTime returns a random time for a ray t up the image.
+func (f cameraFrame) shutterTime(sampler Sampler, t float64) float64 {
+	return f.shutter.sample(sampler.Float64(), t)
+}
+
+// PerspectiveCamera is a thin lens camera, focused on a plane focusDistance away
+// unless its Lens tilts the plane.
+type PerspectiveCamera struct {
+	cameraFrame
 	lowerLeftCorner Vec3
 	horizontal      Vec3
 	vertical        Vec3
-	origin          Vec3
-	u               Vec3
-	v               Vec3
-	w               Vec3
 	lensRadius      float64
-	time0           float64
-	time1           float64
+	aspect          float64
+	lens            Lens
+	focusPoint      Vec3
+	focusNormal     Vec3
 }
 
-// NewCamera returns an pre-initialized Camera.
-func NewCamera(from, at, up Vec3, vfov, aspect, aperture, focusDistance, t0, t1 float64) Camera {
-	lensRadius := aperture / 2
+// NewPerspectiveCamera returns a PerspectiveCamera with a vertical field of view of
+// vfov degrees.
+func NewPerspectiveCamera(from, at, up Vec3, vfov, aspect, aperture, focusDistance float64, shutter Shutter) PerspectiveCamera {
+	frame := newCameraFrame(from, at, up, shutter)
 
 	theta := vfov * math.Pi / 180
 	halfHeight := math.Tan(theta / 2)
 	halfWidth := aspect * halfHeight
 
-	origin := from
+	lowerLeftCorner := frame.origin.subtract(frame.u.multiplyScalar(halfWidth * focusDistance)).subtract(frame.v.multiplyScalar(halfHeight * focusDistance)).subtract(frame.w.multiplyScalar(focusDistance))
 
-	w := from.subtract(at).unitVector()
-	u := up.cross(w).unitVector()
-	v := w.cross(u)
-
-	lowerLeftCorner := origin.subtract(u.multiplyScalar(halfWidth * focusDistance)).subtract(v.multiplyScalar(halfHeight * focusDistance)).subtract(w.multiplyScalar(focusDistance))
-
-	horizontal := u.multiplyScalar(halfWidth * 2 * focusDistance)
-	vertical := v.multiplyScalar(halfHeight * 2 * focusDistance)
+	horizontal := frame.u.multiplyScalar(halfWidth * 2 * focusDistance)
+	vertical := frame.v.multiplyScalar(halfHeight * 2 * focusDistance)
 
-	return Camera{
+	return PerspectiveCamera{
+		frame,
 		lowerLeftCorner,
 		horizontal,
 		vertical,
-		origin,
-		u,
-		v,
-		w,
-		lensRadius,
-		t0,
-		t1,
+		aperture / 2,
+		aspect,
+		Lens{},
+		frame.origin.subtract(frame.w.multiplyScalar(focusDistance)),
+		frame.w.multiplyScalar(-1),
+	}
+}
+
+// withLens returns the camera fitted with the lens, which shifts its image and tilts
+// its focal plane about the point it focuses on straight ahead.
+func (c PerspectiveCamera) withLens(lens Lens) PerspectiveCamera {
+	c.lens = lens
+
+	if lens.shiftX != 0 || lens.shiftY != 0 {
+		c.lowerLeftCorner = c.lowerLeftCorner.add(c.horizontal.multiplyScalar(lens.shiftX)).add(c.vertical.multiplyScalar(lens.shiftY))
 	}
+
+	// A positive tilt about the horizontal brings the top of the focal plane nearer.
+	if lens.tilt != 0 {
+		sin, cos := math.Sincos(lens.tiltRotation)
+		axis := c.toWorld(cos, sin, 0)
+		sin, cos = math.Sincos(lens.tilt)
+		c.focusNormal = c.w.multiplyScalar(-cos).subtract(axis.cross(c.w).multiplyScalar(sin))
+	}
+
+	return c
 }
 
-func (c Camera) getRay(s, t float64) Ray {
-	rd := RandomInUnitDisk().multiplyScalar(c.lensRadius)
+func (c PerspectiveCamera) getRay(s, t float64, sampler Sampler) (Ray, bool) {
+	rd := c.lens.aperture(sampler)
+
+	if c.lens.vignetted(rd, s, t, c.aspect) {
+		return Ray{}, false
+	}
+
+	rd = rd.multiplyScalar(c.lensRadius)
 	offset := c.u.multiplyScalar(rd.x()).add(c.v.multiplyScalar(rd.y()))
 
 	origin := c.origin.add(offset)
-	direction := c.lowerLeftCorner.add(c.horizontal.multiplyScalar(s)).add(c.vertical.multiplyScalar(t)).subtract(c.origin).subtract(offset)
-	time := c.time0 + rand.Float64()*(c.time1-c.time0)
+	target := c.lowerLeftCorner.add(c.horizontal.multiplyScalar(s)).add(c.vertical.multiplyScalar(t))
 
-	return Ray{
-		origin,
-		direction,
-		time,
+	// The lens focuses where the ray through its center meets the tilted focal plane.
+	if c.lens.tilt != 0 {
+		d := target.subtract(c.origin)
+		denominator := d.dot(c.focusNormal)
+
+		if denominator <= 0 {
+			// It never does, so that part of the image is focused at infinity.
+			return Ray{origin, d, c.shutterTime(sampler, t)}, true
+		}
+
+		target = c.origin.add(d.multiplyScalar(c.focusPoint.subtract(c.origin).dot(c.focusNormal) / denominator))
 	}
+
+	direction := target.subtract(c.origin).subtract(offset)
+
+	return Ray{origin, direction, c.shutterTime(sampler, t)}, true
+}
+
+// OrthographicCamera sends parallel rays from a rectangle height high, for views
+// without perspective. With an aperture, the rays instead converge on the plane
+// focusDistance away, blurring what is in front of and behind it.
+type OrthographicCamera struct {
+	cameraFrame
+	lowerLeftCorner Vec3
+	horizontal      Vec3
+	vertical        Vec3
+	lensRadius      float64
+	focusDistance   float64
+}
+
+// NewOrthographicCamera returns an OrthographicCamera framing height scene units
+// vertically.
+func NewOrthographicCamera(from, at, up Vec3, height, aspect, aperture, focusDistance float64, shutter Shutter) OrthographicCamera {
+	frame := newCameraFrame(from, at, up, shutter)
+
+	lowerLeftCorner := frame.origin.subtract(frame.toWorld(aspect*height/2, height/2, 0))
+
+	return OrthographicCamera{
+		frame,
+		lowerLeftCorner,
+		frame.u.multiplyScalar(aspect * height),
+		frame.v.multiplyScalar(height),
+		aperture / 2,
+		focusDistance,
+	}
+}
+
+func (c OrthographicCamera) getRay(s, t float64, sampler Sampler) (Ray, bool) {
+	rd := RandomInUnitDisk(sampler).multiplyScalar(c.lensRadius)
+	offset := c.u.multiplyScalar(rd.x()).add(c.v.multiplyScalar(rd.y()))
+
+	origin := c.lowerLeftCorner.add(c.horizontal.multiplyScalar(s)).add(c.vertical.multiplyScalar(t)).add(offset)
+	direction := c.w.multiplyScalar(-c.focusDistance).subtract(offset)
+
+	return Ray{origin, direction, c.shutterTime(sampler, t)}, true
+}
+
+// FisheyeCamera is an equidistant fisheye, whose image circle fills the height of the
+// image. The angle from the view direction grows evenly with the distance from the
+// center, up to half of fov at the edge of the circle, outside of which it sees nothing.
+type FisheyeCamera struct {
+	cameraFrame
+	aspect  float64
+	halfFov float64
+}
+
+// NewFisheyeCamera returns a FisheyeCamera seeing fov degrees across its image circle.
+func NewFisheyeCamera(from, at, up Vec3, fov, aspect float64, shutter Shutter) FisheyeCamera {
+	return FisheyeCamera{newCameraFrame(from, at, up, shutter), aspect, fov * math.Pi / 360}
+}
+
+func (c FisheyeCamera) getRay(s, t float64, sampler Sampler) (Ray, bool) {
+	x := (2*s - 1) * c.aspect
+	y := 2*t - 1
+	r := math.Hypot(x, y)
+
+	if r > 1 {
+		return Ray{}, false
+	}
+
+	theta := r * c.halfFov
+	phi := math.Atan2(y, x)
+	direction := c.toWorld(math.Sin(theta)*math.Cos(phi), math.Sin(theta)*math.Sin(phi), -math.Cos(theta))
+
+	return Ray{c.origin, direction, c.shutterTime(sampler, t)}, true
+}
+
+// EquirectangularCamera sees the whole sphere around it, with longitude across the
+// image and latitude up it, for 360 by 180 degree panoramas. The view direction is
+// at the center, so images twice as wide as they are high keep their proportions.
+type EquirectangularCamera struct {
+	cameraFrame
+}
+
+// NewEquirectangularCamera returns an EquirectangularCamera.
+func NewEquirectangularCamera(from, at, up Vec3, shutter Shutter) EquirectangularCamera {
+	return EquirectangularCamera{newCameraFrame(from, at, up, shutter)}
+}
+
+func (c EquirectangularCamera) getRay(s, t float64, sampler Sampler) (Ray, bool) {
+	phi := 2 * math.Pi * (s - 0.5)
+	latitude := math.Pi * (t - 0.5)
+	direction := c.toWorld(math.Cos(latitude)*math.Sin(phi), math.Sin(latitude), -math.Cos(latitude)*math.Cos(phi))
+
+	return Ray{c.origin, direction, c.shutterTime(sampler, t)}, true
 }
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func angle(a, b Vec3) float64 {
+	return math.Acos(math.Max(-1, math.Min(1, a.unitVector().dot(b.unitVector()))))
+}
+
+func TestCameraProjections(t *testing.T) {
+	from := Vec3{0, 0, 0}
+	at := Vec3{0, 0, -10}
+	up := Vec3{0, 1, 0}
+	forward := Vec3{0, 0, -1}
+	rng := rand.New(rand.NewSource(1))
+
+	cameras := []Camera{
+		NewPerspectiveCamera(from, at, up, 90, 2, 0, 10, NewShutter(0.5, 1, nil, 0)),
+		NewOrthographicCamera(from, at, up, 4, 2, 0, 10, NewShutter(0.5, 1, nil, 0)),
+		NewFisheyeCamera(from, at, up, 180, 2, NewShutter(0.5, 1, nil, 0)),
+		NewEquirectangularCamera(from, at, up, NewShutter(0.5, 1, nil, 0)),
+	}
+
+	for _, camera := range cameras {
+		r, ok := camera.getRay(0.5, 0.5, rng)
+
+		if !ok || angle(r.direction(), forward) > 1e-9 {
+			t.Errorf("%T looks along %v at the center, expected %v", camera, r.direction(), forward)
+		}
+
+		if r.time() < 0.5 || r.time() >= 1 {
+			t.Errorf("%T sampled %v outside the shutter interval", camera, r.time())
+		}
+	}
+
+	// Orthographic rays are parallel, from a rectangle four high and eight wide.
+	orthographic := cameras[1]
+	r, _ := orthographic.getRay(1, 1, rng)
+
+	if angle(r.direction(), forward) > 1e-9 || r.origin().subtract(Vec3{4, 2, 0}).length() > 1e-9 {
+		t.Errorf("Orthographic corner ray is %v", r)
+	}
+
+	// The edge of the fisheye's image circle is half the field of view away, and the
+	// corners are outside it.
+	fisheye := cameras[2]
+
+	if r, _ := fisheye.getRay(0.5, 1, rng); math.Abs(angle(r.direction(), forward)-math.Pi/2) > 1e-9 || r.direction().y() <= 0 {
+		t.Errorf("Fisheye ray at the top of the circle is %v", r.direction())
+	}
+
+	if _, ok := fisheye.getRay(0, 0, rng); ok {
+		t.Errorf("Fisheye sees outside its image circle")
+	}
+
+	// The panorama wraps around, from behind on the left to looking straight up at
+	// the top.
+	equirectangular := cameras[3]
+
+	for _, test := range []struct {
+		s, t     float64
+		expected Vec3
+	}{
+		{0, 0.5, Vec3{0, 0, 1}},
+		{0.25, 0.5, Vec3{-1, 0, 0}},
+		{0.75, 0.5, Vec3{1, 0, 0}},
+		{0.5, 1, Vec3{0, 1, 0}},
+	} {
+		if r, _ := equirectangular.getRay(test.s, test.t, rng); angle(r.direction(), test.expected) > 1e-9 {
+			t.Errorf("Equirectangular ray at %v, %v is %v, expected %v", test.s, test.t, r.direction(), test.expected)
+		}
+	}
+}
+
+func TestRenderFisheye(t *testing.T) {
+	config := testProgressiveConfig()
+	config.width = 16
+	config.projection = ProjectionFisheye
+	config.fov = 120
+
+	world, lightShapes := CornellBox(config)
+	image := Render(config.camera(), world, lightShapes, config).Image()
+
+	// The corners are outside the image circle, while its center sees the box.
+	if image[0] != (Vec3{}) || image[len(image)-1] != (Vec3{}) {
+		t.Errorf("Expected black corners, got %v and %v", image[0], image[len(image)-1])
+	}
+
+	if center := image[4*16+8]; center == (Vec3{}) {
+		t.Errorf("Expected the center to see the box")
+	}
+}
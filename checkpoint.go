@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// checkpointMagic starts every checkpoint file, and changes with the layout.
+const checkpointMagic = "RTCHECK1"
+
+// checkpointHash identifies the scene, including the files it was built from and the
+// aperture mask, and the settings that change what each sample returns. The sample
+// count is left out, so a resumed render may take more samples, unless the sampler
+// stratifies that many samples. There is no random number generator state to save, as
+// every sample is seeded from the seed, its pixel and its index, which the per-pixel
+// sample counts record.
+func checkpointHash(config Config) uint64 {
+	hash := fnv.New64a()
+	stratified := 0
+
+	if config.sampler.stratifiesCount() {
+		stratified = config.samples
+	}
+
+	fmt.Fprintf(
+		hash,
+		"%q %d %d %v %v %v %v %v %v %v %v %v %v %v %v %v %v %v %d %d %v %v %v %v %v %d",
+		config.scene,
+		config.width,
+		config.height,
+		config.window(),
+		config.from,
+		config.at,
+		config.up,
+		config.fov,
+		config.projection,
+		config.orthographicHeight(),
+		config.stereo,
+		config.interocular(),
+		config.convergence,
+		config.zeroParallax(),
+		config.aperture,
+		config.focus,
+		config.timeStart,
+		config.timeEnd,
+		config.seed,
+		config.minSamples,
+		config.adaptiveThreshold,
+		config.aovs,
+		config.filter,
+		config.radius(),
+		config.sampler,
+		stratified,
+	)
+
+	mask := ""
+
+	if config.apertureMask != "" {
+		mask = fileDigest(config.apertureMask)
+	}
+
+	fmt.Fprintf(
+		hash,
+		" %v %v %d %v %q %v %v %v %v %v %v",
+		config.shutterCurve,
+		config.rollingShutter,
+		config.blades,
+		config.bladeRotation,
+		mask,
+		config.catsEye,
+		config.tilt,
+		config.tiltRotation,
+		config.shiftX,
+		config.shiftY,
+		config.squeeze,
+	)
+
+	return hash.Sum64()
+}
+
+// fileDigest identifies a file by its name and the hash of its contents, or by the error
+// reading it, which will not match a checkpoint of the file that could be read.
+func fileDigest(filename string) string {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err.Error()
+	}
+
+	return fmt.Sprintf("%s %x", filepath.Base(filename), sha256.Sum256(data))
+}
+
+// WriteCheckpoint writes everything the Film has accumulated, along with the hash of
+// the config it was rendered with.
+func WriteCheckpoint(w io.Writer, film *Film, config Config) error {
+	buffer := bufio.NewWriter(w)
+
+	header := []interface{}{
+		[]byte(checkpointMagic),
+		checkpointHash(config),
+		int64(film.width),
+		int64(film.height),
+		int64(len(film.aovs)),
+	}
+
+	data := []interface{}{
+		int64s(film.samples),
+		film.converged,
+		vec3Floats(film.color),
+		film.mean,
+		film.m2,
+		int64s(film.hits),
+	}
+
+	for _, layer := range film.layers {
+		data = append(data, vec3Floats(layer))
+	}
+
+	if film.weights != nil {
+		data = append(data, film.weights)
+	}
+
+	for _, value := range append(header, data...) {
+		if err := binary.Write(buffer, binary.LittleEndian, value); err != nil {
+			return err
+		}
+	}
+
+	return buffer.Flush()
+}
+
+// ReadCheckpoint reads a Film written by WriteCheckpoint, failing unless it was
+// rendered with the same scene and settings as config.
+func ReadCheckpoint(r io.Reader, config Config) (*Film, error) {
+	buffer := bufio.NewReader(r)
+
+	magic := make([]byte, len(checkpointMagic))
+
+	if _, err := io.ReadFull(buffer, magic); err != nil || string(magic) != checkpointMagic {
+		return nil, errors.New("not a checkpoint")
+	}
+
+	var hash uint64
+	var size [3]int64
+
+	if err := binary.Read(buffer, binary.LittleEndian, &hash); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(buffer, binary.LittleEndian, &size); err != nil {
+		return nil, err
+	}
+
+	window := config.window()
+
+	if hash != checkpointHash(config) || size != [3]int64{int64(window.width()), int64(window.height()), int64(len(config.aovs))} {
+		return nil, errors.New("checkpoint was rendered with a different scene or settings")
+	}
+
+	film := config.film()
+	pixels := film.width * film.height
+
+	samples := make([]int64, pixels)
+	color := make([]float64, 3*pixels)
+	hits := make([]int64, len(film.hits))
+	layers := make([][]float64, len(film.layers))
+
+	data := []interface{}{samples, film.converged, color, film.mean, film.m2, hits}
+
+	for i := range layers {
+		layers[i] = make([]float64, 3*pixels)
+		data = append(data, layers[i])
+	}
+
+	if film.weights != nil {
+		data = append(data, film.weights)
+	}
+
+	for _, value := range data {
+		if err := binary.Read(buffer, binary.LittleEndian, value); err != nil {
+			return nil, fmt.Errorf("truncated checkpoint: %v", err)
+		}
+	}
+
+	for i := range film.samples {
+		film.samples[i] = int(samples[i])
+	}
+
+	for i := range film.hits {
+		film.hits[i] = int(hits[i])
+	}
+
+	setVec3Floats(film.color, color)
+
+	for i, layer := range film.layers {
+		setVec3Floats(layer, layers[i])
+	}
+
+	return film, nil
+}
+
+// SaveCheckpoint writes a checkpoint file, replacing any old one only once the new one
+// is complete, so that dying part way through leaves the last checkpoint intact.
+func SaveCheckpoint(filename string, film *Film, config Config) error {
+	file, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(file.Name())
+
+	if err := WriteCheckpoint(file, film, config); err != nil {
+		file.Close()
+
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), filename)
+}
+
+// LoadCheckpoint reads a checkpoint file saved by SaveCheckpoint.
+func LoadCheckpoint(filename string, config Config) (*Film, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	film, err := ReadCheckpoint(file, config)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	return film, nil
+}
+
+func int64s(values []int) []int64 {
+	converted := make([]int64, len(values))
+
+	for i, value := range values {
+		converted[i] = int64(value)
+	}
+
+	return converted
+}
+
+func vec3Floats(values []Vec3) []float64 {
+	floats := make([]float64, 0, 3*len(values))
+
+	for _, value := range values {
+		floats = append(floats, value.x(), value.y(), value.z())
+	}
+
+	return floats
+}
+
+func setVec3Floats(values []Vec3, floats []float64) {
+	for i := range values {
+		values[i] = Vec3{floats[3*i], floats[3*i+1], floats[3*i+2]}
+	}
+}
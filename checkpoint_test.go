@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestResumeMatchesUninterruptedRender(t *testing.T) {
+	config := testProgressiveConfig()
+	config.samples = 24
+	config.passSamples = 5
+	config.minSamples = 4
+	config.adaptiveThreshold = 0.3
+	config.aovs = []AOV{AOVNormal, AOVObjectID, AOVSampleCount}
+	config.scene = "cornell-box"
+
+	world, lightShapes := CornellBox(config)
+	expected := Render(config.camera(), world, lightShapes, config)
+
+	// Stop after the second pass, as if the process had died.
+	var checkpoint bytes.Buffer
+
+	died := errors.New("died")
+	passes := 0
+
+	err := RenderProgressive(context.Background(), NewFilm(config.width, config.height, config.aovs), config.camera(), world, lightShapes, config, func(film *Film) error {
+		if passes++; passes < 2 {
+			return nil
+		}
+
+		if err := WriteCheckpoint(&checkpoint, film, config); err != nil {
+			t.Fatal(err)
+		}
+
+		return died
+	}, nil)
+	if err != died {
+		t.Fatalf("Expected the render to stop after two passes, got %v", err)
+	}
+
+	film, err := ReadCheckpoint(&checkpoint, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if progress := film.progress(); progress != 10 {
+		t.Errorf("Expected the checkpoint to hold 10 samples of the unconverged pixels, got %d", progress)
+	}
+
+	if err := RenderProgressive(context.Background(), film, config.camera(), world, lightShapes, config, func(film *Film) error { return nil }, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	actual := film.Image()
+
+	for i, pixel := range expected.Image() {
+		if !identical(pixel, actual[i]) {
+			t.Fatalf("Pixel %d differs from the uninterrupted render: %v != %v", i, actual[i], pixel)
+		}
+	}
+
+	for _, aov := range config.aovs {
+		actual := film.Layer(aov)
+
+		for i, value := range expected.Layer(aov) {
+			if !identical(value, actual[i]) {
+				t.Fatalf("Pixel %d of %v differs from the uninterrupted render: %v != %v", i, aov, actual[i], value)
+			}
+		}
+	}
+}
+
+func TestCheckpointRejectsOtherSettings(t *testing.T) {
+	config := testProgressiveConfig()
+	config.scene = "cornell-box"
+
+	filename := filepath.Join(t.TempDir(), "render.checkpoint")
+
+	if err := SaveCheckpoint(filename, NewFilm(config.width, config.height, nil), config); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadCheckpoint(filename, config); err != nil {
+		t.Errorf("Expected the checkpoint to load, got %v", err)
+	}
+
+	// The sample count may be raised when resuming.
+	config.samples *= 2
+
+	if _, err := LoadCheckpoint(filename, config); err != nil {
+		t.Errorf("Expected the checkpoint to load with more samples, got %v", err)
+	}
+
+	for _, change := range []func(config *Config){
+		func(config *Config) { config.seed++ },
+		func(config *Config) { config.scene = "cornell-smoke" },
+		func(config *Config) { config.width++ },
+		func(config *Config) { config.aovs = []AOV{AOVDepth} },
+	} {
+		changed := config
+		change(&changed)
+
+		if _, err := LoadCheckpoint(filename, changed); err == nil {
+			t.Errorf("Expected a checkpoint from other settings to be rejected")
+		}
+	}
+
+	if _, err := ReadCheckpoint(bytes.NewReader([]byte("not a checkpoint")), config); err == nil {
+		t.Errorf("Expected garbage to be rejected")
+	}
+}
+
+func TestCheckpointHashesSceneFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	writeTestFile(t, dir, "model.obj", "mtllib model.mtl\nv 0 0 0\nv 1 0 0\nv 0 1 0\nusemtl red\nf 1 2 3\n")
+	writeTestFile(t, dir, "model.mtl", "newmtl red\nKd 0.8 0.1 0.1\n")
+	mask := writeTestFile(t, dir, "mask.png", "round")
+	scene := writeTestFile(t, dir, "scene.json", `{"shapes": [{"type": "obj", "file": "model.obj"}]}`)
+
+	hash := func() uint64 {
+		loaded, err := LoadScene(scene, Config{}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		loaded.config.apertureMask = mask
+
+		return checkpointHash(loaded.config)
+	}
+
+	before := hash()
+
+	// Editing a file the scene reads, or the aperture mask, makes it another scene.
+	writeTestFile(t, dir, "model.mtl", "newmtl red\nKd 0.1 0.1 0.8\n")
+
+	edited := hash()
+
+	if edited == before {
+		t.Errorf("Expected editing the MTL file to change the hash")
+	}
+
+	writeTestFile(t, dir, "mask.png", "hexagonal")
+
+	if hash() == edited {
+		t.Errorf("Expected editing the aperture mask to change the hash")
+	}
+}
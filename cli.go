@@ -0,0 +1,720 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultConfig holds the settings used when neither the scene nor a flag sets them.
+var DefaultConfig = Config{
+	width:     500,
+	height:    500,
+	samples:   1000,
+	filename:  "output.png",
+	timeStart: 0,
+	timeEnd:   1,
+
+	fps:          24,
+	shutterAngle: 180,
+
+	minSamples: 16,
+	whitePoint: 4,
+	progress:   true,
+
+	exrPixelType:   EXRHalf,
+	exrCompression: EXRZIPCompression,
+}
+
+// vec3Flag parses "x,y,z" command-line values.
+type vec3Flag struct {
+	value *Vec3
+}
+
+func (f vec3Flag) String() string {
+	if f.value == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%g,%g,%g", f.value.x(), f.value.y(), f.value.z())
+}
+
+func (f vec3Flag) Set(s string) error {
+	e, err := parseFloats(s, 3)
+	if err != nil {
+		return err
+	}
+
+	*f.value = Vec3{e[0], e[1], e[2]}
+
+	return nil
+}
+
+// intervalFlag parses "start,end" command-line values.
+type intervalFlag struct {
+	start *float64
+	end   *float64
+}
+
+func (f intervalFlag) String() string {
+	if f.start == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%g,%g", *f.start, *f.end)
+}
+
+func (f intervalFlag) Set(s string) error {
+	e, err := parseFloats(s, 2)
+	if err != nil {
+		return err
+	}
+
+	if e[0] > e[1] {
+		return errors.New("start must not be after end")
+	}
+
+	*f.start, *f.end = e[0], e[1]
+
+	return nil
+}
+
+// parseFrames parses "first..last", or a single frame number.
+func parseFrames(s string) (int, int, error) {
+	parts := strings.Split(s, "..")
+
+	if len(parts) > 2 {
+		return 0, 0, fmt.Errorf("expected first..last, got %q", s)
+	}
+
+	var frames []int
+
+	for _, part := range parts {
+		frame, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return 0, 0, fmt.Errorf("%q is not a frame number", part)
+		}
+
+		frames = append(frames, frame)
+	}
+
+	return frames[0], frames[len(frames)-1], nil
+}
+
+func parseFloats(s string, count int) ([]float64, error) {
+	parts := strings.Split(s, ",")
+
+	if len(parts) != count {
+		return nil, fmt.Errorf("expected %d comma separated numbers", count)
+	}
+
+	floats := make([]float64, count)
+
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", part)
+		}
+
+		floats[i] = f
+	}
+
+	return floats, nil
+}
+
+// errFlagsReported is returned for flags that could not be parsed, which have already
+// been reported to the output along with the usage.
+var errFlagsReported = errors.New("invalid flags")
+
+// ParseCommandLine turns the arguments into a Scene ready to render. Settings come
+// from DefaultConfig, then the scene, then any flags given explicitly.
+func ParseCommandLine(args []string, output io.Writer) (Scene, error) {
+	flags := flag.NewFlagSet("raytracer", flag.ContinueOnError)
+	flags.SetOutput(output)
+
+	flags.Usage = func() {
+		fmt.Fprintf(output, "Usage: raytracer [flags]\n       raytracer list-scenes\n\nFlags:\n")
+		flags.PrintDefaults()
+	}
+
+	overrides := DefaultConfig
+
+	flags.IntVar(&overrides.width, "width", overrides.width, "image width in pixels")
+	flags.IntVar(&overrides.height, "height", overrides.height, "image height in pixels")
+	flags.IntVar(&overrides.samples, "samples", overrides.samples, "samples per pixel, or the most taken when adaptive")
+	flags.Float64Var(&overrides.adaptiveThreshold, "adaptive-threshold", overrides.adaptiveThreshold, "stop sampling pixels whose relative error is below this, zero to always take every sample")
+	flags.IntVar(&overrides.minSamples, "min-samples", overrides.minSamples, "samples taken of every pixel, and between error checks, when adaptive")
+	flags.IntVar(&overrides.passSamples, "pass-samples", overrides.passSamples, "render progressively in passes of this many samples per pixel, saving the image between passes")
+	flags.DurationVar(&overrides.snapshotInterval, "snapshot-interval", overrides.snapshotInterval, "least time between saving progressive passes, zero to save every pass")
+	flags.DurationVar(&overrides.timeLimit, "time-limit", overrides.timeLimit, "stop a progressive render after this long, zero for no limit")
+	flags.StringVar(&overrides.checkpoint, "checkpoint", overrides.checkpoint, "save a checkpoint of a progressive render to this path along with each image")
+	flags.BoolVar(&overrides.resume, "resume", overrides.resume, "continue the render saved in the -checkpoint file")
+	flags.BoolVar(&overrides.progress, "progress", overrides.progress, "show a progress bar when standard error is a terminal")
+	flags.Func("sampler", "how samples are spread over each pixel, the lens, time and bounces, one of independent, stratified, halton, sobol or cmj (default independent)", func(s string) (err error) {
+		overrides.sampler, err = ParseSamplerType(s)
+
+		return err
+	})
+	flags.Func("filter", "pixel reconstruction filter, one of box, tent, gaussian, mitchell or lanczos (default box)", func(s string) (err error) {
+		overrides.filter, err = ParseFilter(s)
+
+		return err
+	})
+	flags.Float64Var(&overrides.filterRadius, "filter-radius", overrides.filterRadius, "reconstruction filter radius in pixels, defaults to 0.5 for box, 1 for tent, 1.5 for gaussian, 2 for mitchell and 3 for lanczos")
+	flags.StringVar(&overrides.filename, "o", overrides.filename, "output image path, ending in .png, .exr, .hdr or .pfm")
+	flags.Float64Var(&overrides.exposure, "exposure", overrides.exposure, "exposure adjustment in stops for PNG output")
+	flags.Func("tonemap", "tone-map operator for PNG output, one of clamp, reinhard, extended-reinhard, aces or hable (default clamp)", func(s string) (err error) {
+		overrides.toneMap, err = ParseToneMap(s)
+
+		return err
+	})
+	flags.Float64Var(&overrides.whitePoint, "white-point", overrides.whitePoint, "luminance mapped to white by the extended-reinhard tone map")
+	flags.Func("dither", "dithering for PNG output, one of none, ordered or blue-noise (default none)", func(s string) (err error) {
+		overrides.dither, err = ParseDither(s)
+
+		return err
+	})
+	flags.Func("aov", "comma separated AOVs to write besides the image, from depth, normal, albedo, object-id, material-id, uv, direct and indirect, or all", func(s string) (err error) {
+		overrides.aovs, err = ParseAOVs(s)
+
+		return err
+	})
+	flags.Func("exr-type", "EXR pixel type, half or float (default half)", func(s string) (err error) {
+		overrides.exrPixelType, err = ParseEXRPixelType(s)
+
+		return err
+	})
+	flags.Func("exr-compression", "EXR compression, none or zip (default zip)", func(s string) (err error) {
+		overrides.exrCompression, err = ParseEXRCompression(s)
+
+		return err
+	})
+	flags.Var(vec3Flag{&overrides.from}, "from", "camera position as x,y,z")
+	flags.Var(vec3Flag{&overrides.at}, "at", "camera look-at point as x,y,z")
+	flags.Var(vec3Flag{&overrides.up}, "up", "camera up direction as x,y,z")
+	flags.Float64Var(&overrides.fov, "fov", overrides.fov, "vertical field of view in degrees, or across the image circle of a fisheye")
+	flags.Func("projection", "camera projection, one of perspective, orthographic, fisheye or equirectangular (default perspective)", func(s string) (err error) {
+		overrides.projection, err = ParseProjection(s)
+
+		return err
+	})
+	flags.Float64Var(&overrides.orthoHeight, "ortho-height", overrides.orthoHeight, "height of the orthographic view in scene units, zero to frame what -fov would at the focus distance")
+	flags.IntVar(&overrides.blades, "blades", overrides.blades, "aperture blades, at least 3 for a polygonal aperture or 0 for a round one")
+	flags.Float64Var(&overrides.bladeRotation, "blade-rotation", overrides.bladeRotation, "rotation of a polygonal or masked aperture in degrees")
+	flags.StringVar(&overrides.apertureMask, "aperture-mask", overrides.apertureMask, "image whose brightness shapes the aperture, and so the bokeh")
+	flags.Float64Var(&overrides.catsEye, "cats-eye", overrides.catsEye, "how far the lens barrel clips the aperture at the corners, in aperture radii, zero for none")
+	flags.Float64Var(&overrides.tilt, "tilt", overrides.tilt, "tilt of the focal plane in degrees, positive to bring its top nearer")
+	flags.Float64Var(&overrides.tiltRotation, "tilt-rotation", overrides.tiltRotation, "angle in degrees from horizontal of the axis the focal plane tilts about")
+	flags.Func("lens-shift", "shift the image as x,y in image widths and heights, as a shift lens does", func(s string) error {
+		e, err := parseFloats(s, 2)
+		if err != nil {
+			return err
+		}
+
+		overrides.shiftX, overrides.shiftY = e[0], e[1]
+
+		return nil
+	})
+	flags.Float64Var(&overrides.squeeze, "squeeze", overrides.squeeze, "anamorphic squeeze, narrowing the aperture to give tall bokeh, zero or 1 for none")
+	flags.Func("stereo", "render both eyes packed into the image, one of none, side-by-side or top-bottom (default none)", func(s string) (err error) {
+		overrides.stereo, err = ParseStereoLayout(s)
+
+		return err
+	})
+	flags.Float64Var(&overrides.eyeSeparation, "eye-separation", overrides.eyeSeparation, "distance between the eyes of a stereo camera in scene units, zero for a thirtieth of the focus distance")
+	flags.Func("convergence", "how stereo eyes converge, off-axis or toe-in (default off-axis)", func(s string) (err error) {
+		overrides.convergence, err = ParseConvergence(s)
+
+		return err
+	})
+	flags.Float64Var(&overrides.convergenceDistance, "convergence-distance", overrides.convergenceDistance, "distance at which stereo eyes converge, zero for the focus distance")
+	flags.Float64Var(&overrides.aperture, "aperture", overrides.aperture, "lens aperture diameter")
+	flags.Float64Var(&overrides.focus, "focus", overrides.focus, "focus distance, defaults to the distance from the camera to the look-at point")
+	flags.Var(intervalFlag{&overrides.timeStart, &overrides.timeEnd}, "shutter", "shutter open and close times as start,end")
+	flags.Func("shutter-curve", "how far open the shutter is over the interval: box, triangle, or time:openness pairs from 0 to 1 like 0:0,0.2:1,0.8:1,1:0 (default box)", func(s string) (err error) {
+		overrides.shutterCurve, err = ParseShutterCurve(s)
+
+		return err
+	})
+	flags.Float64Var(&overrides.rollingShutter, "rolling-shutter", overrides.rollingShutter, "fraction of the shutter interval a rolling shutter takes to sweep from the top row to the bottom, zero for a global shutter")
+	flags.Func("frames", "render the frames first..last, or one frame, of an animation to numbered images, replacing the run of # in -o or adding the number before the extension", func(s string) (err error) {
+		overrides.frameStart, overrides.frameEnd, err = parseFrames(s)
+
+		return err
+	})
+	flags.Float64Var(&overrides.fps, "fps", overrides.fps, "frames per second of an animation")
+	flags.Float64Var(&overrides.shutterAngle, "shutter-angle", overrides.shutterAngle, "how long the shutter is open each frame, in degrees of the 360 a frame lasts")
+	flags.Var(cropFlag{&overrides.crop, false}, "crop", "render only the pixels x0,y0 to x1,y1, measured from the top left")
+	flags.Var(cropFlag{&overrides.crop, true}, "crop-window", "render only x0,y0 to x1,y1 given as fractions of the image size")
+	flags.StringVar(&overrides.cropBase, "crop-base", overrides.cropBase, "write the whole frame, taking pixels outside the crop from this PNG or PFM image")
+	flags.IntVar(&overrides.threads, "threads", overrides.threads, "render threads, defaults to one per CPU")
+	flags.Int64Var(&overrides.seed, "seed", overrides.seed, "random seed")
+
+	sceneName := flags.String("scene", "cornell-box", "built-in scene to render, see list-scenes")
+	sceneFile := flags.String("scene-file", "", "JSON scene file to render instead of a built-in scene")
+
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return Scene{}, err
+	} else if err != nil {
+		return Scene{}, errFlagsReported
+	}
+
+	if flags.NArg() > 0 {
+		flags.Usage()
+
+		return Scene{}, fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+
+	explicit := make(map[string]bool)
+
+	flags.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	if explicit["scene"] && explicit["scene-file"] {
+		return Scene{}, errors.New("-scene and -scene-file cannot be used together")
+	}
+
+	if explicit["crop"] && explicit["crop-window"] {
+		return Scene{}, errors.New("-crop and -crop-window cannot be used together")
+	}
+
+	if explicit["shutter"] && explicit["frames"] {
+		return Scene{}, errors.New("-shutter and -frames cannot be used together, the frames take their shutter intervals from -fps and -shutter-angle")
+	}
+
+	// Scenes are built knowing the render settings, such as the seed and shutter interval.
+	override := func(config Config) Config {
+		return applyOverrides(config, overrides, explicit)
+	}
+
+	// finish changes the settings once the scene's own have been read, such as to
+	// those of one frame of an animation.
+	load := func(finish func(Config) Config) (Scene, error) {
+		config := override(DefaultConfig)
+
+		settings := func(config Config) Config {
+			return finish(override(config))
+		}
+
+		if *sceneFile != "" {
+			return LoadScene(*sceneFile, config, settings)
+		}
+
+		builtin, found := FindBuiltinScene(*sceneName)
+
+		if !found {
+			return Scene{}, fmt.Errorf("unknown scene %q, see list-scenes", *sceneName)
+		}
+
+		return builtin.load(config, settings)
+	}
+
+	scene, err := load(func(config Config) Config { return config })
+	if err != nil {
+		return Scene{}, err
+	}
+
+	if err := validateConfig(scene.config); err != nil {
+		return Scene{}, err
+	}
+
+	// Each frame poses the camera anew, which might take it somewhere it cannot be.
+	for _, frame := range scene.config.frames() {
+		if err := validateConfig(frame); err != nil {
+			return Scene{}, fmt.Errorf("frame %v: %v", frame.filename, err)
+		}
+	}
+
+	if scene.config.apertureMask != "" {
+		mask, err := LoadApertureMask(scene.config.apertureMask)
+		if err != nil {
+			return Scene{}, err
+		}
+
+		scene.config.mask = mask
+	}
+
+	// An animation builds the scene again for each frame, with the frame's shutter
+	// interval and camera, so that moving shapes are bounded over the frame and lights
+	// are sampled where they are during it.
+	if scene.config.sequence {
+		mask := scene.config.mask
+
+		scene.frame = func(n int) (Scene, error) {
+			frame, err := load(func(config Config) Config {
+				return config.frame(n)
+			})
+
+			frame.config.mask = mask
+
+			return frame, err
+		}
+	} else {
+		scene.config = scene.config.frames()[0]
+	}
+
+	return scene, nil
+}
+
+// applyOverrides copies the settings of explicitly given flags from overrides into config.
+func applyOverrides(config, overrides Config, explicit map[string]bool) Config {
+	if explicit["width"] {
+		config.width = overrides.width
+	}
+
+	if explicit["height"] {
+		config.height = overrides.height
+	}
+
+	if explicit["samples"] {
+		config.samples = overrides.samples
+	}
+
+	if explicit["adaptive-threshold"] {
+		config.adaptiveThreshold = overrides.adaptiveThreshold
+	}
+
+	if explicit["min-samples"] {
+		config.minSamples = overrides.minSamples
+	}
+
+	if explicit["pass-samples"] {
+		config.passSamples = overrides.passSamples
+	}
+
+	if explicit["snapshot-interval"] {
+		config.snapshotInterval = overrides.snapshotInterval
+	}
+
+	if explicit["time-limit"] {
+		config.timeLimit = overrides.timeLimit
+	}
+
+	if explicit["checkpoint"] {
+		config.checkpoint = overrides.checkpoint
+	}
+
+	if explicit["resume"] {
+		config.resume = overrides.resume
+	}
+
+	if explicit["progress"] {
+		config.progress = overrides.progress
+	}
+
+	if explicit["sampler"] {
+		config.sampler = overrides.sampler
+	}
+
+	if explicit["filter"] {
+		config.filter = overrides.filter
+	}
+
+	if explicit["filter-radius"] {
+		config.filterRadius = overrides.filterRadius
+	}
+
+	if explicit["o"] {
+		config.filename = overrides.filename
+	}
+
+	if explicit["exposure"] {
+		config.exposure = overrides.exposure
+	}
+
+	if explicit["tonemap"] {
+		config.toneMap = overrides.toneMap
+	}
+
+	if explicit["white-point"] {
+		config.whitePoint = overrides.whitePoint
+	}
+
+	if explicit["dither"] {
+		config.dither = overrides.dither
+	}
+
+	if explicit["aov"] {
+		config.aovs = overrides.aovs
+	}
+
+	if explicit["exr-type"] {
+		config.exrPixelType = overrides.exrPixelType
+	}
+
+	if explicit["exr-compression"] {
+		config.exrCompression = overrides.exrCompression
+	}
+
+	if explicit["from"] {
+		config.from = overrides.from
+		config.cameraAnimation.from = nil
+	}
+
+	if explicit["at"] {
+		config.at = overrides.at
+		config.cameraAnimation.at = nil
+	}
+
+	if explicit["up"] {
+		config.up = overrides.up
+		config.cameraAnimation.up = nil
+	}
+
+	if explicit["fov"] {
+		config.fov = overrides.fov
+		config.cameraAnimation.fov = nil
+	}
+
+	if explicit["projection"] {
+		config.projection = overrides.projection
+	}
+
+	if explicit["ortho-height"] {
+		config.orthoHeight = overrides.orthoHeight
+	}
+
+	if explicit["blades"] {
+		config.blades = overrides.blades
+	}
+
+	if explicit["blade-rotation"] {
+		config.bladeRotation = overrides.bladeRotation
+	}
+
+	if explicit["aperture-mask"] {
+		config.apertureMask = overrides.apertureMask
+	}
+
+	if explicit["cats-eye"] {
+		config.catsEye = overrides.catsEye
+	}
+
+	if explicit["tilt"] {
+		config.tilt = overrides.tilt
+	}
+
+	if explicit["tilt-rotation"] {
+		config.tiltRotation = overrides.tiltRotation
+	}
+
+	if explicit["lens-shift"] {
+		config.shiftX, config.shiftY = overrides.shiftX, overrides.shiftY
+	}
+
+	if explicit["squeeze"] {
+		config.squeeze = overrides.squeeze
+	}
+
+	if explicit["stereo"] {
+		config.stereo = overrides.stereo
+	}
+
+	if explicit["eye-separation"] {
+		config.eyeSeparation = overrides.eyeSeparation
+	}
+
+	if explicit["convergence"] {
+		config.convergence = overrides.convergence
+	}
+
+	if explicit["convergence-distance"] {
+		config.convergenceDistance = overrides.convergenceDistance
+	}
+
+	if explicit["aperture"] {
+		config.aperture = overrides.aperture
+		config.cameraAnimation.aperture = nil
+	}
+
+	if explicit["focus"] {
+		config.focus = overrides.focus
+		config.cameraAnimation.focus = nil
+	}
+
+	if explicit["shutter"] {
+		config.timeStart = overrides.timeStart
+		config.timeEnd = overrides.timeEnd
+	}
+
+	if explicit["shutter-curve"] {
+		config.shutterCurve = overrides.shutterCurve
+	}
+
+	if explicit["rolling-shutter"] {
+		config.rollingShutter = overrides.rollingShutter
+	}
+
+	if explicit["frames"] {
+		config.sequence = true
+		config.frameStart = overrides.frameStart
+		config.frameEnd = overrides.frameEnd
+	}
+
+	if explicit["fps"] {
+		config.fps = overrides.fps
+	}
+
+	if explicit["shutter-angle"] {
+		config.shutterAngle = overrides.shutterAngle
+	}
+
+	if explicit["crop"] || explicit["crop-window"] {
+		config.crop = overrides.crop
+	}
+
+	if explicit["crop-base"] {
+		config.cropBase = overrides.cropBase
+	}
+
+	if explicit["threads"] {
+		config.threads = overrides.threads
+	}
+
+	if explicit["seed"] {
+		config.seed = overrides.seed
+	}
+
+	return config
+}
+
+func validateConfig(config Config) error {
+	if config.width <= 0 || config.height <= 0 {
+		return fmt.Errorf("image size must be positive, got %dx%d", config.width, config.height)
+	}
+
+	if config.samples <= 0 {
+		return fmt.Errorf("samples must be positive, got %d", config.samples)
+	}
+
+	if config.adaptiveThreshold < 0 {
+		return fmt.Errorf("adaptive threshold must not be negative, got %g", config.adaptiveThreshold)
+	}
+
+	if config.adaptive() && (config.minSamples < 2 || config.minSamples > config.samples) {
+		return fmt.Errorf("min samples must be between 2 and samples when adaptive, got %d", config.minSamples)
+	}
+
+	if config.passSamples < 0 || config.snapshotInterval < 0 || config.timeLimit < 0 {
+		return errors.New("pass samples, snapshot interval and time limit must not be negative")
+	}
+
+	if config.timeLimit > 0 && config.passSamples == 0 {
+		return errors.New("a time limit needs a progressive render, set -pass-samples")
+	}
+
+	if config.checkpoint != "" && config.passSamples == 0 {
+		return errors.New("a checkpoint needs a progressive render, set -pass-samples")
+	}
+
+	if config.resume && config.checkpoint == "" {
+		return errors.New("-resume needs the -checkpoint to continue")
+	}
+
+	if config.filterRadius < 0 || config.filterRadius > tileSize {
+		return fmt.Errorf("filter radius must be between 0 and %d pixels, got %g", tileSize, config.filterRadius)
+	}
+
+	if maxFov := config.projection.maxFov(); config.fov <= 0 || config.fov >= maxFov {
+		return fmt.Errorf("fov must be between 0 and %g degrees for a %v camera, got %g", maxFov, config.projection, config.fov)
+	}
+
+	if config.orthoHeight < 0 {
+		return fmt.Errorf("orthographic height must not be negative, got %g", config.orthoHeight)
+	}
+
+	if config.rollingShutter < 0 || config.rollingShutter > 1 {
+		return fmt.Errorf("rolling shutter must be between 0 and 1, got %g", config.rollingShutter)
+	}
+
+	if config.blades < 0 || config.blades > 0 && config.blades < 3 {
+		return fmt.Errorf("aperture blades must be 0 for a round aperture, or at least 3, got %d", config.blades)
+	}
+
+	if config.catsEye < 0 || config.squeeze < 0 {
+		return errors.New("cat's eye and squeeze must not be negative")
+	}
+
+	if math.Abs(config.tilt) >= 90 {
+		return fmt.Errorf("tilt must be less than 90 degrees either way, got %g", config.tilt)
+	}
+
+	if config.lensed() && config.projection != ProjectionPerspective {
+		return fmt.Errorf("aperture shapes, cat's eye, tilt, shift and squeeze need a perspective camera, not %v", config.projection)
+	}
+
+	if config.eyeSeparation < 0 || config.convergenceDistance < 0 {
+		return errors.New("eye separation and convergence distance must not be negative")
+	}
+
+	if config.stereo != StereoNone && config.projection == ProjectionOrthographic {
+		return errors.New("an orthographic camera has no depth to see in stereo")
+	}
+
+	if config.stereo == StereoSideBySide && config.width%2 != 0 || config.stereo == StereoTopBottom && config.height%2 != 0 {
+		return fmt.Errorf("a %v stereo image must split evenly between the eyes, got %dx%d", config.stereo, config.width, config.height)
+	}
+
+	if config.from == config.at {
+		return errors.New("the camera cannot look at its own position")
+	}
+
+	if config.aperture < 0 {
+		return fmt.Errorf("aperture must not be negative, got %g", config.aperture)
+	}
+
+	if config.sequence {
+		if config.frameStart > config.frameEnd {
+			return fmt.Errorf("frames must run from first to last, got %d..%d", config.frameStart, config.frameEnd)
+		}
+
+		if config.fps <= 0 || config.shutterAngle <= 0 || config.shutterAngle > 360 {
+			return fmt.Errorf("fps must be positive and the shutter angle between 0 and 360 degrees, got %g and %g", config.fps, config.shutterAngle)
+		}
+
+		if config.checkpoint != "" || config.cropBase != "" {
+			return errors.New("-checkpoint and -crop-base cannot be used with -frames")
+		}
+	}
+
+	if config.whitePoint <= 0 {
+		return fmt.Errorf("white point must be positive, got %g", config.whitePoint)
+	}
+
+	extension := strings.ToLower(filepath.Ext(config.filename))
+
+	if !containsString(imageExtensions, extension) {
+		return fmt.Errorf("unsupported output format %q, expected one of %s", extension, strings.Join(imageExtensions, ", "))
+	}
+
+	window := config.window()
+
+	if window.x0 < 0 || window.y0 < 0 || window.x1 > config.width || window.y1 > config.height || window.width() <= 0 || window.height() <= 0 {
+		return fmt.Errorf("crop window %d,%d to %d,%d is empty or outside the %dx%d image", window.x0, window.y0, window.x1, window.y1, config.width, config.height)
+	}
+
+	if config.cropBase != "" {
+		if config.crop == (CropWindow{}) {
+			return errors.New("-crop-base needs a -crop or -crop-window")
+		}
+
+		if (extension != ".png" && extension != ".pfm") || strings.ToLower(filepath.Ext(config.cropBase)) != extension {
+			return errors.New("a crop can only be merged into a base image of the output's format, .png or .pfm")
+		}
+	}
+
+	return nil
+}
+
+// ListScenes writes the names and descriptions of the built-in scenes.
+func ListScenes(output io.Writer) {
+	for _, scene := range BuiltinScenes {
+		fmt.Fprintf(output, "%-14s %s\n", scene.name, scene.description)
+	}
+}
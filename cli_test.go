@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParseCommandLineOverrides(t *testing.T) {
+	var output bytes.Buffer
+
+	scene, err := ParseCommandLine([]string{
+		"-scene", "cornell-smoke",
+		"-width", "64",
+		"-samples", "8",
+		"-fov", "30",
+		"-from", "1,2,3",
+		"-shutter", "0.25,0.5",
+		"-seed", "42",
+	}, &output)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := scene.config
+
+	if config.width != 64 || config.height != DefaultConfig.height || config.samples != 8 {
+		t.Errorf("Image settings not applied: %+v", config)
+	}
+
+	if config.fov != 30 || config.from != (Vec3{1, 2, 3}) || config.at != (Vec3{278, 278, 0}) {
+		t.Errorf("Camera overrides not applied over the scene camera: %+v", config)
+	}
+
+	if config.timeStart != 0.25 || config.timeEnd != 0.5 || config.seed != 42 {
+		t.Errorf("Shutter or seed not applied: %+v", config)
+	}
+
+	if scene.lightShapes == nil {
+		t.Errorf("Expected light shapes for cornell-smoke")
+	}
+}
+
+func TestParseCommandLineFrames(t *testing.T) {
+	var output bytes.Buffer
+
+	scene, err := ParseCommandLine([]string{"-frames", "2..4", "-fps", "25", "-shutter-angle", "90", "-o", "shot_###.exr"}, &output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frames := scene.config.frames()
+
+	if len(frames) != 3 {
+		t.Fatalf("Expected 3 frames, got %d", len(frames))
+	}
+
+	// Frame 3 starts 3/25 of a second in, its shutter open a quarter of the frame.
+	if frame := frames[1]; frame.filename != "shot_003.exr" || math.Abs(frame.timeStart-0.12) > 1e-12 || math.Abs(frame.timeEnd-0.13) > 1e-12 {
+		t.Errorf("Frame 3 writes %s over %v to %v", frame.filename, frame.timeStart, frame.timeEnd)
+	}
+
+	// Each frame builds the scene again for its own shutter interval.
+	frame, err := scene.frame(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config := frame.config; config.filename != "shot_003.exr" || math.Abs(config.timeStart-0.12) > 1e-12 || math.Abs(config.timeEnd-0.13) > 1e-12 || frame.world == nil {
+		t.Errorf("Frame 3 built for %v to %v", config.timeStart, config.timeEnd)
+	}
+}
+
+func TestParseCommandLineFramesWithDefaultOutput(t *testing.T) {
+	var output bytes.Buffer
+
+	scene, err := ParseCommandLine([]string{"-frames", "2..2"}, &output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame, err := scene.frame(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if frame.config.filename != "output_0002.png" {
+		t.Errorf("Frame 2 writes %s", frame.config.filename)
+	}
+}
+
+func TestParseCommandLineErrors(t *testing.T) {
+	tests := [][]string{
+		{"-scene", "missing"},
+		{"-from", "1,2"},
+		{"-shutter", "1,0"},
+		{"-samples", "0"},
+		{"-o", "output.jpg"},
+		{"-exr-type", "double"},
+		{"-filter", "sinc"},
+		{"-filter-radius", "-1"},
+		{"-projection", "cylindrical"},
+		{"-fov", "180"},
+		{"-projection", "fisheye", "-fov", "360"},
+		{"-projection", "orthographic", "-ortho-height", "-1"},
+		{"-stereo", "anaglyph"},
+		{"-stereo", "side-by-side", "-width", "101"},
+		{"-stereo", "top-bottom", "-projection", "orthographic"},
+		{"-convergence", "toe-out"},
+		{"-eye-separation", "-1"},
+		{"-rolling-shutter", "1.5"},
+		{"-shutter-curve", "0:1,0.5:1"},
+		{"-frames", "10..1"},
+		{"-frames", "1..x"},
+		{"-frames", "1..2", "-shutter", "0,1"},
+		{"-frames", "1..2", "-shutter-angle", "400"},
+		{"-frames", "1..2", "-fps", "0"},
+		{"-frames", "1..2", "-pass-samples", "1", "-checkpoint", "film.ckpt"},
+		{"-blades", "2"},
+		{"-tilt", "90"},
+		{"-squeeze", "-2"},
+		{"-lens-shift", "0.5"},
+		{"-blades", "6", "-projection", "fisheye"},
+		{"-aperture-mask", "missing.png"},
+		{"-width", "64", "-crop", "0,0,65,10"},
+		{"-crop", "10,10,10,20"},
+		{"-crop", "0.5,0,1,1"},
+		{"-crop", "0,0,8,8", "-crop-window", "0,0,0.5,0.5"},
+		{"-crop-window", "0,0,0.5,0.5", "-crop-base", "base.exr", "-o", "output.exr"},
+		{"-crop-base", "base.png"},
+		{"-scene", "simple", "-scene-file", "scenes/cornell_box.json"},
+		{"-scene", "earth"},
+		{"extra"},
+	}
+
+	for _, args := range tests {
+		var output bytes.Buffer
+
+		if _, err := ParseCommandLine(args, &output); err == nil {
+			t.Errorf("Expected an error for %v", args)
+		}
+	}
+}
+
+func TestParseCommandLineReportsFlagsOnce(t *testing.T) {
+	var output bytes.Buffer
+
+	_, err := ParseCommandLine([]string{"-width", "wide"}, &output)
+
+	if err != errFlagsReported {
+		t.Errorf("Expected the flags to be reported already, got %v", err)
+	}
+
+	if count := strings.Count(output.String(), "invalid value \"wide\""); count != 1 {
+		t.Errorf("Expected the bad flag reported once, got %d times in %q", count, output.String())
+	}
+}
+
+func TestListScenes(t *testing.T) {
+	var output bytes.Buffer
+
+	ListScenes(&output)
+
+	for _, scene := range BuiltinScenes {
+		if !strings.Contains(output.String(), scene.name) {
+			t.Errorf("Scene %q not listed", scene.name)
+		}
+	}
+}
@@ -1,41 +1,94 @@
 package main
 
-import (
-	"math"
-)
+import "math"
 
 // Color returns a color from a Ray.
-func Color(r Ray, hitable Hitable, lightShape Hitable, depth int) Vec3 {
-	didHit, hit := hitable.hit(r, 0.001, math.MaxFloat64)
+func Color(r Ray, hitable Hitable, lightShape Hitable, depth int, sampler PixelSampler) Vec3 {
+	color, _ := TracePath(r, hitable, lightShape, depth, sampler, nil)
 
-	if didHit {
-		didScatter, scatter := hit.material.scatter(r, *hit)
-		emitted := hit.material.emitted(r, *hit, hit.u, hit.v, hit.p)
+	return color
+}
 
-		if depth < 50 && didScatter {
-			if scatter.isSpecular {
-				return scatter.attenuation.multiply(
-					Color(scatter.specularRay, hitable, lightShape, depth+1),
-				)
-			}
+// TracePath returns a color from a Ray and the number of rays traced to find it,
+// filling in path for the AOVs unless it is nil. The path is followed in a loop
+// rather than by recursion so that every bounce can reuse the same Hit record. Each
+// bounce starts on its own block of the sampler's dimensions before its ray is traced,
+// with the first of them kept for media along the ray.
+func TracePath(r Ray, hitable Hitable, lightShape Hitable, depth int, sampler PixelSampler, path *PathRecord) (Vec3, int) {
+	var hit Hit
 
-			hitablePdf := HitablePdf{lightShape, hit.p}
-			pdf := NewMixturePdf(hitablePdf, scatter.pdf)
+	color := EmitBlack()
+	throughput := Vec3{1, 1, 1}
+	bounce := 0
+
+	for ; ; bounce++ {
+		dimension := cameraDimensions + bounce*bounceDimensions
+		sampler.skipTo(dimension)
+
+		if !hitable.hit(r, 0.001, math.MaxFloat64, &hit, sampler) {
+			break
+		}
+
+		sampler.skipTo(dimension + mediumDimensions)
+
+		if path != nil && bounce == 0 {
+			path.recordFirstHit(r, hit)
+		}
+
+		didScatter, scatter := hit.material.scatter(r, hit, sampler)
+		light := throughput.multiply(hit.material.emitted(r, hit, hit.u, hit.v, hit.p))
+
+		color.inPlaceAdd(light)
+
+		if path != nil {
+			path.addLight(bounce, light)
+		}
+
+		if depth+bounce >= 50 || !didScatter {
+			return color, bounce + 1
+		}
+
+		if scatter.isSpecular {
+			throughput = throughput.multiply(scatter.attenuation)
+			r = scatter.specularRay
+
+			continue
+		}
 
-			scattered := Ray{hit.p, pdf.generate(), r.time()}
-			pdfVal := pdf.value(scattered.direction())
+		var pdf Pdf = scatter.pdf
+
+		if hasLights(lightShape) {
+			hitablePdf := HitablePdf{lightShape, hit.p}
+			pdf = NewMixturePdf(hitablePdf, scatter.pdf)
+		}
 
-			addition := scatter.attenuation.multiplyScalar(
-				hit.material.scatteringPdf(r, *hit, scattered),
-			).multiply(Color(scattered, hitable, lightShape, depth+1)).divideScalar(pdfVal)
+		scattered := Ray{hit.p, pdf.generate(sampler), r.time()}
+		pdfVal := pdf.value(scattered.direction())
 
-			return emitted.add(addition)
+		if pdfVal <= 0 {
+			return color, bounce + 1
 		}
 
-		return emitted
+		throughput = throughput.multiply(scatter.attenuation.multiplyScalar(
+			hit.material.scatteringPdf(r, hit, scattered) / pdfVal,
+		))
+		r = scattered
+	}
+
+	return color, bounce + 1
+}
+
+// hasLights reports whether there are any shapes to sample light from.
+func hasLights(lightShape Hitable) bool {
+	if lightShape == nil {
+		return false
+	}
+
+	if list, ok := lightShape.(HitableList); ok {
+		return len(list) > 0
 	}
 
-	return EmitBlack()
+	return true
 }
 
 // EmitBlack emits the Color black.
@@ -1,5 +1,14 @@
 package main
 
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
 // Config holds settings for preparing the rendering engine.
 type Config struct {
 	width     int
@@ -10,15 +19,362 @@ type Config struct {
 	up        Vec3
 	fov       float64
 	aperture  float64
+	focus     float64
 	filename  string
 	timeStart float64
 	timeEnd   float64
+	threads   int
+	seed      int64
+
+	projection  Projection
+	orthoHeight float64
+
+	shutterCurve   []ShutterKey
+	rollingShutter float64
+
+	blades        int
+	bladeRotation float64
+	apertureMask  string
+	mask          *ApertureMask
+	catsEye       float64
+	tilt          float64
+	tiltRotation  float64
+	shiftX        float64
+	shiftY        float64
+	squeeze       float64
+
+	stereo              StereoLayout
+	eyeSeparation       float64
+	convergence         Convergence
+	convergenceDistance float64
+
+	cameraAnimation CameraAnimation
+
+	sequence     bool
+	frameStart   int
+	frameEnd     int
+	fps          float64
+	shutterAngle float64
+
+	minSamples        int
+	adaptiveThreshold float64
+
+	passSamples      int
+	snapshotInterval time.Duration
+	timeLimit        time.Duration
+
+	scene      string
+	checkpoint string
+	resume     bool
+	progress   bool
+
+	crop     CropWindow
+	cropBase string
+
+	sampler      SamplerType
+	filter       Filter
+	filterRadius float64
+
+	exposure   float64
+	toneMap    ToneMap
+	whitePoint float64
+	dither     Dither
+	aovs       []AOV
+
+	exrPixelType   EXRPixelType
+	exrCompression EXRCompression
 }
 
 func (c Config) aspectRatio() float64 {
+	switch c.stereo {
+	case StereoSideBySide:
+		return float64(c.width) / 2 / float64(c.height)
+	case StereoTopBottom:
+		return float64(c.width) / (float64(c.height) / 2)
+	}
+
 	return float64(c.width) / float64(c.height)
 }
 
+// focusDistance returns the configured focus distance, or the distance to the look-at point.
 func (c Config) focusDistance() float64 {
+	if c.focus > 0 {
+		return c.focus
+	}
+
 	return c.from.subtract(c.at).length()
 }
+
+// adaptive reports whether pixels stop sampling once their error is below the threshold.
+func (c Config) adaptive() bool {
+	return c.adaptiveThreshold > 0
+}
+
+// window returns the pixels to render, measured from the top left.
+func (c Config) window() Tile {
+	return c.crop.pixels(c.width, c.height)
+}
+
+// tiles returns the Tiles covering the window, with rows counted from the bottom as
+// the renderer does.
+func (c Config) tiles() []Tile {
+	window := c.window()
+
+	return Tile{window.x0, c.height - window.y1, window.x1, c.height - window.y0}.split()
+}
+
+// radius returns the reconstruction filter's radius in pixels, or its default.
+func (c Config) radius() float64 {
+	if c.filterRadius > 0 {
+		return c.filterRadius
+	}
+
+	return filterRadii[c.filter]
+}
+
+// splatting reports whether samples reach past their own pixel, which the default
+// box filter of half a pixel does not.
+func (c Config) splatting() bool {
+	return c.filter != FilterBox || c.radius() != 0.5
+}
+
+// film returns an empty Film for the window, with weights when splatting. Pixels near
+// the edges of a crop window miss the samples from outside it.
+func (c Config) film() *Film {
+	window := c.window()
+	film := NewFilm(window.width(), window.height(), c.aovs)
+
+	if c.splatting() {
+		film.weights = make([]float64, len(film.color))
+	}
+
+	return film
+}
+
+// workers returns the number of render workers, defaulting to one per CPU.
+func (c Config) workers() int {
+	if c.threads > 0 {
+		return c.threads
+	}
+
+	return runtime.NumCPU()
+}
+
+// orthographicHeight returns the height an orthographic camera frames, by default what
+// the field of view would frame at the focus distance.
+func (c Config) orthographicHeight() float64 {
+	if c.orthoHeight > 0 {
+		return c.orthoHeight
+	}
+
+	return 2 * math.Tan(c.fov*math.Pi/360) * c.focusDistance()
+}
+
+// shutter returns the camera's Shutter, open over the shutter interval.
+func (c Config) shutter() Shutter {
+	return NewShutter(c.timeStart, c.timeEnd, c.shutterCurve, c.rollingShutter)
+}
+
+// lens returns the Lens of a perspective camera, with its angles in radians.
+func (c Config) lens() Lens {
+	return Lens{
+		c.blades,
+		c.bladeRotation * math.Pi / 180,
+		c.mask,
+		c.catsEye,
+		c.tilt * math.Pi / 180,
+		c.tiltRotation * math.Pi / 180,
+		c.shiftX,
+		c.shiftY,
+		c.squeeze,
+	}
+}
+
+// lensed reports whether the config asks for more of the lens than a round aperture.
+func (c Config) lensed() bool {
+	return c.blades != 0 || c.apertureMask != "" || c.catsEye != 0 || c.tilt != 0 || c.shiftX != 0 || c.shiftY != 0 || c.squeeze != 0 && c.squeeze != 1
+}
+
+// interocular returns the distance between the eyes of a stereo camera, by default the
+// stereographers' rule of thumb of a thirtieth of the focus distance.
+func (c Config) interocular() float64 {
+	if c.eyeSeparation > 0 {
+		return c.eyeSeparation
+	}
+
+	return c.focusDistance() / 30
+}
+
+// zeroParallax returns the distance at which the eyes of a stereo camera converge.
+func (c Config) zeroParallax() float64 {
+	if c.convergenceDistance > 0 {
+		return c.convergenceDistance
+	}
+
+	return c.focusDistance()
+}
+
+// camera returns the Camera described by the config, with both eyes packed into the
+// image for stereo. An animated camera moves through its pose over the shutter interval.
+func (c Config) camera() Camera {
+	if c.cameraAnimation.animated() {
+		return AnimatedCamera{c.stillCamera(), func(time float64) Camera {
+			return c.posed(time).stillCamera()
+		}}
+	}
+
+	return c.stillCamera()
+}
+
+// stillCamera returns the Camera in the config's pose.
+func (c Config) stillCamera() Camera {
+	if c.stereo == StereoNone {
+		return c.eyeCamera(0)
+	}
+
+	return StereoCamera{c.eyeCamera(-1), c.eyeCamera(1), c.stereo}
+}
+
+// eyeCamera returns the Camera of the left eye for -1, the right eye for 1, or the
+// only one for 0. The eyes sit either side of the config's camera.
+func (c Config) eyeCamera(eye float64) Camera {
+	if c.projection == ProjectionEquirectangular {
+		if eye == 0 {
+			return NewEquirectangularCamera(c.from, c.at, c.up, c.shutter())
+		}
+
+		convergence := 0.0
+
+		if c.convergence == ConvergenceToeIn {
+			convergence = c.zeroParallax()
+		}
+
+		return NewOmniStereoCamera(c.from, c.at, c.up, eye*c.interocular()/2, convergence, c.shutter())
+	}
+
+	from := c.from
+	at := c.at
+
+	var shift Vec3
+
+	if eye != 0 {
+		shift = c.up.cross(c.from.subtract(c.at)).unitVector().multiplyScalar(eye * c.interocular() / 2)
+		from = from.add(shift)
+		at = at.add(shift)
+
+		if c.convergence == ConvergenceToeIn {
+			at = c.from.add(c.at.subtract(c.from).unitVector().multiplyScalar(c.zeroParallax()))
+		}
+	}
+
+	switch c.projection {
+	case ProjectionOrthographic:
+		return NewOrthographicCamera(from, at, c.up, c.orthographicHeight(), c.aspectRatio(), c.aperture, c.focusDistance(), c.shutter())
+	case ProjectionFisheye:
+		return NewFisheyeCamera(from, at, c.up, c.fov, c.aspectRatio(), c.shutter())
+	}
+
+	camera := NewPerspectiveCamera(
+		from,
+		at,
+		c.up,
+		c.fov,
+		c.aspectRatio(),
+		c.aperture,
+		c.focusDistance(),
+		c.shutter(),
+	).withLens(c.lens())
+
+	// Shifting the window back towards the center lines the eyes' windows up at the
+	// convergence distance.
+	if eye != 0 && c.convergence == ConvergenceOffAxis {
+		camera.lowerLeftCorner = camera.lowerLeftCorner.subtract(shift.multiplyScalar(c.focusDistance() / c.zeroParallax()))
+	}
+
+	return camera
+}
+
+// frameShutter returns the shutter interval of a frame of the sequence, opening as the
+// frame starts and staying open for the shutter angle's share of it.
+func (c Config) frameShutter(frame int) (float64, float64) {
+	open := float64(frame) / c.fps
+
+	return open, open + c.shutterAngle/360/c.fps
+}
+
+// posed returns the config with the camera animation evaluated at a time.
+func (c Config) posed(time float64) Config {
+	animation := c.cameraAnimation
+
+	if animation.from.animated() {
+		c.from = animation.from.at(time)
+	}
+
+	if animation.at.animated() {
+		c.at = animation.at.at(time)
+	}
+
+	if animation.up.animated() {
+		c.up = animation.up.at(time)
+	}
+
+	if animation.fov.animated() {
+		c.fov = animation.fov.number(time)
+	}
+
+	if animation.aperture.animated() {
+		c.aperture = animation.aperture.number(time)
+	}
+
+	if animation.focus.animated() {
+		c.focus = animation.focus.number(time)
+	}
+
+	return c
+}
+
+// frame returns the config for one frame of the sequence, with its shutter interval,
+// its numbered output and the camera posed halfway through the exposure. Each ray of
+// an animated camera is traced from where it is at the ray's time.
+func (c Config) frame(frame int) Config {
+	c.timeStart, c.timeEnd = c.frameShutter(frame)
+	c.filename = frameFilename(c.filename, frame)
+
+	return c.posed((c.timeStart + c.timeEnd) / 2)
+}
+
+// frames returns the config of each image to render: every frame of a sequence, or
+// the one image posed halfway through the shutter interval.
+func (c Config) frames() []Config {
+	if !c.sequence {
+		return []Config{c.posed((c.timeStart + c.timeEnd) / 2)}
+	}
+
+	var frames []Config
+
+	for frame := c.frameStart; frame <= c.frameEnd; frame++ {
+		frames = append(frames, c.frame(frame))
+	}
+
+	return frames
+}
+
+// frameFilename numbers a filename for a frame, replacing its last run of # with the
+// frame number padded to as many digits, or adding four digits before the extension.
+func frameFilename(filename string, frame int) string {
+	end := strings.LastIndex(filename, "#") + 1
+
+	if end == 0 {
+		extension := filepath.Ext(filename)
+
+		return fmt.Sprintf("%s_%04d%s", strings.TrimSuffix(filename, extension), frame, extension)
+	}
+
+	start := end
+
+	for start > 0 && filename[start-1] == '#' {
+		start--
+	}
+
+	return fmt.Sprintf("%s%0*d%s", filename[:start], end-start, frame, filename[end:])
+}
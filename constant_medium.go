@@ -1,9 +1,6 @@
 package main
 
-import (
-	"math"
-	"math/rand"
-)
+import "math"
 
 // ConstantMedium is a medium of constant density.
 type ConstantMedium struct {
@@ -23,13 +20,12 @@ func NewConstantMedium(hitable Hitable, density float64, texture Texture) Consta
 	}
 }
 
-func (cm ConstantMedium) hit(r Ray, tMin, tMax float64) (bool, *Hit) {
-	didHit1, hit1 := cm.hitable.hit(r, -math.MaxFloat64, math.MaxFloat64)
+func (cm ConstantMedium) hit(r Ray, tMin, tMax float64, record *Hit, sampler Sampler) bool {
+	// The boundary hits cannot go in record, which must be left alone on a miss.
+	var hit1, hit2 Hit
 
-	if didHit1 {
-		didHit2, hit2 := cm.hitable.hit(r, hit1.t+0.0001, math.MaxFloat64)
-
-		if didHit2 {
+	if cm.hitable.hit(r, -math.MaxFloat64, math.MaxFloat64, &hit1, sampler) {
+		if cm.hitable.hit(r, hit1.t+0.0001, math.MaxFloat64, &hit2, sampler) {
 			if hit1.t < tMin {
 				hit1.t = tMin
 			}
@@ -39,7 +35,7 @@ func (cm ConstantMedium) hit(r Ray, tMin, tMax float64) (bool, *Hit) {
 			}
 
 			if hit1.t >= hit2.t {
-				return false, nil
+				return false
 			}
 
 			if hit1.t < 0 {
@@ -47,7 +43,7 @@ func (cm ConstantMedium) hit(r Ray, tMin, tMax float64) (bool, *Hit) {
 			}
 
 			distanceInsideBoundary := (hit2.t - hit1.t) * r.direction().length()
-			hitDistance := -(1 / cm.density) * math.Log(rand.Float64())
+			hitDistance := -(1 / cm.density) * math.Log(sampler.Float64())
 
 			if hitDistance < distanceInsideBoundary {
 				t := hit1.t + hitDistance/r.direction().length()
@@ -56,21 +52,22 @@ func (cm ConstantMedium) hit(r Ray, tMin, tMax float64) (bool, *Hit) {
 				normal := Vec3{1, 0, 0}
 				material := cm.material
 
-				hit := Hit{
+				*record = Hit{
 					t,
 					hit1.u,
 					hit1.v,
 					p,
 					normal,
 					material,
+					0,
 				}
 
-				return true, &hit
+				return true
 			}
 		}
 	}
 
-	return false, nil
+	return false
 }
 
 func (cm ConstantMedium) boundingBox(t0, t1 float64) (bool, *AABB) {
@@ -81,6 +78,6 @@ func (cm ConstantMedium) pdfValue(o, direction Vec3) float64 {
 	return 0.0
 }
 
-func (cm ConstantMedium) random(o Vec3) Vec3 {
+func (cm ConstantMedium) random(o Vec3, sampler Sampler) Vec3 {
 	return Vec3{1, 0, 0}
 }
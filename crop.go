@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"os"
+)
+
+// CropWindow is the part of the image to render, from x0, y0 inclusive to x1, y1
+// exclusive, measured from the top left. A normalized window is in fractions of the
+// image size rather than pixels. The zero CropWindow is the whole image.
+type CropWindow struct {
+	x0         float64
+	y0         float64
+	x1         float64
+	y1         float64
+	normalized bool
+}
+
+// pixels returns the window in pixels of a width by height image, rounding fractions
+// up so that windows sharing an edge share no pixels.
+func (c CropWindow) pixels(width, height int) Tile {
+	if c == (CropWindow{}) {
+		return Tile{0, 0, width, height}
+	}
+
+	if !c.normalized {
+		return Tile{int(c.x0), int(c.y0), int(c.x1), int(c.y1)}
+	}
+
+	return Tile{
+		int(math.Ceil(c.x0 * float64(width))),
+		int(math.Ceil(c.y0 * float64(height))),
+		int(math.Ceil(c.x1 * float64(width))),
+		int(math.Ceil(c.y1 * float64(height))),
+	}
+}
+
+// cropFlag parses "x0,y0,x1,y1" command-line values.
+type cropFlag struct {
+	value      *CropWindow
+	normalized bool
+}
+
+func (f cropFlag) String() string {
+	if f.value == nil || *f.value == (CropWindow{}) {
+		return ""
+	}
+
+	return fmt.Sprintf("%g,%g,%g,%g", f.value.x0, f.value.y0, f.value.x1, f.value.y1)
+}
+
+func (f cropFlag) Set(s string) error {
+	e, err := parseFloats(s, 4)
+	if err != nil {
+		return err
+	}
+
+	if !f.normalized {
+		for _, value := range e {
+			if value != math.Floor(value) {
+				return fmt.Errorf("%g is not a whole pixel", value)
+			}
+		}
+	}
+
+	*f.value = CropWindow{e[0], e[1], e[2], e[3], f.normalized}
+
+	return nil
+}
+
+// mergeLayer writes the whole frame, taking the crop window from pixels and the rest
+// from the base image, a PNG or PFM the size of the frame. PNGs are tone mapped as a
+// whole frame, so that dithering lines up with the base.
+func mergeLayer(filename, base, extension string, pixels []Vec3, config Config) error {
+	file, err := os.Open(base)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	window := config.window()
+	frame := make([]Vec3, config.width*config.height)
+
+	for y := window.y0; y < window.y1; y++ {
+		copy(frame[y*config.width+window.x0:], pixels[(y-window.y0)*window.width():(y-window.y0+1)*window.width()])
+	}
+
+	switch extension {
+	case ".png":
+		decoded, err := png.Decode(file)
+		if err != nil {
+			return fmt.Errorf("%s: %v", base, err)
+		}
+
+		if err := checkBaseSize(base, decoded.Bounds().Dx(), decoded.Bounds().Dy(), config); err != nil {
+			return err
+		}
+
+		merged := image.NewNRGBA(image.Rect(0, 0, config.width, config.height))
+		rendered := image.Rect(window.x0, window.y0, window.x1, window.y1)
+
+		draw.Draw(merged, merged.Bounds(), decoded, decoded.Bounds().Min, draw.Src)
+		draw.Draw(merged, rendered, ToneMapImage(frame, config), rendered.Min, draw.Src)
+
+		return createImage(filename, func(w io.Writer) error {
+			return png.Encode(w, merged)
+		})
+	case ".pfm":
+		framebuffer, width, height, err := ReadPFM(file)
+		if err != nil {
+			return fmt.Errorf("%s: %v", base, err)
+		}
+
+		if err := checkBaseSize(base, width, height, config); err != nil {
+			return err
+		}
+
+		for y := window.y0; y < window.y1; y++ {
+			copy(framebuffer[y*width+window.x0:(y*width+window.x1)], frame[y*width+window.x0:])
+		}
+
+		return createImage(filename, func(w io.Writer) error {
+			return WritePFM(w, framebuffer, width, height)
+		})
+	}
+
+	return fmt.Errorf("cannot merge a crop window into %s images, only .png and .pfm", extension)
+}
+
+func checkBaseSize(base string, width, height int, config Config) error {
+	if width != config.width || height != config.height {
+		return fmt.Errorf("%s is %dx%d, expected the whole %dx%d frame", base, width, height, config.width, config.height)
+	}
+
+	return nil
+}
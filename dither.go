@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// Dither chooses the thresholds used when quantizing to 8 bits, which trade banding for noise.
+type Dither int
+
+// The supported dithering patterns.
+const (
+	DitherNone Dither = iota
+	DitherOrdered
+	DitherBlueNoise
+)
+
+var ditherNames = []string{"none", "ordered", "blue-noise"}
+
+// ParseDither parses the name of a dithering pattern.
+func ParseDither(s string) (Dither, error) {
+	for i, name := range ditherNames {
+		if name == s {
+			return Dither(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown dither %q, expected one of %v", s, ditherNames)
+}
+
+func (d Dither) String() string {
+	if d >= 0 && int(d) < len(ditherNames) {
+		return ditherNames[d]
+	}
+
+	return fmt.Sprintf("Dither(%d)", int(d))
+}
+
+const (
+	// bayerSize is the width and height of the ordered dithering matrix.
+	bayerSize = 8
+	// blueNoiseSize is the width and height of the tiled blue noise mask.
+	blueNoiseSize = 64
+)
+
+var (
+	bayerRanks = bayerMatrix(bayerSize)
+
+	blueNoiseOnce  sync.Once
+	blueNoiseRanks []int
+)
+
+// threshold returns the quantization threshold for pixel (i, j), in (0, 1).
+func (d Dither) threshold(i, j int) float64 {
+	switch d {
+	case DitherOrdered:
+		return (float64(bayerRanks[(j%bayerSize)*bayerSize+i%bayerSize]) + 0.5) / (bayerSize * bayerSize)
+	case DitherBlueNoise:
+		blueNoiseOnce.Do(func() {
+			blueNoiseRanks = voidAndCluster(blueNoiseSize, 1.5)
+		})
+
+		return (float64(blueNoiseRanks[(j%blueNoiseSize)*blueNoiseSize+i%blueNoiseSize]) + 0.5) / (blueNoiseSize * blueNoiseSize)
+	}
+
+	return 0.5
+}
+
+// bayerMatrix returns the ranks of the size by size Bayer matrix, built by recursively
+// interleaving the half size matrix. The size must be a power of two.
+func bayerMatrix(size int) []int {
+	if size == 1 {
+		return []int{0}
+	}
+
+	half := size / 2
+	previous := bayerMatrix(half)
+	ranks := make([]int, size*size)
+
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			quadrant := [4]int{0, 2, 3, 1}[(y/half)*2+x/half]
+
+			ranks[y*size+x] = 4*previous[(y%half)*half+x%half] + quadrant
+		}
+	}
+
+	return ranks
+}
+
+// voidAndCluster returns the ranks of a size by size tileable blue noise mask, built with
+// Ulichney's void-and-cluster method using a Gaussian filter of the given sigma.
+func voidAndCluster(size int, sigma float64) []int {
+	n := size * size
+
+	// The filter wraps around so that the mask tiles.
+	kernel := make([]float64, n)
+
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			dx := float64(minInt(x, size-x))
+			dy := float64(minInt(y, size-y))
+
+			kernel[y*size+x] = math.Exp(-(dx*dx + dy*dy) / (2 * sigma * sigma))
+		}
+	}
+
+	pattern := &voidAndClusterPattern{size, kernel, make([]bool, n), make([]float64, n)}
+	rng := NewRand(1)
+
+	// Start from a tenth of the pixels set at random.
+	for set := 0; set < n/10; {
+		if index := rng.Intn(n); !pattern.ones[index] {
+			pattern.toggle(index)
+			set++
+		}
+	}
+
+	// Move the tightest cluster into the largest void until that changes nothing.
+	for moves := 0; moves < n; moves++ {
+		cluster := pattern.tightestCluster()
+		pattern.toggle(cluster)
+
+		void := pattern.largestVoid()
+		pattern.toggle(void)
+
+		if void == cluster {
+			break
+		}
+	}
+
+	initial := pattern.copy()
+	ones := n / 10
+	ranks := make([]int, n)
+
+	// The initial pixels are ranked by removing the tightest clusters.
+	for rank := ones - 1; rank >= 0; rank-- {
+		cluster := pattern.tightestCluster()
+		pattern.toggle(cluster)
+		ranks[cluster] = rank
+	}
+
+	pattern = initial
+
+	// The rest are ranked by filling the largest voids.
+	for rank := ones; rank < n; rank++ {
+		void := pattern.largestVoid()
+		pattern.toggle(void)
+		ranks[void] = rank
+	}
+
+	return ranks
+}
+
+// voidAndClusterPattern is a binary pattern along with the filtered density of its set pixels.
+type voidAndClusterPattern struct {
+	size   int
+	kernel []float64
+	ones   []bool
+	energy []float64
+}
+
+func (p *voidAndClusterPattern) toggle(index int) {
+	sign := 1.0
+
+	if p.ones[index] {
+		sign = -1
+	}
+
+	p.ones[index] = !p.ones[index]
+
+	x0 := index % p.size
+	y0 := index / p.size
+
+	for y := 0; y < p.size; y++ {
+		row := ((y - y0 + p.size) % p.size) * p.size
+
+		for x := 0; x < p.size; x++ {
+			p.energy[y*p.size+x] += sign * p.kernel[row+(x-x0+p.size)%p.size]
+		}
+	}
+}
+
+// tightestCluster returns the set pixel with the most set pixels around it.
+func (p *voidAndClusterPattern) tightestCluster() int {
+	best := -1
+
+	for i, one := range p.ones {
+		if one && (best < 0 || p.energy[i] > p.energy[best]) {
+			best = i
+		}
+	}
+
+	return best
+}
+
+// largestVoid returns the unset pixel with the fewest set pixels around it.
+func (p *voidAndClusterPattern) largestVoid() int {
+	best := -1
+
+	for i, one := range p.ones {
+		if !one && (best < 0 || p.energy[i] < p.energy[best]) {
+			best = i
+		}
+	}
+
+	return best
+}
+
+func (p *voidAndClusterPattern) copy() *voidAndClusterPattern {
+	return &voidAndClusterPattern{
+		p.size,
+		p.kernel,
+		append([]bool(nil), p.ones...),
+		append([]float64(nil), p.energy...),
+	}
+}
@@ -1,56 +1,277 @@
 package main
 
 import (
-	"math/rand"
+	"context"
 	"sync"
+	"time"
 )
 
-var wg sync.WaitGroup
+// tileSize is the width and height in pixels of the tiles handed to workers.
+const tileSize = 16
 
-// Render takes the Camera, Hitables, and Config and outputs the framebuffer.
-func Render(camera Camera, world, lightShapes Hitable, config Config) []Vec3 {
-	framebuffer := make([]Vec3, 0)
+// Tile is a rectangular region of the image, x0 and y0 inclusive, x1 and y1 exclusive.
+type Tile struct {
+	x0 int
+	y0 int
+	x1 int
+	y1 int
+}
+
+// NewTiles splits a width by height image into Tiles of at most tileSize pixels square.
+func NewTiles(width, height int) []Tile {
+	return Tile{0, 0, width, height}.split()
+}
+
+func (t Tile) width() int {
+	return t.x1 - t.x0
+}
 
-	for j := config.height - 1; j >= 0; j-- {
-		for i := 0; i < config.width; i++ {
-			color := sampling(i, j, config, camera, world, lightShapes)
+func (t Tile) height() int {
+	return t.y1 - t.y0
+}
+
+// split splits the Tile into Tiles of at most tileSize pixels square.
+func (t Tile) split() []Tile {
+	var tiles []Tile
 
-			framebuffer = append(framebuffer, color)
+	for y := t.y0; y < t.y1; y += tileSize {
+		for x := t.x0; x < t.x1; x += tileSize {
+			tiles = append(tiles, Tile{
+				x,
+				y,
+				minInt(x+tileSize, t.x1),
+				minInt(y+tileSize, t.y1),
+			})
 		}
 	}
 
-	return framebuffer
+	return tiles
+}
+
+// Render takes the Camera, Hitables, and Config and outputs the Film.
+func Render(camera Camera, world, lightShapes Hitable, config Config) *Film {
+	film, _ := RenderContext(context.Background(), camera, world, lightShapes, config, nil)
+
+	return film
 }
 
-func sampling(i, j int, config Config, camera Camera, world, lightShapes Hitable) Vec3 {
-	color := Vec3Zero()
+// RenderContext renders like Render, calling progress after each Tile unless it is nil.
+// Once the context is done no more tiles are started, and it returns the Film as it is
+// once the tiles under way have finished, along with the context's error.
+func RenderContext(ctx context.Context, camera Camera, world, lightShapes Hitable, config Config, progress func(Progress)) (*Film, error) {
+	film := config.film()
+	tracker := newProgressTracker(film, config, progress)
+
+	_, err := renderPass(ctx, film, config.samples, config, camera, world, lightShapes, tracker)
+
+	return film, err
+}
+
+// RenderProgressive renders into the Film in passes of config.passSamples samples over
+// the whole image, handing it to snapshot after a pass once config.snapshotInterval has
+// passed since the last. It stops once every pixel has its samples or is below the
+// adaptive threshold, or after config.timeLimit, leaving the caller to save the Film.
+// Each pixel carries on from the samples it already has, and each sample is seeded the
+// same way as in Render, so a Film resumed from a checkpoint finishes the same image.
+// Progress and cancellation work as in RenderContext.
+func RenderProgressive(ctx context.Context, film *Film, camera Camera, world, lightShapes Hitable, config Config, snapshot func(film *Film) error, progress func(Progress)) error {
+	passCtx := ctx
+
+	if config.timeLimit > 0 {
+		var cancel context.CancelFunc
+
+		passCtx, cancel = context.WithTimeout(ctx, config.timeLimit)
+		defer cancel()
+	}
+
+	tracker := newProgressTracker(film, config, progress)
+	lastSnapshot := time.Now()
+
+	for {
+		end := minInt(film.progress()+config.passSamples, config.samples)
 
-	samples := make(chan Vec3, config.samples)
+		tracker.startPass()
+		remaining, err := renderPass(passCtx, film, end, config, camera, world, lightShapes, tracker)
+
+		if remaining == 0 && err == nil {
+			return nil
+		}
+
+		// Running out of time is a normal stop, unlike the caller cancelling.
+		if passCtx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if time.Since(lastSnapshot) >= config.snapshotInterval {
+			if err := snapshot(film); err != nil {
+				return err
+			}
+
+			lastSnapshot = time.Now()
+		}
+	}
+}
+
+// renderPass samples every pixel up to end samples, and returns how many pixels want
+// more. It stops starting tiles once the context is done, returning its error.
+func renderPass(ctx context.Context, film *Film, end int, config Config, camera Camera, world, lightShapes Hitable, tracker *progressTracker) (int, error) {
+	tiles := config.tiles()
+	indices := make(chan int)
+	results := make(chan tileResult)
+
+	var wg sync.WaitGroup
+
+	for w := 0; w < config.workers(); w++ {
+		sampler := NewSampler(config.sampler, config.seed, config.samples)
+
+		// Each worker reuses one PathRecord for the AOVs of all its samples.
+		var path *PathRecord
+
+		if len(config.aovs) > 0 {
+			path = &PathRecord{}
+		}
 
-	for s := 0; s < config.samples; s++ {
 		wg.Add(1)
-		go sample(i, j, config.width, config.height, camera, world, lightShapes, samples)
+
+		go func() {
+			defer wg.Done()
+
+			for index := range indices {
+				result := renderTile(tiles[index], film, end, config, camera, world, lightShapes, sampler, path)
+				result.index = index
+				results <- result
+			}
+		}()
 	}
 
+	splats := make([]*splatBuffer, len(tiles))
+	next := 0
+	remaining := 0
+	rendering := 0
+
+	// Results are collected here, so that progress is reported from one goroutine.
+	for next < len(tiles) || rendering > 0 {
+		var send chan int
+
+		if next < len(tiles) && ctx.Err() == nil {
+			send = indices
+		} else if rendering == 0 {
+			break
+		}
+
+		select {
+		case send <- next:
+			next++
+			rendering++
+		case result := <-results:
+			rendering--
+			remaining += result.remaining
+			splats[result.index] = result.splat
+			tracker.add(result)
+		}
+	}
+
+	close(indices)
 	wg.Wait()
-	close(samples)
 
-	for newColor := range samples {
-		color.inPlaceAdd(newColor)
+	// Splats are added in tile order, so that the sums do not depend on which worker
+	// finished first.
+	for _, splat := range splats {
+		if splat != nil {
+			film.splat(splat)
+		}
+	}
+
+	if next < len(tiles) {
+		return remaining, ctx.Err()
+	}
+
+	return remaining, nil
+}
+
+// renderTile samples every pixel of a Tile into the Film, or into a splatBuffer of the
+// result when splatting. The Film is stored top row first, while j counts rows from the
+// bottom. Pixels are seeded by their place in the whole image, so a crop window renders
+// the same as that part of the whole. The AOVs of each sample are recorded in path, unless
+// it is nil.
+func renderTile(tile Tile, film *Film, end int, config Config, camera Camera, world, lightShapes Hitable, sampler PixelSampler, path *PathRecord) tileResult {
+	var result tileResult
+
+	if config.splatting() {
+		window := config.window()
+		top := config.height - window.y0
+		region := Tile{tile.x0 - window.x0, top - tile.y1, tile.x1 - window.x0, top - tile.y0}
+
+		result.splat = newSplatBuffer(film, region, config.radius())
+	}
+
+	for j := tile.y0; j < tile.y1; j++ {
+		for i := tile.x0; i < tile.x1; i++ {
+			sampling(i, j, film, end, config, camera, world, lightShapes, sampler, path, &result)
+		}
+	}
+
+	return result
+}
+
+// sampling takes a pixel's samples up to end, adding what it did to the result.
+// Adaptively, after config.minSamples and every batch of as many again, it stops for
+// good once the pixel's error is below the threshold.
+func sampling(i, j int, film *Film, end int, config Config, camera Camera, world, lightShapes Hitable, sampler PixelSampler, path *PathRecord, result *tileResult) {
+	window := config.window()
+	pixelIndex := j*config.width + i
+	filmIndex := (config.height-1-j-window.y0)*window.width() + i - window.x0
+
+	if film.converged[filmIndex] {
+		return
 	}
 
-	color.inPlaceDivideScalar(float64(config.samples))
+	for s := film.samples[filmIndex]; s < end; s++ {
+		if config.adaptive() && s >= config.minSamples && s%config.minSamples == 0 &&
+			film.relativeError(filmIndex) <= config.adaptiveThreshold {
+			film.converged[filmIndex] = true
+			result.skipped += config.samples - s
+
+			return
+		}
+
+		sampler.startSample(pixelIndex, s)
+
+		if path != nil {
+			*path = PathRecord{}
+		}
+
+		u, v := Float64Pair(sampler)
+		x := float64(i) + u
+		y := float64(j) + v
+		color, rays := sample(x, y, config.width, config.height, camera, world, lightShapes, sampler, path)
+
+		film.addSample(filmIndex, s, color, path)
+
+		if result.splat != nil {
+			top := float64(config.height - window.y0)
+			result.splat.add(x-float64(window.x0), top-y, color, path, film.aovs, config.filter, config.radius())
+		}
 
-	return color
+		result.samples++
+		result.rays += rays
+	}
+
+	if end < config.samples {
+		result.remaining++
+	}
 }
 
-func sample(i, j, width, height int, camera Camera, world Hitable, lightShapes Hitable, samples chan Vec3) {
-	defer wg.Done()
+// sample traces a ray through x, y in pixels of the image, measured from the bottom left.
+func sample(x, y float64, width, height int, camera Camera, world Hitable, lightShapes Hitable, sampler PixelSampler, path *PathRecord) (Vec3, int) {
+	u := x / float64(width)
+	v := y / float64(height)
 
-	u := (float64(i) + rand.Float64()) / float64(width)
-	v := (float64(j) + rand.Float64()) / float64(height)
+	r, ok := camera.getRay(u, v, sampler)
 
-	r := camera.getRay(u, v)
+	if !ok {
+		return EmitBlack(), 0
+	}
 
-	samples <- Color(r, world, lightShapes, 0)
+	return TracePath(r, world, lightShapes, 0, sampler, path)
 }
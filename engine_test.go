@@ -0,0 +1,486 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewTilesCoversImage(t *testing.T) {
+	width := 37
+	height := 21
+
+	covered := make([]int, width*height)
+
+	for _, tile := range NewTiles(width, height) {
+		if tile.x1-tile.x0 > tileSize || tile.y1-tile.y0 > tileSize {
+			t.Errorf("Tile too large: %v", tile)
+		}
+
+		for j := tile.y0; j < tile.y1; j++ {
+			for i := tile.x0; i < tile.x1; i++ {
+				covered[j*width+i]++
+			}
+		}
+	}
+
+	for index, count := range covered {
+		if count != 1 {
+			t.Errorf("Pixel %d covered %d times", index, count)
+		}
+	}
+}
+
+// identical compares bit patterns so that NaNs compare equal to themselves.
+func identical(a, b Vec3) bool {
+	return math.Float64bits(a.e0) == math.Float64bits(b.e0) &&
+		math.Float64bits(a.e1) == math.Float64bits(b.e1) &&
+		math.Float64bits(a.e2) == math.Float64bits(b.e2)
+}
+
+func testRender(seed int64, threads int) []Vec3 {
+	config := Config{
+		width:     24,
+		height:    16,
+		samples:   4,
+		from:      Vec3{278, 278, -800},
+		at:        Vec3{278, 278, 0},
+		up:        Vec3{0, 1, 0},
+		fov:       40.0,
+		timeStart: 0,
+		timeEnd:   1,
+		threads:   threads,
+		seed:      seed,
+	}
+
+	world, lightShapes := CornellBox(config)
+
+	return Render(config.camera(), world, lightShapes, config).Image()
+}
+
+func TestRenderIsDeterministic(t *testing.T) {
+	expected := testRender(7, 1)
+
+	for _, threads := range []int{1, 3, 8} {
+		actual := testRender(7, threads)
+
+		for i := range expected {
+			if !identical(actual[i], expected[i]) {
+				t.Fatalf("Pixel %d differs with %d threads: %v != %v", i, threads, actual[i], expected[i])
+			}
+		}
+	}
+
+	different := testRender(8, 1)
+
+	for i := range expected {
+		if !identical(different[i], expected[i]) {
+			return
+		}
+	}
+
+	t.Errorf("Different seeds rendered identical images")
+}
+
+func TestRenderAOVs(t *testing.T) {
+	config := Config{
+		width:     8,
+		height:    8,
+		samples:   4,
+		from:      Vec3{278, 278, -800},
+		at:        Vec3{278, 278, 0},
+		up:        Vec3{0, 1, 0},
+		fov:       40.0,
+		timeStart: 0,
+		timeEnd:   1,
+		seed:      7,
+		aovs:      []AOV{AOVDepth, AOVNormal, AOVObjectID, AOVMaterialID, AOVDirect, AOVIndirect},
+	}
+
+	scene, _ := FindBuiltinScene("cornell-box")
+
+	loaded, err := scene.load(config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	film := Render(loaded.config.camera(), loaded.world, loaded.lightShapes, config)
+
+	image := film.Image()
+	depth := film.Layer(AOVDepth)
+	normal := film.Layer(AOVNormal)
+	objectID := film.Layer(AOVObjectID)
+	materials := film.Layer(AOVMaterialID)
+	direct := film.Layer(AOVDirect)
+	indirect := film.Layer(AOVIndirect)
+
+	for i := range image {
+		if depth[i].x() < 800 || math.IsInf(depth[i].x(), 1) {
+			t.Errorf("Pixel %d should see the box beyond the camera, got depth %v", i, depth[i])
+		}
+
+		if normal[i].length() > 1+1e-9 {
+			t.Errorf("Pixel %d has an average normal longer than one: %v", i, normal[i])
+		}
+
+		// Zero is the background, which some samples see past the edges of the box.
+		if id := objectID[i].x(); id < 0 || id > 9 || id != math.Floor(id) {
+			t.Errorf("Pixel %d has object ID %v", i, id)
+		}
+
+		if id := materials[i].x(); id < 0 || id != math.Floor(id) {
+			t.Errorf("Pixel %d has material ID %v", i, id)
+		}
+
+		if sum := direct[i].add(indirect[i]); sum.subtract(image[i]).length() > 1e-9*(1+image[i].length()) {
+			t.Errorf("Pixel %d direct %v and indirect %v do not add up to %v", i, direct[i], indirect[i], image[i])
+		}
+	}
+
+	// The back wall, ceiling and floor share the white material, unlike the red wall.
+	var white []Hit
+
+	for _, direction := range []Vec3{{0, 0, 1}, {0, 1, 0}, {0, -1, 0}, {-1, 0, 0}} {
+		var hit Hit
+
+		if !loaded.world.hit(Ray{Vec3{450, 450, 100}, direction, 0}, 0.001, math.MaxFloat64, &hit, nil) {
+			t.Fatalf("Expected to hit a wall looking along %v", direction)
+		}
+
+		white = append(white, hit)
+	}
+
+	red := white[3]
+	white = white[:3]
+
+	for _, hit := range white[1:] {
+		if materialID(hit.material) != materialID(white[0].material) || hit.objectID == white[0].objectID {
+			t.Errorf("Expected white walls to share material %d as different objects, got material %d on object %d and %d",
+				materialID(white[0].material), materialID(hit.material), white[0].objectID, hit.objectID)
+		}
+	}
+
+	if id := materialID(red.material); id == 0 || id == materialID(white[0].material) {
+		t.Errorf("Expected the red wall to have its own material, got %d", id)
+	}
+
+	if !identical(image[0], testRenderWithoutAOVs(config)[0]) {
+		t.Errorf("Asking for AOVs changed the image")
+	}
+}
+
+func testRenderWithoutAOVs(config Config) []Vec3 {
+	config.aovs = nil
+
+	scene, _ := FindBuiltinScene("cornell-box")
+	loaded, _ := scene.load(config, nil)
+
+	return Render(loaded.config.camera(), loaded.world, loaded.lightShapes, config).Image()
+}
+
+func TestAdaptiveSampling(t *testing.T) {
+	config := Config{
+		width:             8,
+		height:            8,
+		samples:           64,
+		minSamples:        8,
+		adaptiveThreshold: 0.2,
+		from:              Vec3{278, 278, -800},
+		at:                Vec3{278, 278, 0},
+		up:                Vec3{0, 1, 0},
+		fov:               40.0,
+		timeStart:         0,
+		timeEnd:           1,
+		seed:              7,
+		aovs:              []AOV{AOVSampleCount},
+	}
+
+	world, lightShapes := CornellBox(config)
+
+	var expected []Vec3
+
+	for _, threads := range []int{1, 4} {
+		config.threads = threads
+		counts := Render(config.camera(), world, lightShapes, config).Layer(AOVSampleCount)
+
+		fewer := false
+
+		for i, count := range counts {
+			n := int(count.x())
+
+			if n < config.minSamples || n > config.samples || (n%config.minSamples != 0 && n != config.samples) {
+				t.Errorf("Pixel %d took %d samples", i, n)
+			}
+
+			fewer = fewer || n < config.samples
+		}
+
+		if !fewer {
+			t.Errorf("Expected some pixels to stop early")
+		}
+
+		if expected == nil {
+			expected = counts
+		}
+
+		for i := range counts {
+			if counts[i] != expected[i] {
+				t.Fatalf("Sample counts differ with %d threads", threads)
+			}
+		}
+	}
+}
+
+func testProgressiveConfig() Config {
+	return Config{
+		width:       8,
+		height:      8,
+		samples:     8,
+		passSamples: 3,
+		from:        Vec3{278, 278, -800},
+		at:          Vec3{278, 278, 0},
+		up:          Vec3{0, 1, 0},
+		fov:         40.0,
+		timeStart:   0,
+		timeEnd:     1,
+		threads:     2,
+		seed:        7,
+	}
+}
+
+func TestRenderProgressiveMatchesRender(t *testing.T) {
+	config := testProgressiveConfig()
+	world, lightShapes := CornellBox(config)
+
+	var snapshots []int
+
+	film := NewFilm(config.width, config.height, config.aovs)
+
+	err := RenderProgressive(context.Background(), film, config.camera(), world, lightShapes, config, func(film *Film) error {
+		snapshots = append(snapshots, film.samples[0])
+
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Passes of 3, 3 and 2 samples, with no snapshot of the last.
+	if len(snapshots) != 2 || snapshots[0] != 3 || snapshots[1] != 6 {
+		t.Errorf("Expected snapshots after 3 and 6 samples, got %v", snapshots)
+	}
+
+	expected := Render(config.camera(), world, lightShapes, config).Image()
+
+	for i, pixel := range film.Image() {
+		if !identical(pixel, expected[i]) {
+			t.Fatalf("Pixel %d differs from Render: %v != %v", i, pixel, expected[i])
+		}
+	}
+}
+
+func TestRenderProgressiveStops(t *testing.T) {
+	config := testProgressiveConfig()
+	config.samples = 1 << 20
+	config.passSamples = 1
+	config.timeLimit = 50 * time.Millisecond
+
+	world, lightShapes := CornellBox(config)
+	started := time.Now()
+
+	film := NewFilm(config.width, config.height, config.aovs)
+
+	err := RenderProgressive(context.Background(), film, config.camera(), world, lightShapes, config, func(film *Film) error {
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("Expected the time limit to stop the render, took %v", elapsed)
+	}
+
+	if film.samples[0] == 0 || film.samples[0] == config.samples {
+		t.Errorf("Expected the time limit to leave some samples, got %d", film.samples[0])
+	}
+
+	config = testProgressiveConfig()
+	config.samples = 4096
+	config.minSamples = 8
+	config.passSamples = 8
+	config.adaptiveThreshold = 1
+
+	passes := 0
+
+	film = NewFilm(config.width, config.height, config.aovs)
+
+	err = RenderProgressive(context.Background(), film, config.camera(), world, lightShapes, config, func(film *Film) error {
+		passes++
+
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, n := range film.samples {
+		if n == config.samples {
+			t.Fatalf("Pixel %d took every sample despite converging", i)
+		}
+	}
+
+	if passes >= config.samples/config.passSamples-1 {
+		t.Errorf("Expected the render to stop once every pixel converged, took %d passes", passes)
+	}
+}
+
+func TestRenderContextReportsProgress(t *testing.T) {
+	config := testProgressiveConfig()
+	config.width = 40
+	config.height = 20
+
+	world, lightShapes := CornellBox(config)
+
+	var reports []Progress
+
+	film, err := RenderContext(context.Background(), config.camera(), world, lightShapes, config, func(p Progress) {
+		reports = append(reports, p)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reports) != 6 {
+		t.Fatalf("Expected a report for each of 6 tiles, got %d", len(reports))
+	}
+
+	for i, p := range reports {
+		if p.tilesDone != i+1 || p.tiles != 6 || p.samples != 40*20*config.samples {
+			t.Errorf("Unexpected report %+v", p)
+		}
+
+		if i > 0 && (p.samplesDone <= reports[i-1].samplesDone || p.rays <= reports[i-1].rays) {
+			t.Errorf("Expected samples and rays to grow, got %+v after %+v", p, reports[i-1])
+		}
+	}
+
+	last := reports[len(reports)-1]
+
+	if last.samplesDone != last.samples || last.fraction() != 1 || last.eta != 0 {
+		t.Errorf("Expected the last report to be complete, got %+v", last)
+	}
+
+	// Every sample traces at least the camera ray.
+	if last.rays < int64(last.samples) {
+		t.Errorf("Expected at least %d rays, got %d", last.samples, last.rays)
+	}
+
+	if !identical(film.Image()[0], Render(config.camera(), world, lightShapes, config).Image()[0]) {
+		t.Errorf("Reporting progress changed the image")
+	}
+}
+
+func TestProgressOfOverfullFilm(t *testing.T) {
+	config := testProgressiveConfig()
+	config.width = 4
+	config.height = 4
+
+	// Resuming with fewer samples than the checkpoint holds finds the render done.
+	film := config.film()
+
+	for i := range film.samples {
+		film.samples[i] = 2 * config.samples
+	}
+
+	var output bytes.Buffer
+
+	tracker := newProgressTracker(film, config, ProgressBar(&output, 0))
+	tracker.add(tileResult{})
+
+	if p := tracker.progress; p.fraction() != 1 || p.eta != 0 {
+		t.Errorf("Expected an overfull film to be done, got %+v", p)
+	}
+
+	if !strings.Contains(output.String(), "100.0%") {
+		t.Errorf("Expected a full progress bar, got %q", output.String())
+	}
+
+	if rate := (Progress{rays: 10}).raysPerSecond(); rate != 0 {
+		t.Errorf("Expected no rate before any time has passed, got %v", rate)
+	}
+}
+
+func TestRenderContextCancels(t *testing.T) {
+	config := testProgressiveConfig()
+	config.width = 64
+	config.height = 64
+	config.threads = 1
+
+	world, lightShapes := CornellBox(config)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	tiles := 0
+
+	film, err := RenderContext(ctx, config.camera(), world, lightShapes, config, func(p Progress) {
+		tiles = p.tilesDone
+
+		if p.tilesDone == 2 {
+			cancel()
+		}
+	})
+	if err != context.Canceled {
+		t.Fatalf("Expected the render to be cancelled, got %v", err)
+	}
+
+	// The worker may already have taken the next tile when the second finishes.
+	if tiles < 2 || tiles > 3 {
+		t.Errorf("Expected the render to stop after 2 or 3 tiles, got %d", tiles)
+	}
+
+	if film.samples[len(film.samples)-1] != 0 {
+		t.Errorf("Expected the last tile not to be rendered")
+	}
+}
+
+func TestRenderCropWindow(t *testing.T) {
+	config := testProgressiveConfig()
+	config.width = 40
+	config.height = 30
+	config.aovs = []AOV{AOVDepth}
+
+	world, lightShapes := CornellBox(config)
+	full := Render(config.camera(), world, lightShapes, config)
+	fullImage := full.Image()
+	fullDepth := full.Layer(AOVDepth)
+
+	for _, crop := range []CropWindow{{5, 3, 29, 21, false}, {0.5, 0.25, 1, 0.5, true}} {
+		config.crop = crop
+		window := config.window()
+		film := Render(config.camera(), world, lightShapes, config)
+
+		if film.width != window.width() || film.height != window.height() {
+			t.Fatalf("Expected a %dx%d film for %v, got %dx%d", window.width(), window.height(), crop, film.width, film.height)
+		}
+
+		image := film.Image()
+		depth := film.Layer(AOVDepth)
+
+		for y := window.y0; y < window.y1; y++ {
+			for x := window.x0; x < window.x1; x++ {
+				i := (y-window.y0)*window.width() + x - window.x0
+
+				if !identical(image[i], fullImage[y*config.width+x]) || !identical(depth[i], fullDepth[y*config.width+x]) {
+					t.Fatalf("Pixel %d,%d of %v differs from the full render", x, y, crop)
+				}
+			}
+		}
+	}
+
+	if window := (CropWindow{0.5, 0.25, 1, 0.5, true}).pixels(40, 30); window != (Tile{20, 8, 40, 15}) {
+		t.Errorf("Unexpected normalized window %v", window)
+	}
+}
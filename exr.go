@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// EXRPixelType is how an OpenEXR channel stores its values.
+type EXRPixelType int32
+
+// EXRCompression is how OpenEXR scanline blocks are compressed.
+type EXRCompression uint8
+
+// The values match those in the OpenEXR file format.
+const (
+	EXRHalf  EXRPixelType = 1
+	EXRFloat EXRPixelType = 2
+
+	EXRNoCompression  EXRCompression = 0
+	EXRZIPCompression EXRCompression = 3
+)
+
+// ParseEXRPixelType parses "half" or "float".
+func ParseEXRPixelType(s string) (EXRPixelType, error) {
+	switch s {
+	case "half":
+		return EXRHalf, nil
+	case "float":
+		return EXRFloat, nil
+	}
+
+	return 0, fmt.Errorf("unknown EXR pixel type %q, expected half or float", s)
+}
+
+// ParseEXRCompression parses "none" or "zip".
+func ParseEXRCompression(s string) (EXRCompression, error) {
+	switch s {
+	case "none":
+		return EXRNoCompression, nil
+	case "zip":
+		return EXRZIPCompression, nil
+	}
+
+	return 0, fmt.Errorf("unknown EXR compression %q, expected none or zip", s)
+}
+
+func (t EXRPixelType) String() string {
+	switch t {
+	case EXRHalf:
+		return "half"
+	case EXRFloat:
+		return "float"
+	}
+
+	return fmt.Sprintf("EXRPixelType(%d)", int32(t))
+}
+
+func (c EXRCompression) String() string {
+	switch c {
+	case EXRNoCompression:
+		return "none"
+	case EXRZIPCompression:
+		return "zip"
+	}
+
+	return fmt.Sprintf("EXRCompression(%d)", uint8(c))
+}
+
+func (t EXRPixelType) size() int {
+	if t == EXRHalf {
+		return 2
+	}
+
+	return 4
+}
+
+// linesPerBlock is the number of scanlines compressed together.
+func (c EXRCompression) linesPerBlock() int {
+	if c == EXRZIPCompression {
+		return 16
+	}
+
+	return 1
+}
+
+// EXRChannel is one channel of an OpenEXR image, taken from a component of the pixels.
+type EXRChannel struct {
+	name      string
+	pixelType EXRPixelType
+	pixels    []Vec3
+	component int
+}
+
+// EXRLayer returns a channel for each component of the pixels, named by the prefix
+// and the component names.
+func EXRLayer(prefix string, components []string, pixels []Vec3, pixelType EXRPixelType) []EXRChannel {
+	channels := make([]EXRChannel, len(components))
+
+	for i, component := range components {
+		channels[i] = EXRChannel{prefix + component, pixelType, pixels, i}
+	}
+
+	return channels
+}
+
+// WriteEXR writes the linear framebuffer, stored top row first, as a scanline OpenEXR image.
+func WriteEXR(w io.Writer, framebuffer []Vec3, width, height int, pixelType EXRPixelType, compression EXRCompression) error {
+	return WriteEXRChannels(w, EXRLayer("", []string{"R", "G", "B"}, framebuffer, pixelType), width, height, compression)
+}
+
+// WriteEXRChannels writes a scanline OpenEXR image with any number of channels.
+func WriteEXRChannels(w io.Writer, channels []EXRChannel, width, height int, compression EXRCompression) error {
+	for _, channel := range channels {
+		if channel.pixelType != EXRHalf && channel.pixelType != EXRFloat {
+			return fmt.Errorf("unsupported EXR pixel type %v", channel.pixelType)
+		}
+	}
+
+	if compression != EXRNoCompression && compression != EXRZIPCompression {
+		return fmt.Errorf("unsupported EXR compression %v", compression)
+	}
+
+	// OpenEXR requires the channels in alphabetical order.
+	channels = append([]EXRChannel(nil), channels...)
+
+	sort.SliceStable(channels, func(i, j int) bool {
+		return channels[i].name < channels[j].name
+	})
+
+	var header bytes.Buffer
+
+	binary.Write(&header, binary.LittleEndian, uint32(20000630))
+	binary.Write(&header, binary.LittleEndian, uint32(2))
+
+	var channelList bytes.Buffer
+
+	for _, channel := range channels {
+		channelList.WriteString(channel.name)
+		channelList.WriteByte(0)
+		binary.Write(&channelList, binary.LittleEndian, channel.pixelType)
+		// pLinear and three reserved bytes, followed by the x and y sampling.
+		channelList.Write([]byte{0, 0, 0, 0})
+		binary.Write(&channelList, binary.LittleEndian, [2]int32{1, 1})
+	}
+
+	channelList.WriteByte(0)
+
+	window := [4]int32{0, 0, int32(width - 1), int32(height - 1)}
+
+	writeEXRAttribute(&header, "channels", "chlist", channelList.Bytes())
+	writeEXRAttribute(&header, "compression", "compression", compression)
+	writeEXRAttribute(&header, "dataWindow", "box2i", window)
+	writeEXRAttribute(&header, "displayWindow", "box2i", window)
+	writeEXRAttribute(&header, "lineOrder", "lineOrder", uint8(0))
+	writeEXRAttribute(&header, "pixelAspectRatio", "float", float32(1))
+	writeEXRAttribute(&header, "screenWindowCenter", "v2f", [2]float32{0, 0})
+	writeEXRAttribute(&header, "screenWindowWidth", "float", float32(1))
+	header.WriteByte(0)
+
+	linesPerBlock := compression.linesPerBlock()
+	blockCount := (height + linesPerBlock - 1) / linesPerBlock
+	blocks := make([][]byte, blockCount)
+
+	for b := range blocks {
+		y0 := b * linesPerBlock
+		y1 := minInt(y0+linesPerBlock, height)
+
+		blocks[b] = exrBlock(channels, width, y0, y1, compression)
+	}
+
+	// Each block is preceded by its first scanline and its size.
+	offset := uint64(header.Len() + 8*blockCount)
+
+	for _, block := range blocks {
+		binary.Write(&header, binary.LittleEndian, offset)
+		offset += uint64(8 + len(block))
+	}
+
+	if _, err := w.Write(header.Bytes()); err != nil {
+		return err
+	}
+
+	for b, block := range blocks {
+		prefix := [2]int32{int32(b * linesPerBlock), int32(len(block))}
+
+		if err := binary.Write(w, binary.LittleEndian, prefix); err != nil {
+			return err
+		}
+
+		if _, err := w.Write(block); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeEXRAttribute(header *bytes.Buffer, name, attributeType string, value interface{}) {
+	var data bytes.Buffer
+
+	binary.Write(&data, binary.LittleEndian, value)
+
+	header.WriteString(name)
+	header.WriteByte(0)
+	header.WriteString(attributeType)
+	header.WriteByte(0)
+	binary.Write(header, binary.LittleEndian, int32(data.Len()))
+	header.Write(data.Bytes())
+}
+
+// exrBlock returns the data for scanlines y0 to y1, each holding every value of one
+// channel before the next.
+func exrBlock(channels []EXRChannel, width, y0, y1 int, compression EXRCompression) []byte {
+	var raw []byte
+
+	for y := y0; y < y1; y++ {
+		for _, channel := range channels {
+			for _, pixel := range channel.pixels[y*width : (y+1)*width] {
+				value := pixel.get(channel.component)
+
+				if channel.pixelType == EXRHalf {
+					raw = binary.LittleEndian.AppendUint16(raw, float16(value))
+				} else {
+					raw = binary.LittleEndian.AppendUint32(raw, math.Float32bits(float32(value)))
+				}
+			}
+		}
+	}
+
+	if compression == EXRZIPCompression {
+		// Readers take a block the size of the raw data to be uncompressed.
+		if compressed := exrZIP(raw); len(compressed) < len(raw) {
+			return compressed
+		}
+	}
+
+	return raw
+}
+
+// exrZIP splits the even and odd bytes apart and stores the differences between
+// neighbours before deflating, which is the predictor OpenEXR expects.
+func exrZIP(raw []byte) []byte {
+	split := make([]byte, len(raw))
+	half := (len(raw) + 1) / 2
+
+	for i, value := range raw {
+		if i%2 == 0 {
+			split[i/2] = value
+		} else {
+			split[half+i/2] = value
+		}
+	}
+
+	for i := len(split) - 1; i > 0; i-- {
+		split[i] = split[i] - split[i-1] + 128
+	}
+
+	var compressed bytes.Buffer
+
+	zipper := zlib.NewWriter(&compressed)
+	zipper.Write(split)
+	zipper.Close()
+
+	return compressed.Bytes()
+}
+
+// float16 converts to the bits of the nearest IEEE 754 half precision value, rounding
+// ties to even. Values too large for a half become infinite.
+func float16(value float64) uint16 {
+	bits := math.Float32bits(float32(value))
+	sign := uint16(bits>>16) & 0x8000
+	exponent := int32(bits>>23) & 0xff
+	mantissa := bits & 0x7fffff
+
+	if exponent == 0xff {
+		if mantissa != 0 {
+			return sign | 0x7e00
+		}
+
+		return sign | 0x7c00
+	}
+
+	exponent -= 127 - 15
+
+	if exponent >= 0x1f {
+		return sign | 0x7c00
+	}
+
+	if exponent <= 0 {
+		if exponent < -10 {
+			return sign
+		}
+
+		// Subnormal halves keep the implicit leading one in their mantissa.
+		mantissa |= 0x800000
+		shift := uint32(14 - exponent)
+
+		return sign | uint16(roundShift(mantissa, shift))
+	}
+
+	// A mantissa rounding up to 0x400 carries into the exponent, which is what we want.
+	return sign | uint16(uint32(exponent)<<10+roundShift(mantissa, 13))
+}
+
+// roundShift shifts value right, rounding to nearest with ties to even.
+func roundShift(value, shift uint32) uint32 {
+	half := uint32(1) << (shift - 1)
+	remainder := value & (half<<1 - 1)
+	value >>= shift
+
+	if remainder > half || (remainder == half && value&1 == 1) {
+		value++
+	}
+
+	return value
+}
@@ -0,0 +1,205 @@
+package main
+
+import "math"
+
+// minimumLuminance keeps the relative error of dark pixels from growing without bound.
+const minimumLuminance = 0.01
+
+// Film accumulates the samples taken of each pixel, along with the AOVs asked for.
+// Pixels are stored top row first. The running mean and variance of each pixel's
+// luminance are kept with Welford's algorithm, to estimate its error. A Film with
+// weights has the color and light AOVs splatted onto it by a reconstruction filter,
+// summing the weighted samples falling near each pixel rather than those within it.
+type Film struct {
+	width     int
+	height    int
+	aovs      []AOV
+	samples   []int
+	converged []bool
+	color     []Vec3
+	weights   []float64
+	mean      []float64
+	m2        []float64
+	hits      []int
+	layers    [][]Vec3
+}
+
+// NewFilm returns an empty width by height Film.
+func NewFilm(width, height int, aovs []AOV) *Film {
+	f := &Film{
+		width:     width,
+		height:    height,
+		aovs:      aovs,
+		samples:   make([]int, width*height),
+		converged: make([]bool, width*height),
+		color:     make([]Vec3, width*height),
+		mean:      make([]float64, width*height),
+		m2:        make([]float64, width*height),
+		layers:    make([][]Vec3, len(aovs)),
+	}
+
+	if len(aovs) > 0 {
+		f.hits = make([]int, width*height)
+	}
+
+	for i := range f.layers {
+		f.layers[i] = make([]Vec3, width*height)
+	}
+
+	return f
+}
+
+// addSample adds the color, and the AOVs from path when there are any, to a pixel.
+// The sample index picks which sample sets the IDs. With weights, the color and light
+// are left to be splatted.
+func (f *Film) addSample(pixelIndex, sampleIndex int, color Vec3, path *PathRecord) {
+	f.samples[pixelIndex]++
+
+	if f.weights == nil {
+		f.color[pixelIndex].inPlaceAdd(color)
+	}
+
+	l := luminance(color)
+	delta := l - f.mean[pixelIndex]
+	f.mean[pixelIndex] += delta / float64(f.samples[pixelIndex])
+	f.m2[pixelIndex] += delta * (l - f.mean[pixelIndex])
+
+	if len(f.aovs) == 0 {
+		return
+	}
+
+	if path.hit {
+		f.hits[pixelIndex]++
+	}
+
+	for i, aov := range f.aovs {
+		if aov == AOVSampleCount || (aov.isLight() && f.weights != nil) {
+			continue
+		}
+
+		if aov.isID() {
+			if sampleIndex == 0 {
+				f.layers[i][pixelIndex] = path.value(aov)
+			}
+		} else if path.hit || !aov.firstHit() {
+			f.layers[i][pixelIndex].inPlaceAdd(path.value(aov))
+		}
+	}
+}
+
+// splat adds the filtered samples of a splatBuffer.
+func (f *Film) splat(b *splatBuffer) {
+	for y := b.region.y0; y < b.region.y1; y++ {
+		for x := b.region.x0; x < b.region.x1; x++ {
+			i := (y-b.region.y0)*b.region.width() + x - b.region.x0
+			pixelIndex := y*f.width + x
+
+			f.color[pixelIndex].inPlaceAdd(b.color[i])
+			f.weights[pixelIndex] += b.weights[i]
+
+			for l, layer := range b.layers {
+				if layer != nil {
+					f.layers[l][pixelIndex].inPlaceAdd(layer[i])
+				}
+			}
+		}
+	}
+}
+
+// variance returns the sample variance of a pixel's luminance.
+func (f *Film) variance(pixelIndex int) float64 {
+	if f.samples[pixelIndex] < 2 {
+		return 0
+	}
+
+	return f.m2[pixelIndex] / float64(f.samples[pixelIndex]-1)
+}
+
+// relativeError estimates the standard error of a pixel's mean luminance relative to
+// that mean.
+func (f *Film) relativeError(pixelIndex int) float64 {
+	if f.samples[pixelIndex] == 0 {
+		return math.Inf(1)
+	}
+
+	standardError := math.Sqrt(f.variance(pixelIndex) / float64(f.samples[pixelIndex]))
+
+	return standardError / math.Max(f.mean[pixelIndex], minimumLuminance)
+}
+
+// progress returns the fewest samples taken of any pixel still sampling.
+func (f *Film) progress() int {
+	fewest := 0
+	found := false
+
+	for i, n := range f.samples {
+		if !f.converged[i] && (!found || n < fewest) {
+			fewest = n
+			found = true
+		}
+	}
+
+	return fewest
+}
+
+// Image returns the average color of each pixel.
+func (f *Film) Image() []Vec3 {
+	image := make([]Vec3, len(f.color))
+
+	for i, sum := range f.color {
+		image[i] = f.average(i, sum)
+	}
+
+	return image
+}
+
+// average divides a sum of samples of a pixel by their number, or by their weight.
+func (f *Film) average(pixelIndex int, sum Vec3) Vec3 {
+	if f.weights != nil {
+		if f.weights[pixelIndex] == 0 {
+			return Vec3{}
+		}
+
+		return sum.divideScalar(f.weights[pixelIndex])
+	}
+
+	if f.samples[pixelIndex] == 0 {
+		return Vec3{}
+	}
+
+	return sum.divideScalar(float64(f.samples[pixelIndex]))
+}
+
+// Layer returns the values of an AOV the Film was made with. Pixels no camera ray hit
+// have an infinite depth.
+func (f *Film) Layer(aov AOV) []Vec3 {
+	for i, filmAOV := range f.aovs {
+		if filmAOV == aov {
+			return f.resolve(aov, f.layers[i])
+		}
+	}
+
+	panic("AOV " + aov.String() + " is not on the Film")
+}
+
+func (f *Film) resolve(aov AOV, sums []Vec3) []Vec3 {
+	layer := make([]Vec3, len(sums))
+
+	for i, sum := range sums {
+		switch {
+		case aov == AOVSampleCount:
+			count := float64(f.samples[i])
+			layer[i] = Vec3{count, count, count}
+		case aov.isID():
+			layer[i] = sum
+		case aov.firstHit() && f.hits[i] > 0:
+			layer[i] = sum.divideScalar(float64(f.hits[i]))
+		case aov == AOVDepth:
+			layer[i] = Vec3{math.Inf(1), math.Inf(1), math.Inf(1)}
+		case !aov.firstHit():
+			layer[i] = f.average(i, sum)
+		}
+	}
+
+	return layer
+}
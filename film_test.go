@@ -0,0 +1,51 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFilmVarianceMatchesTwoPass(t *testing.T) {
+	film := NewFilm(1, 1, nil)
+	rng := NewRand(5)
+	values := make([]float64, 100)
+
+	for i := range values {
+		values[i] = rng.Float64() * 10
+		film.addSample(0, i, Vec3{values[i], values[i], values[i]}, nil)
+	}
+
+	mean := 0.0
+
+	for _, value := range values {
+		mean += value / float64(len(values))
+	}
+
+	variance := 0.0
+
+	for _, value := range values {
+		variance += (value - mean) * (value - mean) / float64(len(values)-1)
+	}
+
+	if math.Abs(film.mean[0]-mean) > 1e-9 || math.Abs(film.variance(0)-variance) > 1e-9 {
+		t.Errorf("Expected mean %v and variance %v, got %v and %v", mean, variance, film.mean[0], film.variance(0))
+	}
+
+	expected := math.Sqrt(variance/100) / mean
+
+	if math.Abs(film.relativeError(0)-expected) > 1e-9 {
+		t.Errorf("Expected relative error %v, got %v", expected, film.relativeError(0))
+	}
+}
+
+func TestFilmSampleCountLayer(t *testing.T) {
+	film := NewFilm(2, 1, []AOV{AOVSampleCount})
+
+	for s := 0; s < 3; s++ {
+		film.addSample(1, s, Vec3{1, 1, 1}, &PathRecord{})
+	}
+
+	if counts := film.Layer(AOVSampleCount); counts[0].x() != 0 || counts[1].x() != 3 {
+		t.Errorf("Expected sample counts 0 and 3, got %v", counts)
+	}
+}
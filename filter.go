@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Filter is the pixel reconstruction filter weighing each sample's contribution to the
+// pixels around it.
+type Filter int
+
+// The supported reconstruction filters.
+const (
+	FilterBox Filter = iota
+	FilterTent
+	FilterGaussian
+	FilterMitchell
+	FilterLanczos
+)
+
+var filterNames = []string{"box", "tent", "gaussian", "mitchell", "lanczos"}
+
+// filterRadii are the radii in pixels used when none is given.
+var filterRadii = []float64{0.5, 1, 1.5, 2, 3}
+
+// ParseFilter parses the name of a reconstruction filter.
+func ParseFilter(s string) (Filter, error) {
+	for i, name := range filterNames {
+		if name == s {
+			return Filter(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown filter %q, expected one of %v", s, filterNames)
+}
+
+func (f Filter) String() string {
+	if f >= 0 && int(f) < len(filterNames) {
+		return filterNames[f]
+	}
+
+	return fmt.Sprintf("Filter(%d)", int(f))
+}
+
+// weight returns the filter's weight at a distance d from the center of a pixel, in a
+// single dimension. The filters are stretched to the radius, outside of which they are
+// zero. The weights are not normalized, as pixels divide by the sum of theirs.
+func (f Filter) weight(d, radius float64) float64 {
+	d = math.Abs(d)
+
+	if d >= radius {
+		return 0
+	}
+
+	switch f {
+	case FilterTent:
+		return 1 - d/radius
+	case FilterGaussian:
+		// A standard deviation of a third of the radius, shifted to reach zero at it.
+		alpha := 4.5 / (radius * radius)
+
+		return math.Exp(-alpha*d*d) - math.Exp(-alpha*radius*radius)
+	case FilterMitchell:
+		return mitchell(2 * d / radius)
+	case FilterLanczos:
+		return sinc(d) * sinc(d/radius)
+	}
+
+	return 1
+}
+
+// mitchell is the Mitchell-Netravali cubic with B and C of a third, for x in [0, 2].
+func mitchell(x float64) float64 {
+	const b = 1.0 / 3
+	const c = 1.0 / 3
+
+	if x < 1 {
+		return ((12-9*b-6*c)*x*x*x + (-18+12*b+6*c)*x*x + (6 - 2*b)) / 6
+	}
+
+	return ((-b-6*c)*x*x*x + (6*b+30*c)*x*x + (-12*b-48*c)*x + (8*b + 24*c)) / 6
+}
+
+// sinc is the normalized sinc function.
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// splatBuffer collects the samples of a Tile filtered onto the pixels around them, which
+// reach past the Tile, so that they can be added to the Film in a fixed order.
+type splatBuffer struct {
+	region  Tile
+	color   []Vec3
+	weights []float64
+	layers  [][]Vec3
+}
+
+// newSplatBuffer returns an empty splatBuffer for the Film's pixels within radius of the
+// tile, which is given in the Film's pixels.
+func newSplatBuffer(film *Film, tile Tile, radius float64) *splatBuffer {
+	reach := int(math.Ceil(radius))
+	region := Tile{
+		maxInt(tile.x0-reach, 0),
+		maxInt(tile.y0-reach, 0),
+		minInt(tile.x1+reach, film.width),
+		minInt(tile.y1+reach, film.height),
+	}
+
+	pixels := region.width() * region.height()
+	b := &splatBuffer{
+		region:  region,
+		color:   make([]Vec3, pixels),
+		weights: make([]float64, pixels),
+		layers:  make([][]Vec3, len(film.aovs)),
+	}
+
+	for i, aov := range film.aovs {
+		if aov.isLight() {
+			b.layers[i] = make([]Vec3, pixels)
+		}
+	}
+
+	return b
+}
+
+// add filters a sample at x, y in the Film's pixels, measured from the top left, onto
+// the pixels whose centers are within radius of it.
+func (b *splatBuffer) add(x, y float64, color Vec3, path *PathRecord, aovs []AOV, filter Filter, radius float64) {
+	px0 := maxInt(int(math.Ceil(x-0.5-radius)), b.region.x0)
+	px1 := minInt(int(math.Floor(x-0.5+radius)), b.region.x1-1)
+	py0 := maxInt(int(math.Ceil(y-0.5-radius)), b.region.y0)
+	py1 := minInt(int(math.Floor(y-0.5+radius)), b.region.y1-1)
+
+	for py := py0; py <= py1; py++ {
+		wy := filter.weight(float64(py)+0.5-y, radius)
+
+		if wy == 0 {
+			continue
+		}
+
+		for px := px0; px <= px1; px++ {
+			w := wy * filter.weight(float64(px)+0.5-x, radius)
+
+			if w == 0 {
+				continue
+			}
+
+			i := (py-b.region.y0)*b.region.width() + px - b.region.x0
+			b.color[i].inPlaceAdd(color.multiplyScalar(w))
+			b.weights[i] += w
+
+			for l, aov := range aovs {
+				if b.layers[l] != nil {
+					b.layers[l][i].inPlaceAdd(path.value(aov).multiplyScalar(w))
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestFilterWeights(t *testing.T) {
+	for i := range filterNames {
+		filter := Filter(i)
+		radius := filterRadii[i]
+
+		if w := filter.weight(radius, radius); w != 0 {
+			t.Errorf("%v is %v at its radius, expected 0", filter, w)
+		}
+
+		if filter.weight(0, radius) <= 0 || filter.weight(0, radius) < filter.weight(radius/2, radius) {
+			t.Errorf("%v does not peak at the center", filter)
+		}
+
+		for _, d := range []float64{0.1, 0.4, 1.3} {
+			if filter.weight(d, radius) != filter.weight(-d, radius) {
+				t.Errorf("%v is not symmetric at %v", filter, d)
+			}
+		}
+	}
+
+	// Mitchell-Netravali and Lanczos have negative lobes, which sharpen.
+	if FilterMitchell.weight(1.5, 2) >= 0 || FilterLanczos.weight(1.5, 3) >= 0 {
+		t.Errorf("Expected negative lobes")
+	}
+
+	if math.Abs(mitchell(1)-1.0/18) > 1e-12 || math.Abs(mitchell(2)) > 1e-12 {
+		t.Errorf("Mitchell-Netravali is %v at 1 and %v at 2", mitchell(1), mitchell(2))
+	}
+}
+
+func TestSplattingKeepsConstantColor(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	color := Vec3{0.25, 0.5, 2}
+
+	for i := range filterNames {
+		config := Config{width: 20, height: 20, filter: Filter(i), filterRadius: 1.5}
+		film := config.film()
+
+		for _, tile := range NewTiles(20, 20) {
+			buffer := newSplatBuffer(film, tile, config.radius())
+
+			for y := tile.y0; y < tile.y1; y++ {
+				for x := tile.x0; x < tile.x1; x++ {
+					for s := 0; s < 16; s++ {
+						buffer.add(float64(x)+rng.Float64(), float64(y)+rng.Float64(), color, nil, nil, config.filter, config.radius())
+					}
+				}
+			}
+
+			film.splat(buffer)
+		}
+
+		for p, pixel := range film.Image() {
+			if pixel.subtract(color).length() > 1e-9 {
+				t.Fatalf("%v changed pixel %d of a constant image to %v", config.filter, p, pixel)
+			}
+		}
+	}
+}
+
+func TestRenderWithFilter(t *testing.T) {
+	config := testProgressiveConfig()
+	config.width = 40
+	config.height = 20
+	config.filter = FilterMitchell
+	config.aovs = []AOV{AOVDirect, AOVIndirect}
+
+	world, lightShapes := CornellBox(config)
+
+	var expected []Vec3
+
+	for _, threads := range []int{1, 4} {
+		config.threads = threads
+		film := Render(config.camera(), world, lightShapes, config)
+		image := film.Image()
+		direct := film.Layer(AOVDirect)
+		indirect := film.Layer(AOVIndirect)
+
+		for i := range image {
+			if sum := direct[i].add(indirect[i]); sum.subtract(image[i]).length() > 1e-9*(1+image[i].length()) {
+				t.Errorf("Pixel %d direct %v and indirect %v do not add up to %v", i, direct[i], indirect[i], image[i])
+			}
+		}
+
+		if expected == nil {
+			expected = image
+		}
+
+		for i := range image {
+			if !identical(image[i], expected[i]) {
+				t.Fatalf("Pixel %d differs with %d threads", i, threads)
+			}
+		}
+	}
+
+	config.filter = FilterBox
+	box := Render(config.camera(), world, lightShapes, config).Image()
+
+	for i := range box {
+		if !identical(box[i], expected[i]) {
+			return
+		}
+	}
+
+	t.Errorf("The filter did not change the image")
+}
+
+func TestRenderProgressiveWithFilter(t *testing.T) {
+	config := testProgressiveConfig()
+	config.filter = FilterGaussian
+
+	world, lightShapes := CornellBox(config)
+	expected := Render(config.camera(), world, lightShapes, config).Image()
+	film := config.film()
+
+	if err := RenderProgressive(context.Background(), film, config.camera(), world, lightShapes, config, func(film *Film) error { return nil }, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Splats are summed pass by pass, so only match to rounding.
+	for i, pixel := range film.Image() {
+		if pixel.subtract(expected[i]).length() > 1e-9*(1+expected[i].length()) {
+			t.Fatalf("Pixel %d differs from Render: %v != %v", i, pixel, expected[i])
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+)
+
+// WriteHDR writes the linear framebuffer, stored top row first, as an uncompressed
+// Radiance RGBE image.
+func WriteHDR(w io.Writer, framebuffer []Vec3, width, height int) error {
+	buffered := bufio.NewWriter(w)
+
+	fmt.Fprintf(buffered, "#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n-Y %d +X %d\n", height, width)
+
+	for _, pixel := range framebuffer[:width*height] {
+		rgbe := toRGBE(pixel)
+
+		buffered.Write(rgbe[:])
+	}
+
+	return buffered.Flush()
+}
+
+// toRGBE shares the exponent of the brightest channel between all three mantissas.
+// Negative and NaN channels are written as zero.
+func toRGBE(v Vec3) [4]byte {
+	r := nonNegative(v.r())
+	g := nonNegative(v.g())
+	b := nonNegative(v.b())
+
+	brightest := math.Max(r, math.Max(g, b))
+
+	if brightest < 1e-32 {
+		return [4]byte{}
+	}
+
+	mantissa, exponent := math.Frexp(brightest)
+
+	if exponent > 127 || math.IsInf(brightest, 1) {
+		return [4]byte{255, 255, 255, 255}
+	}
+
+	scale := mantissa * 256 / brightest
+
+	return [4]byte{byte(r * scale), byte(g * scale), byte(b * scale), byte(exponent + 128)}
+}
+
+func nonNegative(value float64) float64 {
+	if value > 0 {
+		return value
+	}
+
+	return 0
+}
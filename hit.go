@@ -4,10 +4,10 @@ import "math"
 
 // Hitable represents hitable graphical objects.
 type Hitable interface {
-	hit(r Ray, tMin, tMax float64) (bool, *Hit)
+	hit(r Ray, tMin, tMax float64, record *Hit, sampler Sampler) bool
 	boundingBox(t0, t1 float64) (bool, *AABB)
 	pdfValue(o, direction Vec3) float64
-	random(o Vec3) Vec3
+	random(o Vec3, sampler Sampler) Vec3
 }
 
 // Hit is a record of a Hitable object being hit.
@@ -18,6 +18,7 @@ type Hit struct {
 	p        Vec3
 	normal   Vec3
 	material Material
+	objectID int
 }
 
 // FlipNormals accepts a Hitable and reverses the normal.
@@ -25,16 +26,14 @@ type FlipNormals struct {
 	hitable Hitable
 }
 
-func (fn FlipNormals) hit(r Ray, tMin, tMax float64) (bool, *Hit) {
-	didHit, hit := fn.hitable.hit(r, tMin, tMax)
+func (fn FlipNormals) hit(r Ray, tMin, tMax float64, record *Hit, sampler Sampler) bool {
+	if fn.hitable.hit(r, tMin, tMax, record, sampler) {
+		record.normal = record.normal.negate()
 
-	if didHit {
-		hit.normal = hit.normal.negate()
-
-		return true, hit
+		return true
 	}
 
-	return false, nil
+	return false
 }
 
 func (fn FlipNormals) boundingBox(t0, t1 float64) (bool, *AABB) {
@@ -42,11 +41,50 @@ func (fn FlipNormals) boundingBox(t0, t1 float64) (bool, *AABB) {
 }
 
 func (fn FlipNormals) pdfValue(o, direction Vec3) float64 {
-	return 0.0
+	return fn.hitable.pdfValue(o, direction)
+}
+
+func (fn FlipNormals) random(o Vec3, sampler Sampler) Vec3 {
+	return fn.hitable.random(o, sampler)
+}
+
+// ObjectID tags the hits of a Hitable with an ID for the object ID AOV.
+type ObjectID struct {
+	hitable Hitable
+	id      int
+}
+
+// NumberObjects tags each Hitable with its position in the list, counting from one.
+func NumberObjects(hitables HitableList) HitableList {
+	numbered := NewHitableList(len(hitables))
+
+	for i, hitable := range hitables {
+		numbered[i] = ObjectID{hitable, i + 1}
+	}
+
+	return numbered
+}
+
+func (oi ObjectID) hit(r Ray, tMin, tMax float64, record *Hit, sampler Sampler) bool {
+	if oi.hitable.hit(r, tMin, tMax, record, sampler) {
+		record.objectID = oi.id
+
+		return true
+	}
+
+	return false
 }
 
-func (fn FlipNormals) random(o Vec3) Vec3 {
-	return Vec3{1, 0, 0}
+func (oi ObjectID) boundingBox(t0, t1 float64) (bool, *AABB) {
+	return oi.hitable.boundingBox(t0, t1)
+}
+
+func (oi ObjectID) pdfValue(o, direction Vec3) float64 {
+	return oi.hitable.pdfValue(o, direction)
+}
+
+func (oi ObjectID) random(o Vec3, sampler Sampler) Vec3 {
+	return oi.hitable.random(o, sampler)
 }
 
 // Translate moves a Hitable by an offset.
@@ -55,22 +93,20 @@ type Translate struct {
 	offset  Vec3
 }
 
-func (ts Translate) hit(r Ray, tMin, tMax float64) (bool, *Hit) {
+func (ts Translate) hit(r Ray, tMin, tMax float64, record *Hit, sampler Sampler) bool {
 	rayMoved := Ray{
 		r.origin().subtract(ts.offset),
 		r.direction(),
 		r.time(),
 	}
 
-	didHit, hit := ts.hitable.hit(rayMoved, tMin, tMax)
+	if ts.hitable.hit(rayMoved, tMin, tMax, record, sampler) {
+		record.p.inPlaceAdd(ts.offset)
 
-	if didHit {
-		hit.p.inPlaceAdd(ts.offset)
-
-		return didHit, hit
+		return true
 	}
 
-	return didHit, nil
+	return false
 }
 
 func (ts Translate) boundingBox(t0, t1 float64) (bool, *AABB) {
@@ -89,11 +125,11 @@ func (ts Translate) boundingBox(t0, t1 float64) (bool, *AABB) {
 }
 
 func (ts Translate) pdfValue(o, direction Vec3) float64 {
-	return 0.0
+	return ts.hitable.pdfValue(o.subtract(ts.offset), direction)
 }
 
-func (ts Translate) random(o Vec3) Vec3 {
-	return Vec3{1, 0, 0}
+func (ts Translate) random(o Vec3, sampler Sampler) Vec3 {
+	return ts.hitable.random(o.subtract(ts.offset), sampler)
 }
 
 // RotateY is a Hitable that contains a Y rotated Hitable.
@@ -168,7 +204,7 @@ func NewRotateY(hitable Hitable, angle float64) RotateY {
 	}
 }
 
-func (ry RotateY) hit(r Ray, tMin, tMax float64) (bool, *Hit) {
+func (ry RotateY) hit(r Ray, tMin, tMax float64, record *Hit, sampler Sampler) bool {
 	origin := r.origin()
 	direction := r.direction()
 
@@ -184,25 +220,14 @@ func (ry RotateY) hit(r Ray, tMin, tMax float64) (bool, *Hit) {
 		r.time(),
 	}
 
-	didHit, hit := ry.hitable.hit(rotatedRay, tMin, tMax)
-
-	if didHit {
-		p := hit.p
-		normal := hit.normal
-
-		p.e0 = ry.cosTheta*hit.p.x() + ry.sinTheta*hit.p.z()
-		p.e2 = -ry.sinTheta*hit.p.x() + ry.cosTheta*hit.p.z()
-
-		normal.e0 = ry.cosTheta*hit.normal.x() + ry.sinTheta*hit.normal.z()
-		normal.e2 = -ry.sinTheta*hit.normal.x() + ry.cosTheta*hit.normal.z()
+	if ry.hitable.hit(rotatedRay, tMin, tMax, record, sampler) {
+		record.p = ry.toWorld(record.p)
+		record.normal = ry.toWorld(record.normal)
 
-		hit.p = p
-		hit.normal = normal
-
-		return didHit, hit
+		return true
 	}
 
-	return didHit, nil
+	return false
 }
 
 func (ry RotateY) boundingBox(t0, t1 float64) (bool, *AABB) {
@@ -210,9 +235,27 @@ func (ry RotateY) boundingBox(t0, t1 float64) (bool, *AABB) {
 }
 
 func (ry RotateY) pdfValue(o, direction Vec3) float64 {
-	return 0.0
+	return ry.hitable.pdfValue(ry.toObject(o), ry.toObject(direction))
+}
+
+func (ry RotateY) random(o Vec3, sampler Sampler) Vec3 {
+	return ry.toWorld(ry.hitable.random(ry.toObject(o), sampler))
 }
 
-func (ry RotateY) random(o Vec3) Vec3 {
-	return Vec3{1, 0, 0}
+// toObject rotates a Vec3 from world space into the space of the rotated Hitable.
+func (ry RotateY) toObject(v Vec3) Vec3 {
+	return Vec3{
+		ry.cosTheta*v.x() - ry.sinTheta*v.z(),
+		v.y(),
+		ry.sinTheta*v.x() + ry.cosTheta*v.z(),
+	}
+}
+
+// toWorld rotates a Vec3 from the space of the rotated Hitable back into world space.
+func (ry RotateY) toWorld(v Vec3) Vec3 {
+	return Vec3{
+		ry.cosTheta*v.x() + ry.sinTheta*v.z(),
+		v.y(),
+		-ry.sinTheta*v.x() + ry.cosTheta*v.z(),
+	}
 }
@@ -1,7 +1,5 @@
 package main
 
-import "math/rand"
-
 // HitableList is an array of Hitable graphics objects.
 type HitableList []Hitable
 
@@ -100,23 +98,19 @@ func (hList *HitableList) add(hitable Hitable) HitableList {
 	return *hList
 }
 
-func (hList HitableList) hit(r Ray, tMin, tMax float64) (bool, *Hit) {
+func (hList HitableList) hit(r Ray, tMin, tMax float64, record *Hit, sampler Sampler) bool {
 	hitAnything := false
 	closest := tMax
 
-	var closestHit Hit
-
+	// Each hit is closer than the last, so it can overwrite the record.
 	for _, hitable := range hList {
-		didHit, hit := hitable.hit(r, tMin, closest)
-
-		if didHit {
+		if hitable.hit(r, tMin, closest, record, sampler) {
 			hitAnything = true
-			closest = hit.t
-			closestHit = *hit
+			closest = record.t
 		}
 	}
 
-	return hitAnything, &closestHit
+	return hitAnything
 }
 
 func (hList HitableList) boundingBox(t0, t1 float64) (hasBox bool, box *AABB) {
@@ -146,18 +140,26 @@ func (hList HitableList) boundingBox(t0, t1 float64) (hasBox bool, box *AABB) {
 }
 
 func (hList HitableList) pdfValue(o, direction Vec3) float64 {
-	weight := 1.0 / len(hList)
+	if len(hList) < 1 {
+		return 0.0
+	}
+
+	weight := 1.0 / float64(len(hList))
 	sum := 0.0
 
 	for i := 0; i < len(hList); i++ {
-		sum += float64(weight) * hList[i].pdfValue(o, direction)
+		sum += weight * hList[i].pdfValue(o, direction)
 	}
 
 	return sum
 }
 
-func (hList HitableList) random(o Vec3) Vec3 {
-	index := int(rand.Float64() * float64(len(hList)))
+func (hList HitableList) random(o Vec3, sampler Sampler) Vec3 {
+	if len(hList) < 1 {
+		return Vec3{1, 0, 0}
+	}
+
+	index := int(sampler.Float64() * float64(len(hList)))
 
-	return hList[index].random(o)
+	return hList[index].random(o, sampler)
 }
@@ -9,8 +9,8 @@ type mockHitable struct {
 	x, y, z float64
 }
 
-func (mh mockHitable) hit(r Ray, tMin, tMax float64) (bool, *Hit) {
-	return false, nil
+func (mh mockHitable) hit(r Ray, tMin, tMax float64, record *Hit, sampler Sampler) bool {
+	return false
 }
 
 func (mh mockHitable) boundingBox(t0, t1 float64) (bool, *AABB) {
@@ -32,7 +32,7 @@ func (mh mockHitable) pdfValue(o, direction Vec3) float64 {
 	return 0.0
 }
 
-func (mh mockHitable) random(o Vec3) Vec3 {
+func (mh mockHitable) random(o Vec3, sampler Sampler) Vec3 {
 	return Vec3{1, 0, 0}
 }
 
@@ -1,37 +1,171 @@
 package main
 
 import (
-	"image"
+	"fmt"
 	"image/png"
+	"io"
+	"math"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
-// WriteImage writes out a PNG based on the passed in framebuffer and config.
-func WriteImage(framebuffer *[]Vec3, config Config) {
-	img := image.NewNRGBA(image.Rect(0, 0, config.width, config.height))
+// imageExtensions are the output formats WriteImage supports.
+var imageExtensions = []string{".png", ".exr", ".hdr", ".pfm"}
 
-	for j := 0; j < config.height; j++ {
-		for i := 0; i < config.width; i++ {
-			pixelIndex := j*config.width + i
+// WriteImage writes the Film to config.filename in the format its extension names.
+// PNGs are tone mapped, the other formats keep the linear values. EXRs hold the AOVs as
+// layers, while the other formats write each AOV beside the image, as name.depth.png.
+// A crop window is written as an image of its own, or over config.cropBase when set,
+// which validateConfig allows for PNGs and PFMs.
+func WriteImage(film *Film, config Config) error {
+	extension := strings.ToLower(filepath.Ext(config.filename))
 
-			pixel := (*framebuffer)[pixelIndex]
+	if !containsString(imageExtensions, extension) {
+		return fmt.Errorf("unsupported output format %q, expected one of %s", extension, strings.Join(imageExtensions, ", "))
+	}
+
+	if extension == ".exr" {
+		return createImage(config.filename, func(w io.Writer) error {
+			return WriteEXRChannels(w, filmChannels(film, config.exrPixelType), film.width, film.height, config.exrCompression)
+		})
+	}
+
+	if err := writeLayer(config.filename, config.cropBase, extension, film.Image(), config); err != nil {
+		return err
+	}
+
+	for _, aov := range film.aovs {
+		pixels := film.Layer(aov)
+		layerConfig := config
 
-			img.Set(i, j, pixel.sqrt())
+		if extension == ".png" {
+			pixels, layerConfig = previewAOV(aov, pixels, config)
 		}
+
+		base := ""
+
+		if config.cropBase != "" {
+			base = aovFilename(config.cropBase, aov)
+		}
+
+		if err := writeLayer(aovFilename(config.filename, aov), base, extension, pixels, layerConfig); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeLayer writes pixels of the window, stored top row first, to a single layer image
+// format, merging them into the base image unless it is empty.
+func writeLayer(filename, base, extension string, pixels []Vec3, config Config) error {
+	if base != "" {
+		return mergeLayer(filename, base, extension, pixels, config)
 	}
 
-	write(img, config.filename)
+	window := config.window()
+	config.width = window.width()
+	config.height = window.height()
+
+	return createImage(filename, func(w io.Writer) error {
+		switch extension {
+		case ".png":
+			return png.Encode(w, ToneMapImage(pixels, config))
+		case ".hdr":
+			return WriteHDR(w, pixels, config.width, config.height)
+		}
+
+		return WritePFM(w, pixels, config.width, config.height)
+	})
 }
 
-func write(img image.Image, filename string) {
+func createImage(filename string, encode func(w io.Writer) error) error {
 	file, err := os.Create(filename)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	defer file.Close()
 
-	err = png.Encode(file, img)
-	if err != nil {
-		panic(err)
+	if err := encode(file); err != nil {
+		file.Close()
+
+		return err
 	}
+
+	return file.Close()
+}
+
+// aovFilename inserts the name of the AOV before the extension of the filename.
+func aovFilename(filename string, aov AOV) string {
+	extension := filepath.Ext(filename)
+
+	return strings.TrimSuffix(filename, extension) + "." + aov.String() + extension
+}
+
+// filmChannels lays out the color and AOVs of the Film as EXR layers. Depths, IDs and
+// sample counts are always stored as floats, as halves lose precision on them too quickly.
+func filmChannels(film *Film, pixelType EXRPixelType) []EXRChannel {
+	channels := EXRLayer("", []string{"R", "G", "B"}, film.Image(), pixelType)
+
+	for _, aov := range film.aovs {
+		layerType := pixelType
+
+		if aov == AOVDepth || aov.isID() || aov == AOVSampleCount {
+			layerType = EXRFloat
+		}
+
+		channels = append(channels, EXRLayer(aov.String()+".", aov.channels(), film.Layer(aov), layerType)...)
+	}
+
+	return channels
+}
+
+// previewAOV makes an AOV viewable as a PNG, along with the settings to tone map it.
+// Light is tone mapped like the image. Depths are scaled by the farthest depth, normals
+// are moved into [0, 1], IDs are given random colors and sample counts a heatmap.
+func previewAOV(aov AOV, pixels []Vec3, config Config) ([]Vec3, Config) {
+	if aov == AOVDirect || aov == AOVIndirect {
+		return pixels, config
+	}
+
+	config.exposure = 0
+	config.toneMap = ToneMapClamp
+	preview := make([]Vec3, len(pixels))
+	largest := 0.0
+
+	for _, pixel := range pixels {
+		if !math.IsInf(pixel.e0, 1) {
+			largest = math.Max(largest, pixel.e0)
+		}
+	}
+
+	for i, pixel := range pixels {
+		switch {
+		case aov == AOVDepth && largest > 0:
+			preview[i] = pixel.divideScalar(largest)
+		case aov == AOVSampleCount && largest > 0:
+			preview[i] = heatmap(pixel.e0 / largest)
+		case aov == AOVNormal:
+			preview[i] = pixel.add(Vec3{1, 1, 1}).multiplyScalar(0.5)
+		case aov.isID() && pixel.e0 > 0:
+			hash := mix64(uint64(pixel.e0))
+			preview[i] = Vec3{float64(hash&0xff) / 255, float64(hash>>8&0xff) / 255, float64(hash>>16&0xff) / 255}
+		default:
+			preview[i] = pixel
+		}
+	}
+
+	return preview, config
+}
+
+// heatmapColors run from cold to hot, evenly spaced.
+var heatmapColors = []Vec3{{0, 0, 0}, {0, 0, 1}, {1, 0, 0}, {1, 1, 0}, {1, 1, 1}}
+
+// heatmap returns the color for x in [0, 1], blending between heatmapColors.
+func heatmap(x float64) Vec3 {
+	x = clamp01(x) * float64(len(heatmapColors)-1)
+	i := minInt(int(x), len(heatmapColors)-2)
+	t := x - float64(i)
+
+	return heatmapColors[i].multiplyScalar(1 - t).add(heatmapColors[i+1].multiplyScalar(t))
 }
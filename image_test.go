@@ -0,0 +1,453 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"image/draw"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testFramebuffer(width, height int) []Vec3 {
+	framebuffer := make([]Vec3, width*height)
+
+	for i := range framebuffer {
+		framebuffer[i] = Vec3{float64(i) * 0.25, 1000 + float64(i), -float64(i)}
+	}
+
+	return framebuffer
+}
+
+// halfToFloat decodes the bits of a half precision value.
+func halfToFloat(bits uint16) float64 {
+	sign := 1.0
+
+	if bits&0x8000 != 0 {
+		sign = -1
+	}
+
+	exponent := int(bits>>10) & 0x1f
+	mantissa := float64(bits & 0x3ff)
+
+	switch exponent {
+	case 0:
+		return sign * math.Ldexp(mantissa, -24)
+	case 0x1f:
+		if mantissa != 0 {
+			return math.NaN()
+		}
+
+		return sign * math.Inf(1)
+	}
+
+	return sign * math.Ldexp(1+mantissa/1024, exponent-15)
+}
+
+// readEXR decodes the scanline blocks written by WriteEXRChannels into the values of
+// each channel, top row first.
+func readEXR(t *testing.T, data []byte, width, height int, compression EXRCompression) map[string][]float64 {
+	if binary.LittleEndian.Uint32(data) != 20000630 {
+		t.Fatalf("Bad magic number")
+	}
+
+	var names []string
+	var types []EXRPixelType
+
+	// Each attribute is a name, a type, a size and a value.
+	position := 8
+
+	for data[position] != 0 {
+		end := position + bytes.IndexByte(data[position:], 0)
+		name := string(data[position:end])
+		position = end + 1
+		position += bytes.IndexByte(data[position:], 0) + 1
+		size := int(binary.LittleEndian.Uint32(data[position:]))
+		position += 4
+
+		if name == "channels" {
+			for list := data[position : position+size]; list[0] != 0; {
+				end := bytes.IndexByte(list, 0)
+				names = append(names, string(list[:end]))
+				types = append(types, EXRPixelType(binary.LittleEndian.Uint32(list[end+1:])))
+				list = list[end+17:]
+			}
+		}
+
+		position += size
+	}
+
+	position++
+
+	linesPerBlock := compression.linesPerBlock()
+	blockCount := (height + linesPerBlock - 1) / linesPerBlock
+	channels := make(map[string][]float64)
+
+	for _, name := range names {
+		channels[name] = make([]float64, width*height)
+	}
+
+	for b := 0; b < blockCount; b++ {
+		offset := int(binary.LittleEndian.Uint64(data[position+8*b:]))
+		y0 := int(int32(binary.LittleEndian.Uint32(data[offset:])))
+		size := int(binary.LittleEndian.Uint32(data[offset+4:]))
+		block := data[offset+8 : offset+8+size]
+		lines := minInt(linesPerBlock, height-y0)
+		rawSize := 0
+
+		for _, pixelType := range types {
+			rawSize += lines * width * pixelType.size()
+		}
+
+		if size < rawSize {
+			reader, err := zlib.NewReader(bytes.NewReader(block))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			split, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 1; i < len(split); i++ {
+				split[i] = split[i-1] + split[i] - 128
+			}
+
+			block = make([]byte, len(split))
+			half := (len(split) + 1) / 2
+
+			for i := range block {
+				if i%2 == 0 {
+					block[i] = split[i/2]
+				} else {
+					block[i] = split[half+i/2]
+				}
+			}
+		}
+
+		if len(block) != rawSize {
+			t.Fatalf("Block %d has %d bytes, expected %d", b, len(block), rawSize)
+		}
+
+		for y := y0; y < y0+lines; y++ {
+			for c, name := range names {
+				for x := 0; x < width; x++ {
+					if types[c] == EXRHalf {
+						channels[name][y*width+x] = halfToFloat(binary.LittleEndian.Uint16(block))
+					} else {
+						channels[name][y*width+x] = float64(math.Float32frombits(binary.LittleEndian.Uint32(block)))
+					}
+
+					block = block[types[c].size():]
+				}
+			}
+		}
+	}
+
+	return channels
+}
+
+func TestWriteEXRRoundTrips(t *testing.T) {
+	width := 7
+	height := 19
+	framebuffer := testFramebuffer(width, height)
+
+	for _, pixelType := range []EXRPixelType{EXRHalf, EXRFloat} {
+		for _, compression := range []EXRCompression{EXRNoCompression, EXRZIPCompression} {
+			var output bytes.Buffer
+
+			if err := WriteEXR(&output, framebuffer, width, height, pixelType, compression); err != nil {
+				t.Fatal(err)
+			}
+
+			channels := readEXR(t, output.Bytes(), width, height, compression)
+
+			for i, expected := range framebuffer {
+				tolerance := 1e-6
+
+				if pixelType == EXRHalf {
+					tolerance = 1.0 / 1024
+				}
+
+				actual := Vec3{channels["R"][i], channels["G"][i], channels["B"][i]}
+
+				if expected.subtract(actual).length() > tolerance*expected.length() {
+					t.Fatalf("%v %v pixel %d: expected %v, got %v", pixelType, compression, i, expected, actual)
+				}
+			}
+		}
+	}
+}
+
+func TestFloat16(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected uint16
+	}{
+		{0, 0x0000},
+		{1, 0x3c00},
+		{-2, 0xc000},
+		{0.1, 0x2e66},
+		{65504, 0x7bff},
+		{65520, 0x7c00},
+		{1e10, 0x7c00},
+		{math.Inf(-1), 0xfc00},
+		{math.Ldexp(1, -24), 0x0001},
+		{math.Ldexp(1, -14), 0x0400},
+		{math.Ldexp(1, -26), 0x0000},
+		{1 + math.Ldexp(1, -11), 0x3c00},
+		{1 + 3*math.Ldexp(1, -11), 0x3c02},
+	}
+
+	for _, test := range tests {
+		if actual := float16(test.value); actual != test.expected {
+			t.Errorf("float16(%v) = %#04x, expected %#04x", test.value, actual, test.expected)
+		}
+	}
+
+	if actual := float16(math.NaN()); actual&0x7c00 != 0x7c00 || actual&0x3ff == 0 {
+		t.Errorf("Expected a NaN, got %#04x", actual)
+	}
+}
+
+func TestWriteHDR(t *testing.T) {
+	var output bytes.Buffer
+
+	framebuffer := []Vec3{{1, 0.5, 0.25}, {0, 0, 0}, {3000, -1, math.NaN()}}
+
+	if err := WriteHDR(&output, framebuffer, 3, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	header := "#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n-Y 1 +X 3\n"
+	data := output.Bytes()
+
+	if !bytes.HasPrefix(data, []byte(header)) {
+		t.Fatalf("Unexpected header %q", data)
+	}
+
+	pixels := data[len(header):]
+	expected := []byte{128, 64, 32, 129, 0, 0, 0, 0, 187, 0, 0, 140}
+
+	if !bytes.Equal(pixels, expected) {
+		t.Errorf("Expected RGBE pixels %v, got %v", expected, pixels)
+	}
+}
+
+func TestWritePFMStoresBottomRowFirst(t *testing.T) {
+	var output bytes.Buffer
+
+	framebuffer := []Vec3{{1, 2, 3}, {4, 5, 6}}
+
+	if err := WritePFM(&output, framebuffer, 1, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	header := "PF\n1 2\n-1.0\n"
+	data := output.Bytes()
+
+	if !bytes.HasPrefix(data, []byte(header)) {
+		t.Fatalf("Unexpected header %q", data)
+	}
+
+	values := make([]float32, 6)
+
+	if err := binary.Read(bytes.NewReader(data[len(header):]), binary.LittleEndian, values); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, expected := range []float32{4, 5, 6, 1, 2, 3} {
+		if values[i] != expected {
+			t.Errorf("Expected %v, got %v", []float32{4, 5, 6, 1, 2, 3}, values)
+
+			break
+		}
+	}
+}
+
+func TestFilmChannelsLayersAOVs(t *testing.T) {
+	film := NewFilm(2, 1, []AOV{AOVDepth, AOVObjectID, AOVUV})
+	path := PathRecord{hit: true, depth: 12.5, uv: Vec3{0.25, 0.75, 0}, objectID: 70000}
+
+	film.addSample(0, 0, Vec3{1, 2, 3}, &path)
+	film.addSample(1, 0, Vec3{4, 5, 6}, &PathRecord{})
+
+	var output bytes.Buffer
+
+	if err := WriteEXRChannels(&output, filmChannels(film, EXRHalf), 2, 1, EXRZIPCompression); err != nil {
+		t.Fatal(err)
+	}
+
+	channels := readEXR(t, output.Bytes(), 2, 1, EXRZIPCompression)
+
+	if len(channels) != 7 {
+		t.Errorf("Expected R, G, B, depth.Z, object-id.id, uv.U and uv.V, got %v", channels)
+	}
+
+	if channels["depth.Z"][0] != 12.5 || !math.IsInf(channels["depth.Z"][1], 1) {
+		t.Errorf("Unexpected depths %v", channels["depth.Z"])
+	}
+
+	if channels["object-id.id"][0] != 70000 || channels["object-id.id"][1] != 0 {
+		t.Errorf("Expected IDs to be stored exactly, got %v", channels["object-id.id"])
+	}
+
+	if channels["uv.U"][0] != 0.25 || channels["uv.V"][0] != 0.75 || channels["B"][1] != 6 {
+		t.Errorf("Unexpected channels %v", channels)
+	}
+}
+
+func TestAOVFilename(t *testing.T) {
+	if name := aovFilename("renders/out.png", AOVMaterialID); name != "renders/out.material-id.png" {
+		t.Errorf("Unexpected AOV filename %q", name)
+	}
+}
+
+func TestReadPFMRoundTrips(t *testing.T) {
+	var output bytes.Buffer
+
+	framebuffer := testFramebuffer(3, 2)
+
+	if err := WritePFM(&output, framebuffer, 3, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	actual, width, height, err := ReadPFM(&output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if width != 3 || height != 2 {
+		t.Fatalf("Expected 3x2, got %dx%d", width, height)
+	}
+
+	for i, pixel := range framebuffer {
+		if actual[i] != pixel {
+			t.Errorf("Pixel %d: expected %v, got %v", i, pixel, actual[i])
+		}
+	}
+}
+
+func TestReadPFMRejectsBadSizes(t *testing.T) {
+	var pixels bytes.Buffer
+
+	if err := WritePFM(&pixels, testFramebuffer(3, 2), 3, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	data := pixels.Bytes()[len("PF\n3 2\n-1.0\n"):]
+
+	for _, header := range []string{
+		"PF\n0 2\n-1.0\n",
+		"PF\n3 -2\n-1.0\n",
+		"PF\n3 3\n-1.0\n",
+		"PF\n2 2\n-1.0\n",
+		"PF\n9223372036854775807 9223372036854775807\n-1.0\n",
+	} {
+		if _, _, _, err := ReadPFM(bytes.NewReader(append([]byte(header), data...))); err == nil {
+			t.Errorf("Expected an error for header %q", header)
+		}
+	}
+
+	if _, _, _, err := ReadPFM(bytes.NewReader(append([]byte("PF\n3 2\n-1.0\n"), data[:len(data)-1]...))); err == nil {
+		t.Errorf("Expected an error for missing pixel data")
+	}
+}
+
+func TestWriteImageMergesCropIntoBase(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, extension := range []string{".png", ".pfm"} {
+		config := Config{width: 6, height: 4, filename: filepath.Join(dir, "full"+extension), dither: DitherOrdered}
+		full := NewFilm(6, 4, nil)
+
+		for i := range full.color {
+			full.addSample(i, 0, Vec3{float64(i) / 32, 0.5, 1}, nil)
+		}
+
+		if err := WriteImage(full, config); err != nil {
+			t.Fatal(err)
+		}
+
+		config.crop = CropWindow{2, 1, 5, 3, false}
+		config.cropBase = config.filename
+		config.filename = filepath.Join(dir, "merged"+extension)
+		crop := NewFilm(3, 2, nil)
+
+		for i := range crop.color {
+			crop.addSample(i, 0, Vec3{0, 0, 0}, nil)
+		}
+
+		if err := WriteImage(crop, config); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := full.Image()
+
+		for y := 1; y < 3; y++ {
+			for x := 2; x < 5; x++ {
+				expected[y*6+x] = Vec3{0, 0, 0}
+			}
+		}
+
+		if extension == ".pfm" {
+			actual := readPFMFile(t, config.filename)
+
+			for i := range expected {
+				if actual[i] != expected[i] {
+					t.Errorf("PFM pixel %d: expected %v, got %v", i, expected[i], actual[i])
+				}
+			}
+
+			continue
+		}
+
+		actual := readPNGFile(t, config.filename)
+		whole := ToneMapImage(expected, config)
+
+		if !bytes.Equal(actual.Pix, whole.Pix) {
+			t.Errorf("Expected the merged PNG to match tone mapping the whole frame")
+		}
+	}
+}
+
+func readPFMFile(t *testing.T, filename string) []Vec3 {
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	framebuffer, _, _, err := ReadPFM(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return framebuffer
+}
+
+func readPNGFile(t *testing.T, filename string) *image.NRGBA {
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	decoded, err := png.Decode(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nrgba := image.NewNRGBA(decoded.Bounds())
+	draw.Draw(nrgba, nrgba.Bounds(), decoded, decoded.Bounds().Min, draw.Src)
+
+	return nrgba
+}
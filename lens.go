@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"math"
+	"sort"
+)
+
+// Lens describes the thin lens of a PerspectiveCamera beyond its aperture size. The
+// zero Lens has a round aperture and a focal plane square to the view.
+type Lens struct {
+	// blades gives a polygonal aperture of that many sides, from three up.
+	blades int
+	// rotation turns a polygonal or masked aperture, in radians.
+	rotation float64
+	// mask, when set, shapes the aperture instead, and so the bokeh.
+	mask *ApertureMask
+	// catsEye is how far the lens barrel clips the aperture at the corners of the image,
+	// in aperture radii, narrowing out of focus highlights there to cat's eyes and
+	// darkening the corners.
+	catsEye float64
+	// tilt turns the focal plane by that many radians about an axis across the image,
+	// at tiltRotation radians from horizontal.
+	tilt         float64
+	tiltRotation float64
+	// shiftX and shiftY move the image across the focal plane, in image widths and
+	// heights, without turning the camera.
+	shiftX float64
+	shiftY float64
+	// squeeze narrows the aperture horizontally, giving the tall out of focus
+	// highlights of an anamorphic lens. One, or zero, leaves it round.
+	squeeze float64
+}
+
+// aperture returns a point on the aperture, within the unit disk unless masked, from
+// two of the sampler's dimensions.
+func (l Lens) aperture(sampler Sampler) Vec3 {
+	var p Vec3
+
+	switch {
+	case l.mask != nil:
+		p = l.mask.sample(sampler)
+	case l.blades >= 3:
+		p = randomInPolygon(l.blades, sampler)
+	default:
+		return l.squeezed(RandomInUnitDisk(sampler))
+	}
+
+	if l.rotation != 0 {
+		sin, cos := math.Sincos(l.rotation)
+		p = Vec3{p.x()*cos - p.y()*sin, p.x()*sin + p.y()*cos, 0}
+	}
+
+	return l.squeezed(p)
+}
+
+func (l Lens) squeezed(p Vec3) Vec3 {
+	if l.squeeze > 0 && l.squeeze != 1 {
+		return Vec3{p.x() / l.squeeze, p.y(), 0}
+	}
+
+	return p
+}
+
+// vignetted reports whether the lens barrel blocks the point p of the aperture, seen
+// from s, t on an image of the aspect ratio. The barrel is a circle the size of the
+// aperture, moved off it by catsEye radii at the corners of the image.
+func (l Lens) vignetted(p Vec3, s, t, aspect float64) bool {
+	if l.catsEye <= 0 {
+		return false
+	}
+
+	diagonal := math.Hypot(aspect, 1)
+	x := (2*s - 1) * aspect / diagonal
+	y := (2*t - 1) / diagonal
+
+	return math.Hypot(p.x()+l.catsEye*x, p.y()+l.catsEye*y) > 1
+}
+
+// randomInPolygon returns a uniformly random point within the regular polygon of n
+// sides inscribed in the unit circle, with a corner on the x axis. The first dimension
+// picks the triangle from the center to a side and is then reused within it.
+func randomInPolygon(n int, sampler Sampler) Vec3 {
+	u, along := Float64Pair(sampler)
+	u *= float64(n)
+	side := math.Floor(u)
+	out := math.Sqrt(u - side)
+
+	a0 := 2 * math.Pi * side / float64(n)
+	a1 := 2 * math.Pi * (side + 1) / float64(n)
+
+	return Vec3{
+		out * ((1-along)*math.Cos(a0) + along*math.Cos(a1)),
+		out * ((1-along)*math.Sin(a0) + along*math.Sin(a1)),
+		0,
+	}
+}
+
+// ApertureMask is an image of the aperture, whose brightness is how much light each
+// part of it lets through. The image covers the square around the unit disk.
+type ApertureMask struct {
+	width  int
+	height int
+	rows   []float64
+	cells  [][]float64
+}
+
+// NewApertureMask returns an ApertureMask of the image.
+func NewApertureMask(img image.Image) (*ApertureMask, error) {
+	bounds := img.Bounds()
+	m := &ApertureMask{
+		width:  bounds.Dx(),
+		height: bounds.Dy(),
+		rows:   make([]float64, bounds.Dy()),
+		cells:  make([][]float64, bounds.Dy()),
+	}
+
+	total := 0.0
+
+	// Each row holds the running total of its pixels, and rows the running total of the
+	// rows, so that samples can be drawn by searching them.
+	for y := 0; y < m.height; y++ {
+		row := make([]float64, m.width)
+		sum := 0.0
+
+		for x := 0; x < m.width; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			sum += 0.2126*float64(r) + 0.7152*float64(g) + 0.0722*float64(b)
+			row[x] = sum
+		}
+
+		total += sum
+		m.rows[y] = total
+		m.cells[y] = row
+	}
+
+	if total == 0 {
+		return nil, errors.New("aperture mask is black")
+	}
+
+	return m, nil
+}
+
+// LoadApertureMask reads an ApertureMask from an image file.
+func LoadApertureMask(filename string) (*ApertureMask, error) {
+	img, err := LoadImage(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewApertureMask(img)
+}
+
+// sample returns a point on the mask, more often where it is brighter, from two of the
+// sampler's dimensions.
+func (m *ApertureMask) sample(sampler Sampler) Vec3 {
+	u, v := Float64Pair(sampler)
+	y, fy := sampleRunningTotal(m.rows, u)
+	x, fx := sampleRunningTotal(m.cells[y], v)
+
+	return Vec3{
+		2*(float64(x)+fx)/float64(m.width) - 1,
+		1 - 2*(float64(y)+fy)/float64(m.height),
+		0,
+	}
+}
+
+// sampleRunningTotal picks an entry of the running totals in proportion to its share of
+// the last, and where u fell within it.
+func sampleRunningTotal(totals []float64, u float64) (int, float64) {
+	total := totals[len(totals)-1]
+	target := math.Min(u*total, math.Nextafter(total, 0))
+	i := sort.Search(len(totals), func(i int) bool { return totals[i] > target })
+
+	before := 0.0
+
+	if i > 0 {
+		before = totals[i-1]
+	}
+
+	return i, math.Min((target-before)/(totals[i]-before), math.Nextafter(1, 0))
+}
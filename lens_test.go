@@ -0,0 +1,118 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestPolygonalAperture(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	lens := Lens{blades: 5, rotation: 0.3, squeeze: 2}
+
+	var mean Vec3
+
+	for i := 0; i < 10000; i++ {
+		p := lens.aperture(rng)
+		mean = mean.add(p)
+
+		// Undo the squeeze and the rotation, then check every side of the pentagon.
+		x := p.x() * 2
+		sin, cos := math.Sincos(-0.3)
+		x, y := x*cos-p.y()*sin, x*sin+p.y()*cos
+
+		for side := 0; side < 5; side++ {
+			normal := 2*math.Pi*float64(side)/5 + math.Pi/5
+
+			if x*math.Cos(normal)+y*math.Sin(normal) > math.Cos(math.Pi/5)+1e-12 {
+				t.Fatalf("%v is outside the pentagon", p)
+			}
+		}
+	}
+
+	if mean.multiplyScalar(1.0/10000).length() > 0.02 {
+		t.Errorf("Aperture samples are off center, averaging %v", mean.multiplyScalar(1.0/10000))
+	}
+}
+
+func TestApertureMask(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	img := image.NewGray(image.Rect(0, 0, 4, 4))
+
+	// Only the top right pixel lets light through.
+	img.Set(3, 0, color.Gray{255})
+
+	mask, err := NewApertureMask(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		if p := mask.sample(rng); p.x() < 0.5 || p.x() >= 1 || p.y() <= 0.5 || p.y() > 1 {
+			t.Fatalf("%v is outside the only bright pixel", p)
+		}
+	}
+
+	if _, err := NewApertureMask(image.NewGray(image.Rect(0, 0, 2, 2))); err == nil {
+		t.Errorf("Expected an error for a black mask")
+	}
+}
+
+func TestCatsEye(t *testing.T) {
+	lens := Lens{catsEye: 0.5}
+
+	if lens.vignetted(Vec3{0.99, 0, 0}, 0.5, 0.5, 2) {
+		t.Errorf("The barrel should not clip the center of the image")
+	}
+
+	// At the top right corner the barrel moves down and left, clipping the top right of
+	// the aperture but not the bottom left.
+	if !lens.vignetted(Vec3{0.7, 0.7, 0}, 1, 1, 2) || lens.vignetted(Vec3{-0.7, -0.7, 0}, 1, 1, 2) {
+		t.Errorf("Expected the barrel to clip the aperture towards the corner")
+	}
+}
+
+func TestTiltShift(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	camera := NewPerspectiveCamera(Vec3{0, 0, 0}, Vec3{0, 0, -1}, Vec3{0, 1, 0}, 60, 1, 2, 10, NewShutter(0, 1, nil, 0))
+	tilted := camera.withLens(Lens{tilt: math.Pi / 6})
+
+	// Every ray through a point of the image meets at the same point of the focal plane,
+	// which is nearer at the top.
+	focus := func(camera PerspectiveCamera, s, v float64) Vec3 {
+		r, _ := camera.getRay(s, v, rng)
+		point := r.pointAtParameter(1)
+
+		for i := 0; i < 10; i++ {
+			if r, _ := camera.getRay(s, v, rng); r.pointAtParameter(1).subtract(point).length() > 1e-9 {
+				t.Fatalf("Rays through %v, %v focus at %v and %v", s, v, point, r.pointAtParameter(1))
+			}
+		}
+
+		return point
+	}
+
+	if center := focus(tilted, 0.5, 0.5); center.subtract(Vec3{0, 0, -10}).length() > 1e-9 {
+		t.Errorf("The tilted focal plane should still pass through the focus point, got %v", center)
+	}
+
+	top := focus(tilted, 0.5, 0.9)
+	bottom := focus(tilted, 0.5, 0.1)
+
+	if -top.z() >= 10 || -bottom.z() <= 10 {
+		t.Errorf("Expected the top of the focal plane nearer, got %v at the top and %v at the bottom", top, bottom)
+	}
+
+	if plane := (Vec3{0, math.Sin(math.Pi / 6), -math.Cos(math.Pi / 6)}); math.Abs(top.subtract(Vec3{0, 0, -10}).dot(plane)) > 1e-9 {
+		t.Errorf("%v is not on the tilted focal plane", top)
+	}
+
+	// Shifting up half the image puts the old top edge at the center.
+	shifted := camera.withLens(Lens{shiftY: 0.5})
+
+	if a, b := focus(shifted, 0.5, 0.5), focus(camera, 0.5, 1); a.subtract(b).length() > 1e-9 {
+		t.Errorf("Shifted center focuses at %v, expected %v", a, b)
+	}
+}
@@ -1,35 +1,136 @@
 package main
 
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+)
+
 func main() {
-	config := Config{
-		width:     500,
-		height:    500,
-		samples:   1000,
-		from:      Vec3{278, 278, -800},
-		at:        Vec3{278, 278, 0},
-		up:        Vec3{0, 1, 0},
-		fov:       40.0,
-		aperture:  0.00,
-		filename:  "output.png",
-		timeStart: 0,
-		timeEnd:   1,
-	}
-
-	world, lightShapes := CornellBox(config)
-
-	camera := NewCamera(
-		config.from,
-		config.at,
-		config.up,
-		config.fov,
-		config.aspectRatio(),
-		config.aperture,
-		config.focusDistance(),
-		config.timeStart,
-		config.timeEnd,
-	)
-
-	framebuffer := Render(camera, world, lightShapes, config)
-
-	WriteImage(&framebuffer, config)
+	if len(os.Args) > 1 && os.Args[1] == "list-scenes" {
+		ListScenes(os.Stdout)
+
+		return
+	}
+
+	scene, err := ParseCommandLine(os.Args[1:], os.Stderr)
+
+	if err == flag.ErrHelp {
+		return
+	}
+
+	if err == errFlagsReported {
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	config := scene.config
+
+	// Interrupting stops the render, saving what there is when rendering progressively.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var progress func(Progress)
+
+	if config.progress && isTerminal(os.Stderr) {
+		progress = ProgressBar(os.Stderr, 100*time.Millisecond)
+	}
+
+	first, last := 0, 0
+
+	if config.sequence {
+		first, last = config.frameStart, config.frameEnd
+	}
+
+	for n := first; n <= last; n++ {
+		frame := scene
+
+		if config.sequence {
+			frame, err = scene.frame(n)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			if config.progress {
+				fmt.Fprintf(os.Stderr, "rendering %s\n", frame.config.filename)
+			}
+		}
+
+		interrupted, err := renderImage(ctx, frame, progress)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		if interrupted {
+			fmt.Fprintln(os.Stderr, "interrupted, saved the render so far")
+			os.Exit(130)
+		}
+	}
+}
+
+// renderImage renders and saves one image of the scene, reporting whether it was
+// interrupted. An interrupted progressive render saves what there is.
+func renderImage(ctx context.Context, scene Scene, progress func(Progress)) (bool, error) {
+	config := scene.config
+
+	var film *Film
+	var err error
+
+	if config.passSamples > 0 {
+		film = config.film()
+
+		if config.resume {
+			film, err = LoadCheckpoint(config.checkpoint, config)
+		}
+
+		if err == nil {
+			err = RenderProgressive(ctx, film, config.camera(), scene.world, scene.lightShapes, config, func(film *Film) error {
+				return save(film, config)
+			}, progress)
+		}
+	} else {
+		film, err = RenderContext(ctx, config.camera(), scene.world, scene.lightShapes, config, progress)
+	}
+
+	if progress != nil {
+		fmt.Fprintln(os.Stderr)
+	}
+
+	interrupted := errors.Is(err, context.Canceled)
+
+	if err != nil && !(interrupted && config.passSamples > 0) {
+		return interrupted, err
+	}
+
+	return interrupted, save(film, config)
+}
+
+// isTerminal reports whether the file is a terminal rather than a pipe or a file.
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// save writes the image, and the checkpoint when there is one.
+func save(film *Film, config Config) error {
+	if err := WriteImage(film, config); err != nil {
+		return err
+	}
+
+	if config.checkpoint != "" {
+		return SaveCheckpoint(config.checkpoint, film, config)
+	}
+
+	return nil
 }
@@ -1,21 +1,46 @@
 package main
 
-import (
-	"math"
-)
+import "math"
 
 // Material represents different materials hitable objects can be made from.
 type Material interface {
-	scatter(rayIn Ray, hit Hit) (didScatter bool, scatter Scatter)
+	scatter(rayIn Ray, hit Hit, sampler Sampler) (didScatter bool, scatter Scatter)
 	scatteringPdf(rayIn Ray, hit Hit, scattered Ray) float64
 	emitted(rayIn Ray, hit Hit, u, v float64, p Vec3) Vec3
+	albedoAt(rayIn Ray, hit Hit) Vec3
+}
+
+// MaterialID tags a Material with an ID for the material ID AOV.
+type MaterialID struct {
+	Material
+	id int
+}
+
+// materialID returns the ID of a tagged Material, or zero.
+func materialID(material Material) int {
+	if tagged, ok := material.(MaterialID); ok {
+		return tagged.id
+	}
+
+	return 0
+}
+
+// materialIDs numbers Materials for the material ID AOV in the order they are tagged,
+// as the built-in scenes do with the materials they make.
+type materialIDs int
+
+// tag returns the Material tagged with the next ID.
+func (ids *materialIDs) tag(material Material) Material {
+	*ids++
+
+	return MaterialID{material, int(*ids)}
 }
 
 // MaterialZero represents a blank material.
 type MaterialZero struct {
 }
 
-func (mz MaterialZero) scatter(rayIn Ray, hit Hit) (didScatter bool, scatter Scatter) {
+func (mz MaterialZero) scatter(rayIn Ray, hit Hit, sampler Sampler) (didScatter bool, scatter Scatter) {
 	return false, Scatter{}
 }
 
@@ -27,6 +52,10 @@ func (mz MaterialZero) emitted(rayIn Ray, hit Hit, u, v float64, p Vec3) Vec3 {
 	return Vec3Zero()
 }
 
+func (mz MaterialZero) albedoAt(rayIn Ray, hit Hit) Vec3 {
+	return Vec3Zero()
+}
+
 // Lambertian is a diffuse Material.
 type Lambertian struct {
 	albedo Texture
@@ -37,7 +66,7 @@ func NewLambertian(albedo Texture) Lambertian {
 	return Lambertian{albedo}
 }
 
-func (l Lambertian) scatter(rayIn Ray, hit Hit) (didScatter bool, scatter Scatter) {
+func (l Lambertian) scatter(rayIn Ray, hit Hit, sampler Sampler) (didScatter bool, scatter Scatter) {
 	isSpecular := false
 	attenuation := l.albedo.value(hit.u, hit.v, hit.p)
 	pdf := NewCosinePdf(hit.normal)
@@ -59,6 +88,10 @@ func (l Lambertian) emitted(rayIn Ray, hit Hit, u, v float64, p Vec3) Vec3 {
 	return EmitBlack()
 }
 
+func (l Lambertian) albedoAt(rayIn Ray, hit Hit) Vec3 {
+	return l.albedo.value(hit.u, hit.v, hit.p)
+}
+
 // Metal is a reflective Material.
 type Metal struct {
 	albedo Vec3
@@ -78,10 +111,10 @@ func NewMetal(albedo Vec3, fuzz float64) Metal {
 	return Metal{albedo, f}
 }
 
-func (m Metal) scatter(rayIn Ray, hit Hit) (didScatter bool, scatter Scatter) {
+func (m Metal) scatter(rayIn Ray, hit Hit, sampler Sampler) (didScatter bool, scatter Scatter) {
 	reflected := rayIn.direction().unitVector().reflect(hit.normal)
 
-	specularRay := Ray{hit.p, reflected.add(RandomInUnitSphere().multiplyScalar(m.fuzz)), rayIn.time()}
+	specularRay := Ray{hit.p, reflected.add(RandomInUnitSphere(sampler).multiplyScalar(m.fuzz)), rayIn.time()}
 	isSpecular := true
 	attenuation := m.albedo
 	pdf := PdfZero{}
@@ -97,6 +130,10 @@ func (m Metal) emitted(rayIn Ray, hit Hit, u, v float64, p Vec3) Vec3 {
 	return EmitBlack()
 }
 
+func (m Metal) albedoAt(rayIn Ray, hit Hit) Vec3 {
+	return m.albedo
+}
+
 // Dielectric is a material that refracts.
 type Dielectric struct {
 	reflectiveIndex float64
@@ -107,8 +144,46 @@ func NewDielectric(reflectiveIndex float64) Dielectric {
 	return Dielectric{reflectiveIndex}
 }
 
-func (d Dielectric) scatter(rayIn Ray, hit Hit) (didScatter bool, scatter Scatter) {
-	return true, Scatter{Ray{}, true, Vec3{}, NewCosinePdf(Vec3Zero())}
+// scatter either reflects or refracts, choosing between the two by their Fresnel
+// reflectance. A normal facing along the ray means it is leaving the material, which
+// is also how the inverted normals of negative radius Spheres make hollow glass.
+func (d Dielectric) scatter(rayIn Ray, hit Hit, sampler Sampler) (didScatter bool, scatter Scatter) {
+	direction := rayIn.direction().unitVector()
+	reflected := direction.reflect(hit.normal)
+
+	var outwardNormal Vec3
+	var niOverNt float64
+	var cosine float64
+
+	if direction.dot(hit.normal) > 0 {
+		outwardNormal = hit.normal.negate()
+		niOverNt = d.reflectiveIndex
+		cosine = direction.dot(hit.normal)
+	} else {
+		outwardNormal = hit.normal
+		niOverNt = 1.0 / d.reflectiveIndex
+		cosine = -direction.dot(hit.normal)
+	}
+
+	attenuation := Vec3{1, 1, 1}
+	pdf := PdfZero{}
+
+	didRefract, refracted := direction.refract(outwardNormal, niOverNt)
+
+	if !didRefract {
+		return true, Scatter{Ray{hit.p, reflected, rayIn.time()}, true, attenuation, pdf}
+	}
+
+	// Schlick expects the cosine on the outside of the material.
+	if niOverNt > 1 {
+		cosine = math.Sqrt(1 - niOverNt*niOverNt*(1-cosine*cosine))
+	}
+
+	if sampler.Float64() < Schlick(cosine, d.reflectiveIndex) {
+		return true, Scatter{Ray{hit.p, reflected, rayIn.time()}, true, attenuation, pdf}
+	}
+
+	return true, Scatter{Ray{hit.p, *refracted, rayIn.time()}, true, attenuation, pdf}
 }
 
 func (d Dielectric) scatteringPdf(rayIn Ray, hit Hit, scattered Ray) float64 {
@@ -119,12 +194,16 @@ func (d Dielectric) emitted(rayIn Ray, hit Hit, u, v float64, p Vec3) Vec3 {
 	return EmitBlack()
 }
 
+func (d Dielectric) albedoAt(rayIn Ray, hit Hit) Vec3 {
+	return Vec3{1, 1, 1}
+}
+
 // DiffuseLight is a material that acts as a diffused light.
 type DiffuseLight struct {
 	emit Texture
 }
 
-func (dl DiffuseLight) scatter(rayIn Ray, hit Hit) (didScatter bool, scatter Scatter) {
+func (dl DiffuseLight) scatter(rayIn Ray, hit Hit, sampler Sampler) (didScatter bool, scatter Scatter) {
 	return false, Scatter{Ray{}, true, Vec3{}, NewCosinePdf(Vec3Zero())}
 }
 
@@ -140,19 +219,31 @@ func (dl DiffuseLight) emitted(rayIn Ray, hit Hit, u, v float64, p Vec3) Vec3 {
 	return EmitBlack()
 }
 
+func (dl DiffuseLight) albedoAt(rayIn Ray, hit Hit) Vec3 {
+	return dl.emit.value(hit.u, hit.v, hit.p)
+}
+
 // Isotropic has a scattering function that picks a uniform random direction.
 type Isotropic struct {
 	albedo Texture
 }
 
-func (it Isotropic) scatter(rayIn Ray, hit Hit) (didScatter bool, scatter Scatter) {
-	return true, Scatter{Ray{}, true, Vec3{}, NewCosinePdf(Vec3Zero())}
+func (it Isotropic) scatter(rayIn Ray, hit Hit, sampler Sampler) (didScatter bool, scatter Scatter) {
+	isSpecular := false
+	attenuation := it.albedo.value(hit.u, hit.v, hit.p)
+	pdf := SpherePdf{}
+
+	return true, Scatter{Ray{}, isSpecular, attenuation, pdf}
 }
 
 func (it Isotropic) scatteringPdf(rayIn Ray, hit Hit, scattered Ray) float64 {
-	return 0
+	return 1 / (4 * math.Pi)
 }
 
 func (it Isotropic) emitted(rayIn Ray, hit Hit, u, v float64, p Vec3) Vec3 {
 	return EmitBlack()
 }
+
+func (it Isotropic) albedoAt(rayIn Ray, hit Hit) Vec3 {
+	return it.albedo.value(hit.u, hit.v, hit.p)
+}
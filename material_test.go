@@ -0,0 +1,78 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDielectricTotalInternalReflection(t *testing.T) {
+	glass := NewDielectric(1.5)
+	rng := NewRand(1)
+
+	// Leaving the glass at 60 degrees is past the critical angle of about 42 degrees.
+	direction := Vec3{math.Sin(math.Pi / 3), math.Cos(math.Pi / 3), 0}
+	hit := Hit{p: Vec3Zero(), normal: Vec3{0, 1, 0}, material: glass}
+
+	for i := 0; i < 100; i++ {
+		didScatter, scatter := glass.scatter(Ray{Vec3{0, -1, 0}, direction, 0}, hit, rng)
+
+		if !didScatter || !scatter.isSpecular {
+			t.Fatalf("Dielectric did not scatter specularly")
+		}
+
+		if scatter.specularRay.direction().y() >= 0 {
+			t.Fatalf("Expected reflection back into the glass, got %v", scatter.specularRay.direction())
+		}
+	}
+}
+
+func TestDielectricRefractsAtNormalIncidence(t *testing.T) {
+	glass := NewDielectric(1.5)
+	rng := NewRand(1)
+
+	hit := Hit{p: Vec3Zero(), normal: Vec3{0, 1, 0}, material: glass}
+	refracted := 0
+
+	for i := 0; i < 1000; i++ {
+		_, scatter := glass.scatter(Ray{Vec3{0, 1, 0}, Vec3{0, -1, 0}, 0}, hit, rng)
+
+		if scatter.specularRay.direction().y() < 0 {
+			refracted++
+		}
+	}
+
+	// Head-on reflectance for glass is 4%.
+	if refracted < 900 || refracted > 990 {
+		t.Errorf("Expected about 960 of 1000 rays to refract, got %d", refracted)
+	}
+}
+
+func TestIsotropicScatter(t *testing.T) {
+	albedo := Vec3{0.5, 0.25, 1}
+	smoke := Isotropic{ConstantTexture{albedo}}
+	rng := NewRand(1)
+
+	hit := Hit{p: Vec3Zero(), normal: Vec3{1, 0, 0}, material: smoke}
+	didScatter, scatter := smoke.scatter(Ray{Vec3{-1, 0, 0}, Vec3{1, 0, 0}, 0}, hit, rng)
+
+	if !didScatter || scatter.isSpecular {
+		t.Fatalf("Isotropic should scatter diffusely")
+	}
+
+	if scatter.attenuation != albedo {
+		t.Errorf("Attenuation %v != %v", scatter.attenuation, albedo)
+	}
+
+	for i := 0; i < 100; i++ {
+		direction := scatter.pdf.generate(rng)
+		scattered := Ray{hit.p, direction, 0}
+
+		if math.Abs(direction.length()-1) > 1e-9 {
+			t.Fatalf("Expected a unit direction, got %v", direction)
+		}
+
+		if scatter.pdf.value(direction) != smoke.scatteringPdf(Ray{}, hit, scattered) {
+			t.Fatalf("Sampling and scattering PDFs disagree")
+		}
+	}
+}
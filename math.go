@@ -1,17 +1,14 @@
 package main
 
-import (
-	"math"
-	"math/rand"
-)
+import "math"
 
 // RandomInUnitSphere returns a random Vector within the unit sphere.
-func RandomInUnitSphere() Vec3 {
+func RandomInUnitSphere(sampler Sampler) Vec3 {
 	for {
 		p := Vec3{
-			rand.Float64(),
-			rand.Float64(),
-			rand.Float64(),
+			sampler.Float64(),
+			sampler.Float64(),
+			sampler.Float64(),
 		}.multiplyScalar(2.0).subtract(Vec3{1.0, 1.0, 1.0})
 
 		if p.squaredLength() < 1.0 {
@@ -20,10 +17,19 @@ func RandomInUnitSphere() Vec3 {
 	}
 }
 
+// RandomOnUnitSphere returns a uniformly distributed random unit Vector.
+func RandomOnUnitSphere(sampler Sampler) Vec3 {
+	u, v := Float64Pair(sampler)
+	z := 1 - 2*u
+	r := math.Sqrt(1 - z*z)
+	phi := 2 * math.Pi * v
+
+	return Vec3{r * math.Cos(phi), r * math.Sin(phi), z}
+}
+
 // RandomToSphere :)
-func RandomToSphere(radius, distanceSquared float64) Vec3 {
-	r1 := rand.Float64()
-	r2 := rand.Float64()
+func RandomToSphere(radius, distanceSquared float64, sampler Sampler) Vec3 {
+	r1, r2 := Float64Pair(sampler)
 	phi := 2 * math.Pi * r1
 
 	z := 1 + r2*(math.Sqrt(1-radius*radius/distanceSquared)-1)
@@ -34,19 +40,27 @@ func RandomToSphere(radius, distanceSquared float64) Vec3 {
 	return Vec3{x, y, z}
 }
 
-// RandomInUnitDisk returns a random Vector within the unit disk.
-func RandomInUnitDisk() Vec3 {
-	for {
-		p := Vec3{
-			rand.Float64(),
-			rand.Float64(),
-			0,
-		}.multiplyScalar(2.0).subtract(Vec3{1.0, 1.0, 0})
+// RandomInUnitDisk returns a random Vector within the unit disk. It maps the square
+// onto the disk concentrically rather than rejecting points outside it, so that it always
+// takes two dimensions and keeps stratified samples stratified.
+func RandomInUnitDisk(sampler Sampler) Vec3 {
+	u, v := Float64Pair(sampler)
+	x := 2*u - 1
+	y := 2*v - 1
 
-		if p.dot(p) < 1.0 {
-			return p
-		}
+	if x == 0 && y == 0 {
+		return Vec3{0, 0, 0}
+	}
+
+	if math.Abs(x) > math.Abs(y) {
+		phi := math.Pi / 4 * y / x
+
+		return Vec3{x * math.Cos(phi), x * math.Sin(phi), 0}
 	}
+
+	phi := math.Pi/2 - math.Pi/4*x/y
+
+	return Vec3{y * math.Cos(phi), y * math.Sin(phi), 0}
 }
 
 // Schlick calculates an approximation of reflectivity varied by angle.
@@ -98,9 +112,8 @@ func GetSphereUV(p Vec3) (u, v float64) {
 }
 
 // RandomCosineDirection generates a random cosine direction as a Vec3.
-func RandomCosineDirection() Vec3 {
-	r1 := rand.Float64()
-	r2 := rand.Float64()
+func RandomCosineDirection(sampler Sampler) Vec3 {
+	r1, r2 := Float64Pair(sampler)
 
 	phi := 2 * math.Pi * r1
 
@@ -110,3 +123,19 @@ func RandomCosineDirection() Vec3 {
 
 	return Vec3{x, y, z}
 }
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
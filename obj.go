@@ -0,0 +1,512 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// OBJModel is a Wavefront OBJ model, ready to add to a scene.
+type OBJModel struct {
+	hitable Hitable
+	meshes  []*TriangleMesh
+	lights  HitableList
+	// materials is how many material IDs the model's materials were tagged with.
+	materials int
+	// files are the OBJ, MTL and texture files the model was read from.
+	files []string
+}
+
+// objVertex indexes the position, texture coordinate and normal of a face corner.
+// Missing texture coordinates and normals are -1.
+type objVertex [3]int
+
+// objMesh collects the faces of one group that share a material.
+type objMesh struct {
+	material string
+	vertices map[objVertex]int
+	corners  []objVertex
+	indices  []int
+}
+
+type objParser struct {
+	filename  string
+	line      int
+	positions []Vec3
+	uvs       []Vec3
+	normals   []Vec3
+	materials map[string]Material
+	meshes    []*objMesh
+	current   map[string]*objMesh
+	group     string
+	material  string
+	files     []string
+}
+
+// LoadOBJ reads a Wavefront OBJ file and the MTL files it references. Each group is split
+// into a TriangleMesh per material, and all of them are put into one BVHNode. The
+// materials are tagged for the material ID AOV in the order they are first used,
+// counting from firstMaterialID.
+func LoadOBJ(filename string, firstMaterialID int) (OBJModel, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return OBJModel{}, err
+	}
+	defer file.Close()
+
+	parser := objParser{
+		filename:  filename,
+		materials: make(map[string]Material),
+		current:   make(map[string]*objMesh),
+		files:     []string{filename},
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		parser.line++
+
+		if err := parser.parseLine(scanner.Text()); err != nil {
+			return OBJModel{}, err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return OBJModel{}, err
+	}
+
+	return parser.model(firstMaterialID)
+}
+
+func (p *objParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s:%d: %s", p.filename, p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *objParser) parseLine(line string) error {
+	if comment := strings.IndexByte(line, '#'); comment >= 0 {
+		line = line[:comment]
+	}
+
+	fields := strings.Fields(line)
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	switch fields[0] {
+	case "v":
+		v, err := p.floats(fields[1:], 3, 4)
+		if err != nil {
+			return err
+		}
+
+		p.positions = append(p.positions, Vec3{v[0], v[1], v[2]})
+	case "vt":
+		vt, err := p.floats(fields[1:], 1, 3)
+		if err != nil {
+			return err
+		}
+
+		vt = append(vt, 0)
+		p.uvs = append(p.uvs, Vec3{vt[0], vt[1], 0})
+	case "vn":
+		vn, err := p.floats(fields[1:], 3, 3)
+		if err != nil {
+			return err
+		}
+
+		p.normals = append(p.normals, Vec3{vn[0], vn[1], vn[2]})
+	case "f":
+		return p.face(fields[1:])
+	case "g", "o":
+		p.group = strings.Join(fields[1:], " ")
+		p.current = make(map[string]*objMesh)
+	case "usemtl":
+		if len(fields) < 2 {
+			return p.errorf("usemtl needs a material name")
+		}
+
+		p.material = strings.Join(fields[1:], " ")
+
+		if _, found := p.materials[p.material]; !found {
+			return p.errorf("unknown material %q", p.material)
+		}
+	case "mtllib":
+		for _, name := range fields[1:] {
+			mtl := filepath.Join(filepath.Dir(p.filename), name)
+
+			files, err := loadMTL(mtl, p.materials)
+			if err != nil {
+				return err
+			}
+
+			p.files = append(p.files, files...)
+		}
+	}
+
+	// Smoothing groups, lines, points and free-form geometry are ignored.
+	return nil
+}
+
+func (p *objParser) floats(fields []string, min, max int) ([]float64, error) {
+	if len(fields) < min || len(fields) > max {
+		return nil, p.errorf("expected %d to %d numbers, got %d", min, max, len(fields))
+	}
+
+	values := make([]float64, len(fields))
+
+	for i, field := range fields {
+		value, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, p.errorf("%q is not a number", field)
+		}
+
+		values[i] = value
+	}
+
+	return values, nil
+}
+
+// index resolves a 1-based or negative relative OBJ index into a 0-based one.
+func (p *objParser) index(field string, count int, kind string) (int, error) {
+	index, err := strconv.Atoi(field)
+	if err != nil {
+		return 0, p.errorf("%q is not a %s index", field, kind)
+	}
+
+	if index < 0 {
+		index += count
+	} else {
+		index--
+	}
+
+	if index < 0 || index >= count {
+		return 0, p.errorf("%s index %s is out of range", kind, field)
+	}
+
+	return index, nil
+}
+
+// face triangulates a polygon as a fan around its first corner.
+func (p *objParser) face(fields []string) error {
+	if len(fields) < 3 {
+		return p.errorf("a face needs at least 3 vertices, got %d", len(fields))
+	}
+
+	corners := make([]objVertex, len(fields))
+
+	for i, field := range fields {
+		parts := strings.Split(field, "/")
+
+		if len(parts) > 3 {
+			return p.errorf("bad face vertex %q", field)
+		}
+
+		corner := objVertex{-1, -1, -1}
+
+		position, err := p.index(parts[0], len(p.positions), "position")
+		if err != nil {
+			return err
+		}
+
+		corner[0] = position
+
+		if len(parts) > 1 && parts[1] != "" {
+			if corner[1], err = p.index(parts[1], len(p.uvs), "texture coordinate"); err != nil {
+				return err
+			}
+		}
+
+		if len(parts) > 2 && parts[2] != "" {
+			if corner[2], err = p.index(parts[2], len(p.normals), "normal"); err != nil {
+				return err
+			}
+		}
+
+		corners[i] = corner
+	}
+
+	mesh := p.mesh()
+
+	for i := 1; i+1 < len(corners); i++ {
+		mesh.add(corners[0])
+		mesh.add(corners[i])
+		mesh.add(corners[i+1])
+	}
+
+	return nil
+}
+
+// mesh returns the mesh for the current group and material.
+func (p *objParser) mesh() *objMesh {
+	mesh, found := p.current[p.material]
+
+	if !found {
+		mesh = &objMesh{
+			material: p.material,
+			vertices: make(map[objVertex]int),
+		}
+
+		p.current[p.material] = mesh
+		p.meshes = append(p.meshes, mesh)
+	}
+
+	return mesh
+}
+
+func (m *objMesh) add(corner objVertex) {
+	index, found := m.vertices[corner]
+
+	if !found {
+		index = len(m.corners)
+		m.vertices[corner] = index
+		m.corners = append(m.corners, corner)
+	}
+
+	m.indices = append(m.indices, index)
+}
+
+func (p *objParser) model(firstMaterialID int) (OBJModel, error) {
+	var model OBJModel
+
+	triangles := NewHitableList(0)
+	ids := make(map[string]int)
+
+	for _, mesh := range p.meshes {
+		material, found := p.materials[mesh.material]
+
+		if !found {
+			material = NewLambertian(ConstantTexture{Vec3{0.8, 0.8, 0.8}})
+		}
+
+		positions := make([]Vec3, len(mesh.corners))
+		uvs := make([]Vec3, len(mesh.corners))
+		normals := make([]Vec3, len(mesh.corners))
+
+		for i, corner := range mesh.corners {
+			positions[i] = p.positions[corner[0]]
+
+			if uvs != nil && corner[1] >= 0 {
+				uvs[i] = p.uvs[corner[1]]
+			} else {
+				uvs = nil
+			}
+
+			if normals != nil && corner[2] >= 0 {
+				normals[i] = p.normals[corner[2]]
+			} else {
+				normals = nil
+			}
+		}
+
+		id, numbered := ids[mesh.material]
+
+		if !numbered {
+			id = firstMaterialID + len(ids)
+			ids[mesh.material] = id
+		}
+
+		triangleMesh := NewTriangleMesh(positions, normals, uvs, mesh.indices, MaterialID{material, id})
+
+		model.meshes = append(model.meshes, triangleMesh)
+		triangles = append(triangles, triangleMesh.triangles...)
+
+		if _, isLight := material.(DiffuseLight); isLight {
+			model.lights.add(triangleMesh)
+		}
+	}
+
+	if len(triangles) == 0 {
+		return OBJModel{}, fmt.Errorf("%s: no faces", p.filename)
+	}
+
+	model.hitable = NewBVHNode(triangles, 0, 0)
+	model.materials = len(ids)
+	model.files = p.files
+
+	return model, nil
+}
+
+// mtlMaterial holds the MTL statements used to pick a Material.
+type mtlMaterial struct {
+	kd         Vec3
+	ks         Vec3
+	ke         Vec3
+	ns         float64
+	ni         float64
+	dissolve   float64
+	illum      int
+	diffuseMap Texture
+}
+
+// loadMTL adds the materials of an MTL file to materials, and returns the files read,
+// the MTL file and its textures.
+func loadMTL(filename string, materials map[string]Material) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var name string
+	var current *mtlMaterial
+
+	files := []string{filename}
+
+	finish := func() {
+		if current != nil {
+			materials[name] = current.material()
+		}
+	}
+
+	scanner := bufio.NewScanner(file)
+	line := 0
+
+	for scanner.Scan() {
+		line++
+
+		text := scanner.Text()
+
+		if comment := strings.IndexByte(text, '#'); comment >= 0 {
+			text = text[:comment]
+		}
+
+		fields := strings.Fields(text)
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		fail := func(format string, args ...interface{}) error {
+			return fmt.Errorf("%s:%d: %s", filename, line, fmt.Sprintf(format, args...))
+		}
+
+		if fields[0] == "newmtl" {
+			finish()
+
+			if len(fields) < 2 {
+				return nil, fail("newmtl needs a name")
+			}
+
+			name = strings.Join(fields[1:], " ")
+			current = &mtlMaterial{kd: Vec3{0.8, 0.8, 0.8}, ni: 1, dissolve: 1, illum: 2}
+
+			continue
+		}
+
+		if current == nil {
+			return nil, fail("%s before newmtl", fields[0])
+		}
+
+		values := make([]float64, 0, 3)
+
+		switch fields[0] {
+		case "Kd", "Ks", "Ke", "Ns", "Ni", "d", "Tr", "illum":
+			for _, field := range fields[1:] {
+				value, err := strconv.ParseFloat(field, 64)
+				if err != nil {
+					return nil, fail("%q is not a number", field)
+				}
+
+				values = append(values, value)
+			}
+
+			if len(values) == 0 {
+				return nil, fail("%s needs a value", fields[0])
+			}
+		}
+
+		switch fields[0] {
+		case "Kd":
+			current.kd = mtlColor(values)
+		case "Ks":
+			current.ks = mtlColor(values)
+		case "Ke":
+			current.ke = mtlColor(values)
+		case "Ns":
+			current.ns = values[0]
+		case "Ni":
+			current.ni = values[0]
+		case "d":
+			current.dissolve = values[0]
+		case "Tr":
+			current.dissolve = 1 - values[0]
+		case "illum":
+			current.illum = int(values[0])
+		case "map_Kd":
+			if len(fields) < 2 {
+				return nil, fail("map_Kd needs a file name")
+			}
+
+			// Options such as -s come before the file name, which is last.
+			textureFile := filepath.Join(filepath.Dir(filename), fields[len(fields)-1])
+
+			img, err := LoadImage(textureFile)
+			if err != nil {
+				return nil, fail("%v", err)
+			}
+
+			current.diffuseMap = NewImageTexture(img)
+			files = append(files, textureFile)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	finish()
+
+	return files, nil
+}
+
+// mtlColor reads an r g b color, where a single value is used for all three.
+func mtlColor(values []float64) Vec3 {
+	if len(values) < 3 {
+		return Vec3{values[0], values[0], values[0]}
+	}
+
+	return Vec3{values[0], values[1], values[2]}
+}
+
+// material maps an MTL material onto the closest Material: emissive materials become
+// DiffuseLights, transparent ones Dielectrics, mirrors Metals and the rest Lambertians.
+func (m mtlMaterial) material() Material {
+	black := Vec3Zero()
+
+	if m.ke != black {
+		return DiffuseLight{ConstantTexture{m.ke}}
+	}
+
+	transparent := m.dissolve < 1 || m.illum == 4 || m.illum == 6 || m.illum == 7 || m.illum == 9
+
+	if transparent {
+		index := m.ni
+
+		if index <= 1 {
+			index = 1.5
+		}
+
+		return NewDielectric(index)
+	}
+
+	mirror := m.illum == 3 || m.illum == 5 || (m.kd == black && m.diffuseMap == nil && m.ks != black)
+
+	if mirror {
+		// Convert the Phong exponent into a roughness.
+		fuzz := math.Sqrt(2 / (m.ns + 2))
+
+		return NewMetal(m.ks, fuzz)
+	}
+
+	if m.diffuseMap != nil {
+		return NewLambertian(m.diffuseMap)
+	}
+
+	return NewLambertian(ConstantTexture{m.kd})
+}
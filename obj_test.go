@@ -0,0 +1,125 @@
+package main
+
+import (
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, dir, name, contents string) string {
+	path := filepath.Join(dir, name)
+
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadOBJ(t *testing.T) {
+	dir := t.TempDir()
+
+	writeTestFile(t, dir, "test.mtl", `
+newmtl red
+Kd 0.8 0.1 0.1
+
+newmtl lamp
+Ke 10 10 10
+
+newmtl glass
+Ni 1.45
+d 0.1
+
+newmtl mirror
+illum 3
+Ks 0.9 0.9 0.9
+Ns 1000
+`)
+
+	obj := writeTestFile(t, dir, "test.obj", `
+mtllib test.mtl
+v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+vn 0 0 1
+vt 0 0
+vt 1 0
+vt 1 1
+vt 0 1
+
+g floor
+usemtl red
+f 1/1/1 2/2/1 3/3/1 4/4/1
+
+g lamp
+usemtl lamp
+v 0 0 -1
+v 1 0 -1
+v 0 1 -1
+f -3 -2 -1
+`)
+
+	model, err := LoadOBJ(obj, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(model.meshes) != 2 {
+		t.Fatalf("Expected 2 meshes, got %d", len(model.meshes))
+	}
+
+	if model.materials != 2 || materialID(model.meshes[0].material) != 5 || materialID(model.meshes[1].material) != 6 {
+		t.Errorf("Expected materials 5 and 6, got %d materials tagged %d and %d", model.materials, materialID(model.meshes[0].material), materialID(model.meshes[1].material))
+	}
+
+	quad := model.meshes[0]
+
+	if len(quad.triangles) != 2 || len(quad.positions) != 4 || quad.normals == nil || quad.uvs == nil {
+		t.Errorf("Quad not triangulated with shared vertices: %+v", quad)
+	}
+
+	if len(model.lights) != 1 {
+		t.Errorf("Expected the lamp to be a light, got %d lights", len(model.lights))
+	}
+
+	var hit Hit
+
+	didHit := model.hitable.hit(Ray{Vec3{0.75, 0.25, 1}, Vec3{0, 0, -1}, 0}, 0.001, math.MaxFloat64, &hit, nil)
+
+	if !didHit || math.Abs(hit.u-0.75) > 1e-9 || math.Abs(hit.v-0.25) > 1e-9 {
+		t.Errorf("Expected a textured hit, got %v %+v", didHit, hit)
+	}
+
+	materials := make(map[string]Material)
+
+	if _, err := loadMTL(filepath.Join(dir, "test.mtl"), materials); err != nil {
+		t.Fatal(err)
+	}
+
+	if glass, ok := materials["glass"].(Dielectric); !ok || glass.reflectiveIndex != 1.45 {
+		t.Errorf("Expected glass to be a Dielectric, got %#v", materials["glass"])
+	}
+
+	if _, ok := materials["mirror"].(Metal); !ok {
+		t.Errorf("Expected mirror to be a Metal, got %#v", materials["mirror"])
+	}
+
+	if _, ok := materials["red"].(Lambertian); !ok {
+		t.Errorf("Expected red to be a Lambertian, got %#v", materials["red"])
+	}
+}
+
+func TestLoadOBJErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	obj := writeTestFile(t, dir, "bad.obj", "v 0 0 0\nv 1 0 0\nf 1 2 3\n")
+
+	_, err := LoadOBJ(obj, 1)
+
+	if err == nil || !strings.Contains(err.Error(), "bad.obj:3: position index 3 is out of range") {
+		t.Errorf("Expected an out of range error on line 3, got %v", err)
+	}
+}
@@ -1,14 +1,11 @@
 package main
 
-import (
-	"math"
-	"math/rand"
-)
+import "math"
 
 // Pdf represents a probability distribution function.
 type Pdf interface {
 	value(direction Vec3) float64
-	generate() Vec3
+	generate(sampler Sampler) Vec3
 }
 
 // PdfZero is a standin for a blank PDF.
@@ -19,10 +16,22 @@ func (zPdf PdfZero) value(direction Vec3) float64 {
 	return 0.0
 }
 
-func (zPdf PdfZero) generate() Vec3 {
+func (zPdf PdfZero) generate(sampler Sampler) Vec3 {
 	return Vec3Zero()
 }
 
+// SpherePdf is a uniform PDF over all directions.
+type SpherePdf struct {
+}
+
+func (sPdf SpherePdf) value(direction Vec3) float64 {
+	return 1 / (4 * math.Pi)
+}
+
+func (sPdf SpherePdf) generate(sampler Sampler) Vec3 {
+	return RandomOnUnitSphere(sampler)
+}
+
 // CosinePdf is a cosine version of a PDF.
 type CosinePdf struct {
 	uvw Onb
@@ -46,8 +55,8 @@ func (cpdf CosinePdf) value(direction Vec3) float64 {
 	return 0
 }
 
-func (cpdf CosinePdf) generate() Vec3 {
-	return cpdf.uvw.local(RandomCosineDirection())
+func (cpdf CosinePdf) generate(sampler Sampler) Vec3 {
+	return cpdf.uvw.local(RandomCosineDirection(sampler))
 }
 
 // HitablePdf represents a PDF that uses a Hitable object.
@@ -60,8 +69,8 @@ func (hPdf HitablePdf) value(direction Vec3) float64 {
 	return hPdf.hitable.pdfValue(hPdf.o, direction)
 }
 
-func (hPdf HitablePdf) generate() Vec3 {
-	return hPdf.hitable.random(hPdf.o)
+func (hPdf HitablePdf) generate(sampler Sampler) Vec3 {
+	return hPdf.hitable.random(hPdf.o, sampler)
 }
 
 // MixturePdf is a combination of two Pdfs.
@@ -80,10 +89,10 @@ func (mPdf MixturePdf) value(direction Vec3) float64 {
 	return 0.5*mPdf.pdfs[0].value(direction) + 0.5*mPdf.pdfs[1].value(direction)
 }
 
-func (mPdf MixturePdf) generate() Vec3 {
-	if rand.Float64() < 0.5 {
-		return mPdf.pdfs[0].generate()
+func (mPdf MixturePdf) generate(sampler Sampler) Vec3 {
+	if sampler.Float64() < 0.5 {
+		return mPdf.pdfs[0].generate(sampler)
 	}
 
-	return mPdf.pdfs[1].generate()
+	return mPdf.pdfs[1].generate(sampler)
 }
@@ -14,12 +14,12 @@ type Perlin struct {
 }
 
 // NewPerlin is a factory for Perlin instances.
-func NewPerlin() Perlin {
+func NewPerlin(rng *rand.Rand) Perlin {
 	return Perlin{
-		randFloat: perlinGenerate(),
-		permX:     perlinGeneratePerm(),
-		permY:     perlinGeneratePerm(),
-		permZ:     perlinGeneratePerm(),
+		randFloat: perlinGenerate(rng),
+		permX:     perlinGeneratePerm(rng),
+		permY:     perlinGeneratePerm(rng),
+		permZ:     perlinGeneratePerm(rng),
 	}
 }
 
@@ -64,14 +64,14 @@ func (perlin Perlin) turbulence(p Vec3, depth int) float64 {
 	return math.Abs(acc)
 }
 
-func perlinGenerate() []Vec3 {
+func perlinGenerate(rng *rand.Rand) []Vec3 {
 	var p []Vec3
 
 	for i := 0; i < 256; i++ {
 		vec := Vec3{
-			-1 + 2*rand.Float64(),
-			-1 + 2*rand.Float64(),
-			-1 + 2*rand.Float64(),
+			-1 + 2*rng.Float64(),
+			-1 + 2*rng.Float64(),
+			-1 + 2*rng.Float64(),
 		}.unitVector()
 
 		p = append(p, vec)
@@ -80,21 +80,21 @@ func perlinGenerate() []Vec3 {
 	return p
 }
 
-func permute(p *[]int) {
+func permute(p *[]int, rng *rand.Rand) {
 	for i := len(*p) - 1; i > 0; i-- {
-		target := int(rand.Float64() * float64(i+1))
+		target := int(rng.Float64() * float64(i+1))
 		(*p)[i], (*p)[target] = (*p)[target], (*p)[i]
 	}
 }
 
-func perlinGeneratePerm() []int {
+func perlinGeneratePerm(rng *rand.Rand) []int {
 	var p []int
 
 	for i := 0; i < 256; i++ {
 		p = append(p, i)
 	}
 
-	permute(&p)
+	permute(&p, rng)
 
 	return p
 }
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// WritePFM writes the linear framebuffer, stored top row first, as a little-endian
+// Portable Float Map, which stores the bottom row first.
+func WritePFM(w io.Writer, framebuffer []Vec3, width, height int) error {
+	buffered := bufio.NewWriter(w)
+
+	fmt.Fprintf(buffered, "PF\n%d %d\n-1.0\n", width, height)
+
+	row := make([]float32, 3*width)
+
+	for y := height - 1; y >= 0; y-- {
+		for i, pixel := range framebuffer[y*width : (y+1)*width] {
+			row[3*i] = float32(pixel.r())
+			row[3*i+1] = float32(pixel.g())
+			row[3*i+2] = float32(pixel.b())
+		}
+
+		binary.Write(buffered, binary.LittleEndian, row)
+	}
+
+	return buffered.Flush()
+}
+
+// ReadPFM reads a color Portable Float Map of either byte order, returning the
+// framebuffer top row first along with its width and height. The pixels must be exactly
+// as many as the header gives.
+func ReadPFM(r io.Reader) ([]Vec3, int, int, error) {
+	buffered := bufio.NewReader(r)
+
+	var magic string
+	var width, height int
+	var scale float64
+
+	if _, err := fmt.Fscan(buffered, &magic, &width, &height, &scale); err != nil || magic != "PF" {
+		return nil, 0, 0, fmt.Errorf("not a color PFM image")
+	}
+
+	// A single whitespace character separates the header from the pixels.
+	if _, err := buffered.ReadByte(); err != nil {
+		return nil, 0, 0, err
+	}
+
+	if width <= 0 || height <= 0 {
+		return nil, 0, 0, fmt.Errorf("PFM image is %dx%d pixels", width, height)
+	}
+
+	data, err := ioutil.ReadAll(buffered)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	// Each pixel is three 4 byte floats. Dividing keeps a huge header from overflowing.
+	pixels := len(data) / 12
+
+	if len(data)%12 != 0 || pixels%width != 0 || pixels/width != height {
+		return nil, 0, 0, fmt.Errorf("PFM image of %dx%d pixels has %d bytes of pixel data", width, height, len(data))
+	}
+
+	var order binary.ByteOrder = binary.BigEndian
+
+	if scale < 0 {
+		order = binary.LittleEndian
+	}
+
+	framebuffer := make([]Vec3, width*height)
+	row := make([]float32, 3*width)
+	reader := bytes.NewReader(data)
+
+	for y := height - 1; y >= 0; y-- {
+		if err := binary.Read(reader, order, row); err != nil {
+			return nil, 0, 0, err
+		}
+
+		for i := range framebuffer[y*width : (y+1)*width] {
+			framebuffer[y*width+i] = Vec3{float64(row[3*i]), float64(row[3*i+1]), float64(row[3*i+2])}
+		}
+	}
+
+	return framebuffer, width, height, nil
+}
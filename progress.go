@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// Progress describes how far a render has got. The samples wanted shrink as adaptive
+// pixels converge, and tiles count those of the current pass.
+type Progress struct {
+	tiles       int
+	tilesDone   int
+	samples     int
+	samplesDone int
+	rays        int64
+	elapsed     time.Duration
+	eta         time.Duration
+}
+
+// fraction returns how much of the render is done, from zero to one.
+func (p Progress) fraction() float64 {
+	if p.samples == 0 {
+		return 1
+	}
+
+	return math.Max(0, math.Min(1, float64(p.samplesDone)/float64(p.samples)))
+}
+
+// raysPerSecond returns the rate rays have been traced at, or zero before any time
+// has passed.
+func (p Progress) raysPerSecond() float64 {
+	if p.elapsed <= 0 {
+		return 0
+	}
+
+	return float64(p.rays) / p.elapsed.Seconds()
+}
+
+// tileResult is what a worker learned rendering a Tile, along with its splats.
+type tileResult struct {
+	index     int
+	remaining int
+	samples   int
+	skipped   int
+	rays      int
+	splat     *splatBuffer
+}
+
+// progressTracker adds up the tileResults of a render and reports the Progress after each.
+type progressTracker struct {
+	progress     Progress
+	report       func(Progress)
+	started      time.Time
+	startSamples int
+}
+
+// newProgressTracker starts tracking a render into the Film, which may already hold
+// samples, calling report after each Tile unless it is nil. A resumed Film may hold
+// more samples than are now wanted, which count as no more than enough.
+func newProgressTracker(film *Film, config Config, report func(Progress)) *progressTracker {
+	t := &progressTracker{
+		report:  report,
+		started: time.Now(),
+	}
+
+	t.progress.tiles = len(config.tiles())
+
+	for i, n := range film.samples {
+		if n > config.samples {
+			n = config.samples
+		}
+
+		t.progress.samplesDone += n
+
+		if film.converged[i] {
+			t.progress.samples += n
+		} else {
+			t.progress.samples += config.samples
+		}
+	}
+
+	t.startSamples = t.progress.samplesDone
+
+	return t
+}
+
+func (t *progressTracker) startPass() {
+	t.progress.tilesDone = 0
+}
+
+// add counts a finished Tile, estimating the time left from the rate of samples so far.
+func (t *progressTracker) add(result tileResult) {
+	t.progress.tilesDone++
+	t.progress.samplesDone += result.samples
+	t.progress.samples -= result.skipped
+	t.progress.rays += int64(result.rays)
+	t.progress.elapsed = time.Since(t.started)
+
+	if done := t.progress.samplesDone - t.startSamples; done > 0 {
+		left := float64(t.progress.samples - t.progress.samplesDone)
+		t.progress.eta = time.Duration(float64(t.progress.elapsed) * left / float64(done))
+	}
+
+	if t.report != nil {
+		t.report(t.progress)
+	}
+}
+
+// progressBarWidth is the number of characters in the bar itself.
+const progressBarWidth = 30
+
+// ProgressBar returns a report function drawing a progress bar on a terminal, redrawn
+// in place at most every interval.
+func ProgressBar(w io.Writer, interval time.Duration) func(Progress) {
+	var last time.Time
+
+	return func(p Progress) {
+		if time.Since(last) < interval && p.samplesDone < p.samples {
+			return
+		}
+
+		last = time.Now()
+		filled := int(p.fraction() * progressBarWidth)
+
+		fmt.Fprintf(
+			w,
+			"\r[%s%s] %5.1f%%  %d/%d tiles  %s rays/s  ETA %s ",
+			strings.Repeat("#", filled),
+			strings.Repeat(".", progressBarWidth-filled),
+			100*p.fraction(),
+			p.tilesDone,
+			p.tiles,
+			siPrefix(p.raysPerSecond()),
+			p.eta.Round(time.Second),
+		)
+	}
+}
+
+// siPrefix formats a number with a k, M or G suffix.
+func siPrefix(value float64) string {
+	for _, prefix := range []string{"", "k", "M"} {
+		if value < 1000 {
+			return fmt.Sprintf("%.1f%s", value, prefix)
+		}
+
+		value /= 1000
+	}
+
+	return fmt.Sprintf("%.1fG", value)
+}
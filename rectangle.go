@@ -1,9 +1,6 @@
 package main
 
-import (
-	"math"
-	"math/rand"
-)
+import "math"
 
 // XYRectangle represents an axis-aligned rectangle.
 type XYRectangle struct {
@@ -15,18 +12,18 @@ type XYRectangle struct {
 	material Material
 }
 
-func (rec XYRectangle) hit(r Ray, t0, t1 float64) (bool, *Hit) {
+func (rec XYRectangle) hit(r Ray, t0, t1 float64, record *Hit, sampler Sampler) bool {
 	t := (rec.k - r.origin().z()) / r.direction().z()
 
 	if t < t0 || t > t1 {
-		return false, nil
+		return false
 	}
 
 	x := r.origin().x() + r.direction().multiplyScalar(t).x()
 	y := r.origin().y() + r.direction().multiplyScalar(t).y()
 
 	if x < rec.x0 || x > rec.x1 || y < rec.y0 || y > rec.y1 {
-		return false, nil
+		return false
 	}
 
 	u := (x - rec.x0) / (rec.x1 - rec.x0)
@@ -36,7 +33,7 @@ func (rec XYRectangle) hit(r Ray, t0, t1 float64) (bool, *Hit) {
 
 	normal := Vec3{0, 0, 1}
 
-	hit := Hit{
+	*record = Hit{
 		t:        t,
 		p:        p,
 		u:        u,
@@ -45,7 +42,7 @@ func (rec XYRectangle) hit(r Ray, t0, t1 float64) (bool, *Hit) {
 		material: rec.material,
 	}
 
-	return true, &hit
+	return true
 }
 
 func (rec XYRectangle) boundingBox(t0, t1 float64) (bool, *AABB) {
@@ -61,7 +58,7 @@ func (rec XYRectangle) pdfValue(o, direction Vec3) float64 {
 	return 0.0
 }
 
-func (rec XYRectangle) random(o Vec3) Vec3 {
+func (rec XYRectangle) random(o Vec3, sampler Sampler) Vec3 {
 	return Vec3{1, 0, 0}
 }
 
@@ -75,18 +72,18 @@ type XZRectangle struct {
 	material Material
 }
 
-func (rec XZRectangle) hit(r Ray, t0, t1 float64) (bool, *Hit) {
+func (rec XZRectangle) hit(r Ray, t0, t1 float64, record *Hit, sampler Sampler) bool {
 	t := (rec.k - r.origin().y()) / r.direction().y()
 
 	if t < t0 || t > t1 {
-		return false, nil
+		return false
 	}
 
 	x := r.origin().x() + r.direction().multiplyScalar(t).x()
 	z := r.origin().z() + r.direction().multiplyScalar(t).z()
 
 	if x < rec.x0 || x > rec.x1 || z < rec.z0 || z > rec.z1 {
-		return false, nil
+		return false
 	}
 
 	u := (x - rec.x0) / (rec.x1 - rec.x0)
@@ -96,7 +93,7 @@ func (rec XZRectangle) hit(r Ray, t0, t1 float64) (bool, *Hit) {
 
 	normal := Vec3{0, 1, 0}
 
-	hit := Hit{
+	*record = Hit{
 		t:        t,
 		p:        p,
 		u:        u,
@@ -105,7 +102,7 @@ func (rec XZRectangle) hit(r Ray, t0, t1 float64) (bool, *Hit) {
 		material: rec.material,
 	}
 
-	return true, &hit
+	return true
 }
 
 func (rec XZRectangle) boundingBox(t0, t1 float64) (bool, *AABB) {
@@ -118,9 +115,9 @@ func (rec XZRectangle) boundingBox(t0, t1 float64) (bool, *AABB) {
 }
 
 func (rec XZRectangle) pdfValue(o, direction Vec3) float64 {
-	didHit, hit := rec.hit(Ray{o, direction, math.MaxFloat64}, 0.001, math.MaxFloat64)
+	var hit Hit
 
-	if didHit {
+	if rec.hit(Ray{o, direction, math.MaxFloat64}, 0.001, math.MaxFloat64, &hit, nil) {
 		area := (rec.x1 - rec.x0) * (rec.z1 - rec.z0)
 		distanceSquared := hit.t * hit.t * direction.squaredLength()
 		cosine := math.Abs(direction.dot(hit.normal) / direction.length())
@@ -131,11 +128,12 @@ func (rec XZRectangle) pdfValue(o, direction Vec3) float64 {
 	return 0
 }
 
-func (rec XZRectangle) random(o Vec3) Vec3 {
+func (rec XZRectangle) random(o Vec3, sampler Sampler) Vec3 {
+	u, v := Float64Pair(sampler)
 	randomPoint := Vec3{
-		rec.x0 + rand.Float64()*(rec.x1-rec.x0),
+		rec.x0 + u*(rec.x1-rec.x0),
 		rec.k,
-		rec.z0 + rand.Float64()*(rec.z1-rec.z0),
+		rec.z0 + v*(rec.z1-rec.z0),
 	}
 
 	return randomPoint.subtract(o)
@@ -151,18 +149,18 @@ type YZRectangle struct {
 	material Material
 }
 
-func (rec YZRectangle) hit(r Ray, t0, t1 float64) (bool, *Hit) {
+func (rec YZRectangle) hit(r Ray, t0, t1 float64, record *Hit, sampler Sampler) bool {
 	t := (rec.k - r.origin().x()) / r.direction().x()
 
 	if t < t0 || t > t1 {
-		return false, nil
+		return false
 	}
 
 	y := r.origin().y() + r.direction().multiplyScalar(t).y()
 	z := r.origin().z() + r.direction().multiplyScalar(t).z()
 
 	if y < rec.y0 || y > rec.y1 || z < rec.z0 || z > rec.z1 {
-		return false, nil
+		return false
 	}
 
 	u := (y - rec.y0) / (rec.y1 - rec.y0)
@@ -172,7 +170,7 @@ func (rec YZRectangle) hit(r Ray, t0, t1 float64) (bool, *Hit) {
 
 	normal := Vec3{1, 0, 0}
 
-	hit := Hit{
+	*record = Hit{
 		t:        t,
 		p:        p,
 		u:        u,
@@ -181,7 +179,7 @@ func (rec YZRectangle) hit(r Ray, t0, t1 float64) (bool, *Hit) {
 		material: rec.material,
 	}
 
-	return true, &hit
+	return true
 }
 
 func (rec YZRectangle) boundingBox(t0, t1 float64) (bool, *AABB) {
@@ -197,6 +195,6 @@ func (rec YZRectangle) pdfValue(o, direction Vec3) float64 {
 	return 0.0
 }
 
-func (rec YZRectangle) random(o Vec3) Vec3 {
+func (rec YZRectangle) random(o Vec3, sampler Sampler) Vec3 {
 	return Vec3{1, 0, 0}
 }
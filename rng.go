@@ -0,0 +1,48 @@
+package main
+
+import "math/rand"
+
+// SplitMix64 is a rand.Source64 that is cheap to seed, so that every sample
+// of every pixel can start from its own seed.
+type SplitMix64 struct {
+	state uint64
+}
+
+// NewRand returns a rand.Rand backed by a SplitMix64 source.
+func NewRand(seed int64) *rand.Rand {
+	return rand.New(&SplitMix64{uint64(seed)})
+}
+
+// Seed resets the generator to the given seed.
+func (s *SplitMix64) Seed(seed int64) {
+	s.state = uint64(seed)
+}
+
+// Uint64 returns the next pseudo-random uint64.
+func (s *SplitMix64) Uint64() uint64 {
+	s.state += 0x9e3779b97f4a7c15
+
+	return mix64(s.state)
+}
+
+// Int63 returns the next non-negative pseudo-random int64.
+func (s *SplitMix64) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
+
+// sampleSeed derives the seed for a single sample of a single pixel, so that the
+// image does not depend on how pixels are distributed between workers.
+func sampleSeed(seed int64, pixel, sample int) int64 {
+	h := mix64(uint64(seed) ^ 0x6a09e667f3bcc909)
+	h = mix64(h ^ uint64(pixel))
+	h = mix64(h ^ uint64(sample))
+
+	return int64(h)
+}
+
+func mix64(z uint64) uint64 {
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+
+	return z ^ (z >> 31)
+}
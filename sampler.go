@@ -0,0 +1,375 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"math/rand"
+)
+
+// Sampler supplies the numbers in [0, 1) that samples are made from, to the camera,
+// materials, PDFs and lights. Each call to Float64 takes the next dimension.
+type Sampler interface {
+	Float64() float64
+}
+
+// pairSampler is a Sampler whose dimensions come in pairs from 2D points.
+type pairSampler interface {
+	float64Pair() (float64, float64)
+}
+
+// Float64Pair returns the next two dimensions for a 2D choice, such as a direction or a
+// point on a light. A sampler of 2D points starts a new point for them if the last one
+// was half taken, so that they are stratified together.
+func Float64Pair(sampler Sampler) (float64, float64) {
+	if paired, ok := sampler.(pairSampler); ok {
+		return paired.float64Pair()
+	}
+
+	return sampler.Float64(), sampler.Float64()
+}
+
+// PixelSampler is a Sampler the renderer moves from sample to sample of each pixel.
+// The dimensions of a sample go to the pixel position, the lens and the time of the
+// camera ray, then to each bounce of the path in turn.
+type PixelSampler interface {
+	Sampler
+	// startSample begins sample s of a pixel at the first dimension.
+	startSample(pixel, s int)
+	// skipTo moves on to a dimension, unless the sample is already past it.
+	skipTo(dimension int)
+}
+
+const (
+	// cameraDimensions are taken by the pixel position, lens and time of a camera ray,
+	// rounded up to whole pairs.
+	cameraDimensions = 6
+	// bounceDimensions are set aside for each bounce, so that the same dimensions go to
+	// the same choices however many the rejection sampling of earlier bounces took.
+	bounceDimensions = 8
+	// mediumDimensions start each bounce, kept for the free flight through media on the
+	// way to its hit whether or not there are any.
+	mediumDimensions = 1
+)
+
+// SamplerType picks how the numbers of the samples of a pixel are spread out.
+type SamplerType int
+
+// The supported samplers.
+const (
+	SamplerIndependent SamplerType = iota
+	SamplerStratified
+	SamplerHalton
+	SamplerSobol
+	SamplerCMJ
+)
+
+var samplerNames = []string{"independent", "stratified", "halton", "sobol", "cmj"}
+
+// ParseSamplerType parses the name of a sampler.
+func ParseSamplerType(s string) (SamplerType, error) {
+	for i, name := range samplerNames {
+		if name == s {
+			return SamplerType(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown sampler %q, expected one of %v", s, samplerNames)
+}
+
+func (t SamplerType) String() string {
+	if t >= 0 && int(t) < len(samplerNames) {
+		return samplerNames[t]
+	}
+
+	return fmt.Sprintf("SamplerType(%d)", int(t))
+}
+
+// stratifiesCount reports whether the sampler's pattern depends on the number of
+// samples per pixel.
+func (t SamplerType) stratifiesCount() bool {
+	return t == SamplerStratified || t == SamplerCMJ
+}
+
+// NewSampler returns a PixelSampler of the type. Stratified and correlated
+// multi-jittered samplers spread out the given number of samples of each pixel.
+func NewSampler(t SamplerType, seed int64, samples int) PixelSampler {
+	patterns := map[SamplerType]func(index, pair, samples int, seed uint64) (float64, float64){
+		SamplerStratified: stratifiedPoint,
+		SamplerHalton:     haltonPoint,
+		SamplerSobol:      sobolPoint,
+		SamplerCMJ:        cmjPoint,
+	}
+
+	if pattern, ok := patterns[t]; ok {
+		return &SequenceSampler{pattern: pattern, seed: mix64(uint64(seed) ^ 0xbb67ae8584caa73b), samples: samples}
+	}
+
+	return &IndependentSampler{seed, NewRand(seed)}
+}
+
+// IndependentSampler takes every dimension from a pseudo-random generator seeded for
+// each sample.
+type IndependentSampler struct {
+	seed int64
+	rng  *rand.Rand
+}
+
+// Float64 returns the next pseudo-random number.
+func (s *IndependentSampler) Float64() float64 {
+	return s.rng.Float64()
+}
+
+func (s *IndependentSampler) startSample(pixel, sample int) {
+	s.rng.Seed(sampleSeed(s.seed, pixel, sample))
+}
+
+// skipTo does nothing, as independent dimensions need no lining up.
+func (s *IndependentSampler) skipTo(dimension int) {}
+
+// SequenceSampler takes dimensions in pairs from the 2D points of a stateless pattern.
+// Each pair of each pixel scrambles the pattern with its own seed, so that pairs and
+// pixels are independent of each other while the samples of a pixel are spread out.
+type SequenceSampler struct {
+	pattern   func(index, pair, samples int, seed uint64) (float64, float64)
+	seed      uint64
+	samples   int
+	pixelSeed uint64
+	sample    int
+	dimension int
+	pair      int
+	x         float64
+	y         float64
+}
+
+// Float64 returns the next dimension of the current sample.
+func (s *SequenceSampler) Float64() float64 {
+	d := s.dimension
+	s.dimension++
+
+	if d/2 != s.pair {
+		s.pair = d / 2
+		s.x, s.y = s.pattern(s.sample, s.pair, s.samples, mix64(s.pixelSeed^uint64(s.pair)*0x9e3779b97f4a7c15))
+	}
+
+	if d%2 == 0 {
+		return s.x
+	}
+
+	return s.y
+}
+
+// float64Pair returns the next 2D point of the pattern.
+func (s *SequenceSampler) float64Pair() (float64, float64) {
+	s.dimension += s.dimension % 2
+
+	return s.Float64(), s.Float64()
+}
+
+func (s *SequenceSampler) startSample(pixel, sample int) {
+	s.pixelSeed = mix64(s.seed ^ mix64(uint64(pixel)))
+	s.sample = sample
+	s.dimension = 0
+	s.pair = -1
+}
+
+func (s *SequenceSampler) skipTo(dimension int) {
+	if dimension > s.dimension {
+		s.dimension = dimension
+	}
+}
+
+// stratifiedPoint jitters a point within a cell of a grid of at least samples cells,
+// visiting the cells in a random order. Each round of samples after the first takes a
+// new order.
+func stratifiedPoint(index, pair, samples int, seed uint64) (float64, float64) {
+	p := uint32(mix64(seed ^ uint64(index/samples)))
+	index %= samples
+	columns := int(math.Ceil(math.Sqrt(float64(samples))))
+	rows := (samples + columns - 1) / columns
+	cell := int(permuteIndex(uint32(index), uint32(columns*rows), p))
+
+	x := (float64(cell%columns) + randomFloat(uint32(index), p*0x967a889b)) / float64(columns)
+	y := (float64(cell/columns) + randomFloat(uint32(index), p*0x368cc8b7)) / float64(rows)
+
+	return x, y
+}
+
+// cmjPoint is Kensler's correlated multi-jittered sampling, which stratifies the points
+// in both dimensions at once as well as in a grid. Rounds take new patterns as above.
+func cmjPoint(index, pair, samples int, seed uint64) (float64, float64) {
+	p := uint32(mix64(seed ^ uint64(index/samples)))
+	index %= samples
+	m := int(math.Sqrt(float64(samples)))
+	n := (samples + m - 1) / m
+	s := int(permuteIndex(uint32(index), uint32(samples), p*0x51633e2d))
+	sx := permuteIndex(uint32(s%m), uint32(m), p*0x68bc21eb)
+	sy := permuteIndex(uint32(s/m), uint32(n), p*0x02e5be93)
+	jx := randomFloat(uint32(s), p*0x967a889b)
+	jy := randomFloat(uint32(s), p*0x368cc8b7)
+
+	return (float64(sx) + (float64(sy)+jx)/float64(n)) / float64(m), (float64(s) + jy) / float64(samples)
+}
+
+// haltonPrimes are the bases of the Halton sequence's dimensions.
+var haltonPrimes = primes(64)
+
+// haltonPoint is the Halton sequence with Owen scrambled digits, which breaks up the
+// lines that the points of large bases fall on at low sample counts. Dimensions beyond
+// haltonPrimes are pseudo-random.
+func haltonPoint(index, pair, samples int, seed uint64) (float64, float64) {
+	if 2*pair+1 >= len(haltonPrimes) {
+		return float64(uint32(mix64(seed^uint64(index)))) / (1 << 32), float64(uint32(mix64(seed+uint64(index)))) / (1 << 32)
+	}
+
+	return scrambledRadicalInverse(haltonPrimes[2*pair], index, seed), scrambledRadicalInverse(haltonPrimes[2*pair+1], index, mix64(seed))
+}
+
+// sobolDirections generate the second dimension of the Sobol sequence, the first
+// being the bits of the index reversed.
+var sobolDirections = sobolDirectionNumbers()
+
+// sobolPoint is the first two dimensions of the Sobol sequence with the index shuffled
+// and the values Owen scrambled, following Burley's "Practical Hash-based Owen
+// Scrambling". Shuffling each pair differently lets two dimensions stand for all.
+func sobolPoint(index, pair, samples int, seed uint64) (float64, float64) {
+	i := nestedUniformScramble(uint32(index), uint32(seed))
+
+	var y uint32
+
+	for b := 0; i>>uint(b) != 0; b++ {
+		if i>>uint(b)&1 != 0 {
+			y ^= sobolDirections[b]
+		}
+	}
+
+	x := nestedUniformScramble(bits.Reverse32(i), uint32(seed>>32))
+	y = nestedUniformScramble(y, uint32(mix64(seed)))
+
+	return float64(x) / (1 << 32), float64(y) / (1 << 32)
+}
+
+// sobolDirectionNumbers returns the direction numbers of the primitive polynomial x + 1.
+func sobolDirectionNumbers() []uint32 {
+	directions := make([]uint32, 32)
+	directions[0] = 1 << 31
+
+	for i := 1; i < len(directions); i++ {
+		directions[i] = directions[i-1] ^ directions[i-1]>>1
+	}
+
+	return directions
+}
+
+// nestedUniformScramble Owen scrambles the bits of x, starting from the highest.
+func nestedUniformScramble(x, seed uint32) uint32 {
+	x = bits.Reverse32(x)
+
+	// The Laine-Karras permutation, with Vegdahl's constants.
+	x += seed
+	x ^= x * 0x6c50b47c
+	x ^= x * 0xb82f1e52
+	x ^= x * 0xc7afe638
+	x ^= x * 0x8d22f6e6
+
+	return bits.Reverse32(x)
+}
+
+// permuteIndex is Kensler's hashed permutation of the integers below l, returning
+// where i goes in the permutation chosen by p.
+func permuteIndex(i, l, p uint32) uint32 {
+	w := l - 1
+	w |= w >> 1
+	w |= w >> 2
+	w |= w >> 4
+	w |= w >> 8
+	w |= w >> 16
+
+	for {
+		i ^= p
+		i *= 0xe170893d
+		i ^= p >> 16
+		i ^= (i & w) >> 4
+		i ^= p >> 8
+		i *= 0x0929eb3f
+		i ^= p >> 23
+		i ^= (i & w) >> 1
+		i *= 1 | p>>27
+		i *= 0x6935fa69
+		i ^= (i & w) >> 11
+		i *= 0x74dcb303
+		i ^= (i & w) >> 2
+		i *= 0x9e501cc3
+		i ^= (i & w) >> 2
+		i *= 0xc860a3df
+		i &= w
+		i ^= i >> 5
+
+		if i < l {
+			return (i + p) % l
+		}
+	}
+}
+
+// randomFloat is Kensler's hash of i and p to a number in [0, 1).
+func randomFloat(i, p uint32) float64 {
+	i ^= p
+	i ^= i >> 17
+	i ^= i >> 10
+	i *= 0xb36534e5
+	i ^= i >> 12
+	i ^= i >> 21
+	i *= 0x93fc4795
+	i ^= 0xdf6e307f
+	i ^= i >> 17
+	i *= 1 | p>>18
+
+	return float64(i) / 4294967808
+}
+
+// scrambledRadicalInverse mirrors the digits of index in the base about the radix
+// point, permuting each digit by a hash of the digits before it. The digits past the
+// last of the index are random, as scrambling their zeros would make them.
+func scrambledRadicalInverse(base, index int, seed uint64) float64 {
+	inverse := 0.0
+	scale := 1.0 / float64(base)
+
+	for ; index > 0; index /= base {
+		digit := index % base
+
+		inverse += float64(permuteIndex(uint32(digit), uint32(base), uint32(seed))) * scale
+		scale /= float64(base)
+		seed = mix64(seed ^ uint64(digit+1))
+	}
+
+	inverse += float64(uint32(seed)) / (1 << 32) * scale * float64(base)
+
+	return math.Min(inverse, math.Nextafter(1, 0))
+}
+
+// primes returns the first n prime numbers.
+func primes(n int) []int {
+	var found []int
+
+	for candidate := 2; len(found) < n; candidate++ {
+		prime := true
+
+		for _, p := range found {
+			if p*p > candidate {
+				break
+			}
+
+			if candidate%p == 0 {
+				prime = false
+
+				break
+			}
+		}
+
+		if prime {
+			found = append(found, candidate)
+		}
+	}
+
+	return found
+}
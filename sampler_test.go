@@ -0,0 +1,217 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSamplerDimensions(t *testing.T) {
+	for i := range samplerNames {
+		sampler := NewSampler(SamplerType(i), 3, 16)
+
+		for pixel := 0; pixel < 4; pixel++ {
+			for s := 0; s < 20; s++ {
+				sampler.startSample(pixel, s)
+
+				values := make([]float64, 80)
+
+				for d := range values {
+					values[d] = sampler.Float64()
+
+					if values[d] < 0 || values[d] >= 1 {
+						t.Fatalf("%v gave %v for dimension %d", SamplerType(i), values[d], d)
+					}
+				}
+
+				if SamplerType(i) == SamplerIndependent {
+					continue
+				}
+
+				// Skipping ahead lands on the same numbers as taking every dimension.
+				sampler.startSample(pixel, s)
+				sampler.skipTo(cameraDimensions + bounceDimensions)
+
+				if v := sampler.Float64(); v != values[cameraDimensions+bounceDimensions] {
+					t.Fatalf("%v gave %v after skipping, expected %v", SamplerType(i), v, values[cameraDimensions+bounceDimensions])
+				}
+			}
+		}
+	}
+}
+
+// recordingSampler is a SequenceSampler that notes each dimension it gives out.
+type recordingSampler struct {
+	*SequenceSampler
+	taken []int
+}
+
+func (r *recordingSampler) Float64() float64 {
+	r.taken = append(r.taken, r.dimension)
+
+	return r.SequenceSampler.Float64()
+}
+
+func (r *recordingSampler) float64Pair() (float64, float64) {
+	x, y := r.SequenceSampler.float64Pair()
+	r.taken = append(r.taken, r.dimension-2, r.dimension-1)
+
+	return x, y
+}
+
+func TestPathDimensions(t *testing.T) {
+	light := XZRectangle{-1, 1, -1, 1, 5, DiffuseLight{ConstantTexture{Vec3{1, 1, 1}}}}
+	floor := XZRectangle{-10, 10, -10, 10, 0, NewLambertian(ConstantTexture{Vec3{0.5, 0.5, 0.5}})}
+	fog := NewConstantMedium(NewBox(Vec3{-10, 0.5, -10}, Vec3{10, 1.5, 10}, nil), 100, ConstantTexture{Vec3{1, 1, 1}})
+
+	tests := []struct {
+		world    Hitable
+		expected []int
+	}{
+		// Both the light and the cosine PDF take the pair after the mixture's choice.
+		{HitableList{floor, light}, []int{7, 8, 9}},
+		// Fog takes the first dimension of the bounce to find where it scatters.
+		{HitableList{fog, floor, light}, []int{6, 7, 8, 9}},
+	}
+
+	for _, test := range tests {
+		for s := 0; s < 16; s++ {
+			sampler := &recordingSampler{SequenceSampler: NewSampler(SamplerSobol, 1, 16).(*SequenceSampler)}
+			sampler.startSample(0, s)
+			sampler.skipTo(cameraDimensions)
+
+			TracePath(Ray{Vec3{0, 1, 0}, Vec3{0, -1, 0}, 0}, test.world, light, 0, sampler, nil)
+
+			if len(sampler.taken) < len(test.expected) {
+				t.Fatalf("Path took dimensions %v, expected to start with %v", sampler.taken, test.expected)
+			}
+
+			for i, dimension := range test.expected {
+				if sampler.taken[i] != dimension {
+					t.Fatalf("Path took dimensions %v, expected to start with %v", sampler.taken, test.expected)
+				}
+			}
+		}
+	}
+}
+
+func TestSamplersStratify(t *testing.T) {
+	const n = 16
+
+	for _, samplerType := range []SamplerType{SamplerStratified, SamplerSobol, SamplerCMJ} {
+		sampler := NewSampler(samplerType, 5, n)
+
+		for pixel := 0; pixel < 8; pixel++ {
+			for _, pair := range []int{0, 1, 7, 30} {
+				var cells [4][4]int
+				var columns, rows [n]int
+
+				for s := 0; s < n; s++ {
+					sampler.startSample(pixel, s)
+					sampler.skipTo(2 * pair)
+
+					x := sampler.Float64()
+					y := sampler.Float64()
+
+					cells[int(x*4)][int(y*4)]++
+					columns[int(x*n)]++
+					rows[int(y*n)]++
+				}
+
+				for _, column := range cells {
+					for _, count := range column {
+						if count != 1 {
+							t.Fatalf("%v put %d samples of pixel %d in a cell of pair %d", samplerType, count, pixel, pair)
+						}
+					}
+				}
+
+				if samplerType == SamplerStratified {
+					continue
+				}
+
+				for k := 0; k < n; k++ {
+					if columns[k] != 1 || rows[k] != 1 {
+						t.Fatalf("%v is not stratified in each dimension of pair %d", samplerType, pair)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestSamplersReduceError(t *testing.T) {
+	const n = 16
+	const pixels = 256
+
+	// Estimate the area of a quarter disk in each pixel.
+	squaredError := func(samplerType SamplerType) float64 {
+		sampler := NewSampler(samplerType, 11, n)
+		total := 0.0
+
+		for pixel := 0; pixel < pixels; pixel++ {
+			inside := 0
+
+			for s := 0; s < n; s++ {
+				sampler.startSample(pixel, s)
+
+				x := sampler.Float64()
+				y := sampler.Float64()
+
+				if x*x+y*y < 1 {
+					inside++
+				}
+			}
+
+			e := float64(inside)/n - math.Pi/4
+			total += e * e
+		}
+
+		return total / pixels
+	}
+
+	independent := squaredError(SamplerIndependent)
+
+	for _, samplerType := range []SamplerType{SamplerStratified, SamplerHalton, SamplerSobol, SamplerCMJ} {
+		if e := squaredError(samplerType); e >= independent/2 {
+			t.Errorf("%v has a mean squared error of %v, independent sampling %v", samplerType, e, independent)
+		}
+	}
+}
+
+func TestRenderWithSamplers(t *testing.T) {
+	config := testProgressiveConfig()
+	world, lightShapes := CornellBox(config)
+
+	for i := range samplerNames {
+		config.sampler = SamplerType(i)
+
+		var expected []Vec3
+
+		for _, threads := range []int{1, 3} {
+			config.threads = threads
+			image := Render(config.camera(), world, lightShapes, config).Image()
+
+			if expected == nil {
+				expected = image
+			}
+
+			for p := range image {
+				if !identical(image[p], expected[p]) {
+					t.Fatalf("%v pixel %d differs with %d threads", config.sampler, p, threads)
+				}
+			}
+		}
+	}
+}
+
+func TestParseSamplerType(t *testing.T) {
+	for i, name := range samplerNames {
+		if samplerType, err := ParseSamplerType(name); err != nil || samplerType != SamplerType(i) || samplerType.String() != name {
+			t.Errorf("ParseSamplerType(%q) = %v, %v", name, samplerType, err)
+		}
+	}
+
+	if _, err := ParseSamplerType("random"); err == nil {
+		t.Errorf("Expected an error for an unknown sampler")
+	}
+}
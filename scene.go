@@ -1,21 +1,17 @@
 package main
 
-import (
-	"image"
-	"math/rand"
-	"os"
-)
-
 // SimpleScene returns a HitableList of Spheres for testing.
 func SimpleScene(config Config) Hitable {
+	var materials materialIDs
+
 	world := NewHitableList(0)
 
 	sphere := NewStationarySphere(
 		Vec3{0, 0, -1},
 		0.5,
-		NewLambertian(
+		materials.tag(NewLambertian(
 			ConstantTexture{Vec3{0.1, 0.2, 0.5}},
-		),
+		)),
 	)
 
 	world.add(sphere)
@@ -28,9 +24,9 @@ func SimpleScene(config Config) Hitable {
 	sphere = NewStationarySphere(
 		Vec3{0, -100.5, -1},
 		100,
-		NewLambertian(
+		materials.tag(NewLambertian(
 			checkerTexture,
-		),
+		)),
 	)
 
 	world.add(sphere)
@@ -38,9 +34,9 @@ func SimpleScene(config Config) Hitable {
 	sphere = NewStationarySphere(
 		Vec3{1, 0, -1},
 		0.5,
-		NewMetal(Vec3{
+		materials.tag(NewMetal(Vec3{
 			0.8, 0.6, 0.2,
-		}, 0.0),
+		}, 0.0)),
 	)
 
 	world.add(sphere)
@@ -48,7 +44,7 @@ func SimpleScene(config Config) Hitable {
 	sphere = NewStationarySphere(
 		Vec3{-1, 0, -1},
 		0.5,
-		NewDielectric(1.5),
+		materials.tag(NewDielectric(1.5)),
 	)
 
 	world.add(sphere)
@@ -56,7 +52,7 @@ func SimpleScene(config Config) Hitable {
 	sphere = NewStationarySphere(
 		Vec3{-1, 0, -1},
 		-0.45,
-		NewDielectric(1.5),
+		materials.tag(NewDielectric(1.5)),
 	)
 
 	world.add(sphere)
@@ -66,40 +62,44 @@ func SimpleScene(config Config) Hitable {
 
 // RandomScene returns a randomly generated HitableList.
 func RandomScene(config Config) Hitable {
+	var materials materialIDs
+
+	rng := NewRand(config.seed)
+
 	var hitableList HitableList
 
 	sphere := NewStationarySphere(
 		Vec3{0, -1000, 0},
 		1000,
-		NewLambertian(
+		materials.tag(NewLambertian(
 			ConstantTexture{Vec3{0.5, 0.5, 0.5}},
-		),
+		)),
 	)
 
 	hitableList.add(sphere)
 
 	for a := -11; a < 11; a++ {
 		for b := -11; b < 11; b++ {
-			chooseMaterial := rand.Float64()
+			chooseMaterial := rng.Float64()
 			center := Vec3{
-				float64(a) + 0.9*rand.Float64(),
+				float64(a) + 0.9*rng.Float64(),
 				0.2,
-				float64(b) + 0.9*rand.Float64(),
+				float64(b) + 0.9*rng.Float64(),
 			}
 
 			if center.subtract(Vec3{4, 0.2, 0}).length() > 0.9 {
 				if chooseMaterial < 0.8 {
 					sphere := NewMovingSphere(
 						center,
-						center.add(Vec3{0, 0.5 * rand.Float64(), 0}),
+						center.add(Vec3{0, 0.5 * rng.Float64(), 0}),
 						0.2,
-						NewLambertian(
+						materials.tag(NewLambertian(
 							ConstantTexture{Vec3{
-								rand.Float64() * rand.Float64(),
-								rand.Float64() * rand.Float64(),
-								rand.Float64() * rand.Float64(),
+								rng.Float64() * rng.Float64(),
+								rng.Float64() * rng.Float64(),
+								rng.Float64() * rng.Float64(),
 							}},
-						),
+						)),
 						0,
 						1,
 					)
@@ -110,14 +110,14 @@ func RandomScene(config Config) Hitable {
 					sphere := NewStationarySphere(
 						center,
 						0.2,
-						NewMetal(
+						materials.tag(NewMetal(
 							Vec3{
-								0.5 * (1 + rand.Float64()),
-								0.5 * (1 + rand.Float64()),
-								0.5 * (1 + rand.Float64()),
+								0.5 * (1 + rng.Float64()),
+								0.5 * (1 + rng.Float64()),
+								0.5 * (1 + rng.Float64()),
 							},
-							0.5*rand.Float64(),
-						),
+							0.5*rng.Float64(),
+						)),
 					)
 
 					hitableList.add(sphere)
@@ -126,7 +126,7 @@ func RandomScene(config Config) Hitable {
 					sphere := NewStationarySphere(
 						center,
 						0.2,
-						NewDielectric(1.5),
+						materials.tag(NewDielectric(1.5)),
 					)
 
 					hitableList.add(sphere)
@@ -138,7 +138,7 @@ func RandomScene(config Config) Hitable {
 	sphere = NewStationarySphere(
 		Vec3{0, 1, 0},
 		1.0,
-		NewDielectric(1.5),
+		materials.tag(NewDielectric(1.5)),
 	)
 
 	hitableList.add(sphere)
@@ -146,9 +146,9 @@ func RandomScene(config Config) Hitable {
 	sphere = NewStationarySphere(
 		Vec3{-4, 1, 0},
 		1.0,
-		NewLambertian(
+		materials.tag(NewLambertian(
 			ConstantTexture{Vec3{0.4, 0.2, 0.1}},
-		),
+		)),
 	)
 
 	hitableList.add(sphere)
@@ -156,33 +156,35 @@ func RandomScene(config Config) Hitable {
 	sphere = NewStationarySphere(
 		Vec3{4, 1, 0},
 		1.0,
-		NewMetal(
+		materials.tag(NewMetal(
 			Vec3{
 				0.7,
 				0.6,
 				0.5,
 			},
 			0.0,
-		),
+		)),
 	)
 
 	hitableList.add(sphere)
 
-	bvhNodes := BVHNode{}
-
-	return bvhNodes.newBVHNode(&hitableList, config.timeStart, config.timeEnd)
+	return NewBVHNode(NumberObjects(hitableList), config.timeStart, config.timeEnd)
 }
 
 // TwoSpheres is a scene consisting of two checkered spheres.
 func TwoSpheres(config Config) Hitable {
+	var materials materialIDs
+
 	hitables := NewHitableList(0)
 
-	marbleTexture := NewMarbleTexture(4)
+	rng := NewRand(config.seed)
+
+	marbleTexture := NewMarbleTexture(4, rng)
 
 	sphere := NewStationarySphere(
 		Vec3{0, -1000, 0},
 		1000,
-		NewLambertian(marbleTexture),
+		materials.tag(NewLambertian(marbleTexture)),
 	)
 
 	hitables.add(sphere)
@@ -190,7 +192,7 @@ func TwoSpheres(config Config) Hitable {
 	sphere = NewStationarySphere(
 		Vec3{0, 2, 0},
 		2,
-		NewLambertian(marbleTexture),
+		materials.tag(NewLambertian(marbleTexture)),
 	)
 
 	hitables.add(sphere)
@@ -198,21 +200,16 @@ func TwoSpheres(config Config) Hitable {
 	return hitables
 }
 
-// EarthSphere returns a single Sphere wrapped in an image texture.
-func EarthSphere(config Config, imageFileName string) Hitable {
-	hitables := NewHitableList(0)
+// EarthSphere returns a single Sphere wrapped in an image texture, or an error when the
+// image cannot be read.
+func EarthSphere(config Config, imageFileName string) (Hitable, error) {
+	var materials materialIDs
 
-	imageFile, err := os.Open(imageFileName)
-	defer imageFile.Close()
-
-	if err != nil {
-		panic(err)
-	}
-
-	img, _, err := image.Decode(imageFile)
+	hitables := NewHitableList(0)
 
+	img, err := LoadImage(imageFileName)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	imageTexture := NewImageTexture(img)
@@ -220,24 +217,28 @@ func EarthSphere(config Config, imageFileName string) Hitable {
 	sphere := NewStationarySphere(
 		Vec3{0, 0, 0},
 		2,
-		NewLambertian(imageTexture),
+		materials.tag(NewLambertian(imageTexture)),
 	)
 
 	hitables.add(sphere)
 
-	return hitables
+	return hitables, nil
 }
 
 // SimpleLight returns a scene with simple lighting.
 func SimpleLight(config Config) Hitable {
-	noiseTexture := NewNoiseTexture(4)
+	var materials materialIDs
+
+	rng := NewRand(config.seed)
+
+	noiseTexture := NewNoiseTexture(4, rng)
 
 	hitables := NewHitableList(0)
 
 	sphere := NewStationarySphere(
 		Vec3{0, -1000, 0},
 		1000,
-		NewLambertian(noiseTexture),
+		materials.tag(NewLambertian(noiseTexture)),
 	)
 
 	hitables.add(sphere)
@@ -245,7 +246,7 @@ func SimpleLight(config Config) Hitable {
 	sphere = NewStationarySphere(
 		Vec3{0, 2, 0},
 		2,
-		NewLambertian(noiseTexture),
+		materials.tag(NewLambertian(noiseTexture)),
 	)
 
 	hitables.add(sphere)
@@ -253,11 +254,11 @@ func SimpleLight(config Config) Hitable {
 	sphere = NewStationarySphere(
 		Vec3{0, 7, 0},
 		2,
-		DiffuseLight{
+		materials.tag(DiffuseLight{
 			ConstantTexture{
 				Vec3{4, 4, 4},
 			},
-		},
+		}),
 	)
 
 	hitables.add(sphere)
@@ -268,11 +269,11 @@ func SimpleLight(config Config) Hitable {
 		1,
 		3,
 		-2,
-		DiffuseLight{
+		materials.tag(DiffuseLight{
 			ConstantTexture{
 				Vec3{4, 4, 4},
 			},
-		},
+		}),
 	}
 
 	hitables.add(rectangle)
@@ -282,10 +283,12 @@ func SimpleLight(config Config) Hitable {
 
 // CornellBox is the standard Cornell scene.
 func CornellBox(config Config) (world Hitable, lightShapes Hitable) {
+	var materials materialIDs
+
 	hitables := NewHitableList(0)
 	lightShapeList := NewHitableList(0)
 
-	red := NewLambertian(
+	red := materials.tag(NewLambertian(
 		ConstantTexture{
 			Vec3{
 				0.65,
@@ -293,9 +296,9 @@ func CornellBox(config Config) (world Hitable, lightShapes Hitable) {
 				0.05,
 			},
 		},
-	)
+	))
 
-	white := NewLambertian(
+	white := materials.tag(NewLambertian(
 		ConstantTexture{
 			Vec3{
 				0.73,
@@ -303,9 +306,9 @@ func CornellBox(config Config) (world Hitable, lightShapes Hitable) {
 				0.73,
 			},
 		},
-	)
+	))
 
-	green := NewLambertian(
+	green := materials.tag(NewLambertian(
 		ConstantTexture{
 			Vec3{
 				0.12,
@@ -313,11 +316,11 @@ func CornellBox(config Config) (world Hitable, lightShapes Hitable) {
 				0.15,
 			},
 		},
-	)
+	))
 
-	glass := NewDielectric(1.5)
+	glass := materials.tag(NewDielectric(1.5))
 
-	light := DiffuseLight{
+	light := materials.tag(DiffuseLight{
 		ConstantTexture{
 			Vec3{
 				15,
@@ -325,7 +328,7 @@ func CornellBox(config Config) (world Hitable, lightShapes Hitable) {
 				15,
 			},
 		},
-	}
+	})
 
 	lightShape := XZRectangle{
 		213,
@@ -420,10 +423,10 @@ func CornellBox(config Config) (world Hitable, lightShapes Hitable) {
 
 	hitables.add(box)
 
-	aluminum := NewMetal(
+	aluminum := materials.tag(NewMetal(
 		Vec3{0.8, 0.85, 0.88},
 		0,
-	)
+	))
 
 	box = Translate{
 		NewRotateY(
@@ -443,10 +446,13 @@ func CornellBox(config Config) (world Hitable, lightShapes Hitable) {
 }
 
 // CornellSmoke is a smokey version of the Cornell box.
-func CornellSmoke(config Config) Hitable {
+func CornellSmoke(config Config) (world Hitable, lightShapes Hitable) {
+	var materials materialIDs
+
 	hitables := NewHitableList(0)
+	lightShapeList := NewHitableList(0)
 
-	red := NewLambertian(
+	red := materials.tag(NewLambertian(
 		ConstantTexture{
 			Vec3{
 				0.65,
@@ -454,9 +460,9 @@ func CornellSmoke(config Config) Hitable {
 				0.05,
 			},
 		},
-	)
+	))
 
-	white := NewLambertian(
+	white := materials.tag(NewLambertian(
 		ConstantTexture{
 			Vec3{
 				0.73,
@@ -464,9 +470,9 @@ func CornellSmoke(config Config) Hitable {
 				0.73,
 			},
 		},
-	)
+	))
 
-	green := NewLambertian(
+	green := materials.tag(NewLambertian(
 		ConstantTexture{
 			Vec3{
 				0.12,
@@ -474,9 +480,9 @@ func CornellSmoke(config Config) Hitable {
 				0.15,
 			},
 		},
-	)
+	))
 
-	light := DiffuseLight{
+	light := materials.tag(DiffuseLight{
 		ConstantTexture{
 			Vec3{
 				7,
@@ -484,7 +490,7 @@ func CornellSmoke(config Config) Hitable {
 				7,
 			},
 		},
-	}
+	})
 
 	flippedYZRectangle := FlipNormals{YZRectangle{
 		0,
@@ -508,7 +514,7 @@ func CornellSmoke(config Config) Hitable {
 
 	hitables.add(yzRectangle)
 
-	xzRectangle := XZRectangle{
+	lightShape := XZRectangle{
 		113,
 		443,
 		127,
@@ -517,9 +523,13 @@ func CornellSmoke(config Config) Hitable {
 		light,
 	}
 
-	hitables.add(xzRectangle)
+	lightShapeList.add(lightShape)
+
+	flippedXZRectangle := FlipNormals{lightShape}
 
-	flippedXZRectangle := FlipNormals{XZRectangle{
+	hitables.add(flippedXZRectangle)
+
+	flippedXZRectangle = FlipNormals{XZRectangle{
 		0,
 		555,
 		0,
@@ -530,7 +540,7 @@ func CornellSmoke(config Config) Hitable {
 
 	hitables.add(flippedXZRectangle)
 
-	xzRectangle = XZRectangle{
+	xzRectangle := XZRectangle{
 		0,
 		555,
 		0,
@@ -588,5 +598,5 @@ func CornellSmoke(config Config) Hitable {
 
 	hitables.add(cm2)
 
-	return hitables
+	return hitables, lightShapeList
 }
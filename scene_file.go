@@ -0,0 +1,805 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+)
+
+// Scene is everything needed to render: the settings, the world and the shapes
+// to sample light from.
+type Scene struct {
+	config      Config
+	world       Hitable
+	lightShapes Hitable
+	// frame builds the scene for a frame of an animation, when rendering one.
+	frame func(n int) (Scene, error)
+}
+
+// LoadScene reads a JSON scene file. Settings missing from the file are taken from config,
+// and override, when there is one, changes the settings read before the shapes are built.
+func LoadScene(filename string, config Config, override func(Config) Config) (Scene, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return Scene{}, err
+	}
+
+	root, err := ParseSceneJSON(filename, data)
+	if err != nil {
+		return Scene{}, err
+	}
+
+	config.scene = fmt.Sprintf("%s %x", filepath.Base(filename), sha256.Sum256(data))
+
+	loader := sceneLoader{
+		dir:       filepath.Dir(filename),
+		config:    config,
+		override:  override,
+		textures:  make(map[string]Texture),
+		materials: make(map[string]Material),
+	}
+
+	return loader.load(root)
+}
+
+type sceneLoader struct {
+	dir           string
+	config        Config
+	override      func(Config) Config
+	rng           *rand.Rand
+	textures      map[string]Texture
+	materials     map[string]Material
+	lightShapes   HitableList
+	materialCount int
+	// files are the files read besides the scene, whose contents identify it along
+	// with the scene's own.
+	files []string
+}
+
+func (l *sceneLoader) load(root *SceneNode) (Scene, error) {
+	scene := NewSceneObject(root, "render", "camera", "textures", "materials", "shapes", "bvh")
+
+	if scene.has("render") {
+		if err := l.loadRender(scene.get("render")); err != nil {
+			return Scene{}, err
+		}
+	}
+
+	if scene.has("camera") {
+		if err := l.loadCamera(scene.get("camera")); err != nil {
+			return Scene{}, err
+		}
+	}
+
+	// The shapes are built with the final settings, such as the shutter interval that
+	// their bounds cover.
+	if l.override != nil {
+		l.config = l.override(l.config)
+	}
+
+	l.rng = NewRand(l.config.seed)
+
+	if scene.has("textures") {
+		if err := l.loadNamed(scene.get("textures"), l.defineTexture); err != nil {
+			return Scene{}, err
+		}
+	}
+
+	if scene.has("materials") {
+		if err := l.loadNamed(scene.get("materials"), l.defineMaterial); err != nil {
+			return Scene{}, err
+		}
+	}
+
+	shapes := scene.get("shapes")
+	useBVH := scene.boolOr("bvh", false)
+
+	if scene.err != nil {
+		return Scene{}, scene.err
+	}
+
+	world, err := l.shapeList(shapes, useBVH, true)
+	if err != nil {
+		return Scene{}, err
+	}
+
+	for _, file := range l.files {
+		l.config.scene += " " + fileDigest(file)
+	}
+
+	return Scene{l.config, world, l.lightShapes, nil}, nil
+}
+
+func (l *sceneLoader) loadRender(node *SceneNode) error {
+	render := NewSceneObject(node, "width", "height", "samples", "minSamples", "adaptiveThreshold", "passSamples", "output", "seed", "threads", "frames", "fps")
+
+	l.config.width = render.positiveIntegerOr("width", l.config.width)
+	l.config.height = render.positiveIntegerOr("height", l.config.height)
+	l.config.samples = render.positiveIntegerOr("samples", l.config.samples)
+	l.config.minSamples = render.positiveIntegerOr("minSamples", l.config.minSamples)
+	l.config.adaptiveThreshold = render.numberOr("adaptiveThreshold", l.config.adaptiveThreshold)
+	l.config.passSamples = render.positiveIntegerOr("passSamples", l.config.passSamples)
+	l.config.filename = render.strOr("output", l.config.filename)
+	l.config.seed = int64(render.integerOr("seed", int(l.config.seed)))
+	l.config.threads = render.integerOr("threads", l.config.threads)
+	l.config.fps = render.numberOr("fps", l.config.fps)
+
+	if render.has("frames") {
+		frames := render.integers("frames")
+
+		if render.err == nil && len(frames) != 2 {
+			render.fail(render.get("frames"), "\"frames\" should be [first, last]")
+		}
+
+		if render.err == nil {
+			l.config.sequence = true
+			l.config.frameStart, l.config.frameEnd = frames[0], frames[1]
+		}
+	}
+
+	return render.err
+}
+
+func (l *sceneLoader) loadCamera(node *SceneNode) error {
+	camera := NewSceneObject(node, "from", "at", "up", "fov", "projection", "orthoHeight", "stereo", "eyeSeparation", "convergence", "convergenceDistance", "aperture", "blades", "bladeRotation", "apertureMask", "catsEye", "tilt", "tiltRotation", "lensShift", "squeeze", "focusDistance", "shutter", "shutterCurve", "rollingShutter", "shutterAngle")
+	animation := &l.config.cameraAnimation
+
+	l.config.from = starting(camera.vec3TrackOr("from", l.config.from), &animation.from)
+	l.config.at = starting(camera.vec3TrackOr("at", l.config.at), &animation.at)
+	l.config.up = starting(camera.vec3TrackOr("up", l.config.up), &animation.up)
+	l.config.fov = starting(camera.numberTrackOr("fov", l.config.fov), &animation.fov).x()
+	l.config.orthoHeight = camera.numberOr("orthoHeight", l.config.orthoHeight)
+	l.config.eyeSeparation = camera.numberOr("eyeSeparation", l.config.eyeSeparation)
+	l.config.blades = camera.integerOr("blades", l.config.blades)
+	l.config.bladeRotation = camera.numberOr("bladeRotation", l.config.bladeRotation)
+	l.config.catsEye = camera.numberOr("catsEye", l.config.catsEye)
+	l.config.tilt = camera.numberOr("tilt", l.config.tilt)
+	l.config.tiltRotation = camera.numberOr("tiltRotation", l.config.tiltRotation)
+	l.config.squeeze = camera.numberOr("squeeze", l.config.squeeze)
+	l.config.rollingShutter = camera.numberOr("rollingShutter", l.config.rollingShutter)
+	l.config.convergenceDistance = camera.numberOr("convergenceDistance", l.config.convergenceDistance)
+	l.config.shutterAngle = camera.numberOr("shutterAngle", l.config.shutterAngle)
+	l.config.aperture = starting(camera.numberTrackOr("aperture", l.config.aperture), &animation.aperture).x()
+	l.config.focus = starting(camera.numberTrackOr("focusDistance", l.config.focus), &animation.focus).x()
+
+	if camera.has("shutter") {
+		l.config.timeStart, l.config.timeEnd = camera.span("shutter")
+	}
+
+	if camera.has("projection") {
+		projection, err := ParseProjection(camera.str("projection"))
+		if err != nil {
+			camera.fail(camera.get("projection"), "%v", err)
+		}
+
+		l.config.projection = projection
+	}
+
+	if camera.has("shutterCurve") {
+		curve, err := ParseShutterCurve(camera.str("shutterCurve"))
+		if err != nil {
+			camera.fail(camera.get("shutterCurve"), "%v", err)
+		}
+
+		l.config.shutterCurve = curve
+	}
+
+	if camera.has("apertureMask") {
+		l.config.apertureMask = camera.str("apertureMask")
+
+		if !filepath.IsAbs(l.config.apertureMask) {
+			l.config.apertureMask = filepath.Join(l.dir, l.config.apertureMask)
+		}
+	}
+
+	if camera.has("lensShift") {
+		shift := camera.numbers("lensShift", 2)
+		l.config.shiftX, l.config.shiftY = shift[0], shift[1]
+	}
+
+	if camera.has("stereo") {
+		stereo, err := ParseStereoLayout(camera.str("stereo"))
+		if err != nil {
+			camera.fail(camera.get("stereo"), "%v", err)
+		}
+
+		l.config.stereo = stereo
+	}
+
+	if camera.has("convergence") {
+		convergence, err := ParseConvergence(camera.str("convergence"))
+		if err != nil {
+			camera.fail(camera.get("convergence"), "%v", err)
+		}
+
+		l.config.convergence = convergence
+	}
+
+	if camera.err == nil && l.config.from == l.config.at {
+		return node.errorf("camera \"from\" and \"at\" must differ")
+	}
+
+	return camera.err
+}
+
+// starting returns the value a Track starts from, keeping the Track in animation when
+// it moves.
+func starting(track Track, animation *Track) Vec3 {
+	if track.animated() {
+		*animation = track
+	}
+
+	return track[0].value
+}
+
+// loadNamed defines each entry of an object of named textures or materials, in file order.
+func (l *sceneLoader) loadNamed(node *SceneNode, define func(name string, node *SceneNode) error) error {
+	if !node.isObject() {
+		return node.errorf("expected an object of names, got %s", node.describe())
+	}
+
+	for _, name := range node.keys {
+		if err := define(name, node.fields[name]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (l *sceneLoader) defineTexture(name string, node *SceneNode) error {
+	texture, err := l.texture(node)
+	if err != nil {
+		return err
+	}
+
+	l.textures[name] = texture
+
+	return nil
+}
+
+func (l *sceneLoader) defineMaterial(name string, node *SceneNode) error {
+	material, err := l.material(node)
+	if err != nil {
+		return err
+	}
+
+	l.materials[name] = material
+
+	return nil
+}
+
+// texture accepts the name of a texture, an [r, g, b] color or a texture object.
+func (l *sceneLoader) texture(node *SceneNode) (Texture, error) {
+	if name, ok := node.value.(string); ok {
+		texture, found := l.textures[name]
+
+		if !found {
+			return nil, node.errorf("unknown texture %q", name)
+		}
+
+		return texture, nil
+	}
+
+	if node.isArray() {
+		color := &SceneObject{node: node}
+		e := color.numberArray(node, "color", 3)
+
+		return ConstantTexture{Vec3{e[0], e[1], e[2]}}, color.err
+	}
+
+	object := NewSceneObject(node, "type", "color", "odd", "even", "scale", "file")
+	kind := object.str("type")
+
+	if object.err != nil {
+		return nil, object.err
+	}
+
+	switch kind {
+	case "constant":
+		object := NewSceneObject(node, "type", "color")
+		color := object.vec3("color")
+
+		return ConstantTexture{color}, object.err
+	case "checker":
+		object := NewSceneObject(node, "type", "odd", "even")
+		odd := object.get("odd")
+		even := object.get("even")
+
+		if object.err != nil {
+			return nil, object.err
+		}
+
+		oddTexture, err := l.texture(odd)
+		if err != nil {
+			return nil, err
+		}
+
+		evenTexture, err := l.texture(even)
+		if err != nil {
+			return nil, err
+		}
+
+		return CheckerTexture{oddTexture, evenTexture}, nil
+	case "noise":
+		object := NewSceneObject(node, "type", "scale")
+		scale := object.numberOr("scale", 1)
+
+		return NewNoiseTexture(scale, l.rng), object.err
+	case "marble":
+		object := NewSceneObject(node, "type", "scale")
+		scale := object.numberOr("scale", 1)
+
+		return NewMarbleTexture(scale, l.rng), object.err
+	case "image":
+		object := NewSceneObject(node, "type", "file")
+		file := object.str("file")
+
+		if object.err != nil {
+			return nil, object.err
+		}
+
+		img, err := l.image(file)
+		if err != nil {
+			return nil, node.errorf("%v", err)
+		}
+
+		return NewImageTexture(img), nil
+	}
+
+	return nil, node.fields["type"].errorf("unknown texture type %q", kind)
+}
+
+func (l *sceneLoader) image(file string) (image.Image, error) {
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(l.dir, file)
+	}
+
+	l.files = append(l.files, file)
+
+	return LoadImage(file)
+}
+
+// material accepts the name of a material or a material object. Materials are numbered
+// for the material ID AOV in the order they are defined.
+func (l *sceneLoader) material(node *SceneNode) (Material, error) {
+	if _, ok := node.value.(string); ok {
+		return l.namedMaterial(node)
+	}
+
+	material, err := l.newMaterial(node)
+	if err != nil {
+		return nil, err
+	}
+
+	l.materialCount++
+
+	return MaterialID{material, l.materialCount}, nil
+}
+
+func (l *sceneLoader) namedMaterial(node *SceneNode) (Material, error) {
+	material, found := l.materials[node.value.(string)]
+
+	if !found {
+		return nil, node.errorf("unknown material %q", node.value)
+	}
+
+	return material, nil
+}
+
+func (l *sceneLoader) newMaterial(node *SceneNode) (Material, error) {
+	object := NewSceneObject(node, "type", "texture", "albedo", "fuzz", "index", "emit")
+	kind := object.str("type")
+
+	if object.err != nil {
+		return nil, object.err
+	}
+
+	switch kind {
+	case "lambertian":
+		object = NewSceneObject(node, "type", "texture")
+
+		return l.texturedMaterial(object, "texture", MaterialLambertian, func(texture Texture) Material {
+			return NewLambertian(texture)
+		})
+	case "metal":
+		object = NewSceneObject(node, "type", "albedo", "fuzz")
+		albedo := object.track("albedo", 3)
+		fuzz := object.numberTrackOr("fuzz", 0)
+
+		return NewAnimatedMaterial(MaterialMetal, albedo, fuzz), object.err
+	case "dielectric":
+		object = NewSceneObject(node, "type", "index")
+		index := object.track("index", 1)
+
+		for _, key := range index {
+			if object.err == nil && key.value.x() <= 0 {
+				return nil, node.fields["index"].errorf("\"index\" should be positive, got %v", key.value.x())
+			}
+		}
+
+		return NewAnimatedMaterial(MaterialDielectric, nil, index), object.err
+	case "light":
+		object = NewSceneObject(node, "type", "emit")
+
+		return l.texturedMaterial(object, "emit", MaterialLight, func(emit Texture) Material {
+			return DiffuseLight{emit}
+		})
+	case "isotropic":
+		object = NewSceneObject(node, "type", "texture")
+
+		return l.texturedMaterial(object, "texture", MaterialIsotropic, func(texture Texture) Material {
+			return Isotropic{texture}
+		})
+	}
+
+	return nil, node.fields["type"].errorf("unknown material type %q", kind)
+}
+
+// texturedMaterial builds a material from a texture, or a material of the kind from a
+// keyframed color at the time of each ray.
+func (l *sceneLoader) texturedMaterial(object *SceneObject, key string, kind MaterialKind, build func(texture Texture) Material) (Material, error) {
+	if keyframed(object.get(key)) {
+		return NewAnimatedMaterial(kind, object.track(key, 3), nil), object.err
+	}
+
+	texture, err := l.textureField(object, key)
+
+	return build(texture), err
+}
+
+func (l *sceneLoader) textureField(object *SceneObject, key string) (Texture, error) {
+	node := object.get(key)
+
+	if object.err != nil {
+		return nil, object.err
+	}
+
+	return l.texture(node)
+}
+
+// shapeList loads an array of shapes, numbering them for the object ID AOV at the top level.
+func (l *sceneLoader) shapeList(node *SceneNode, useBVH, topLevel bool) (Hitable, error) {
+	if !node.isArray() {
+		return nil, node.errorf("expected an array of shapes, got %s", node.describe())
+	}
+
+	hitables := NewHitableList(0)
+
+	for _, item := range node.items {
+		hitable, err := l.shape(item)
+		if err != nil {
+			return nil, err
+		}
+
+		hitables.add(hitable)
+	}
+
+	if topLevel {
+		hitables = NumberObjects(hitables)
+	}
+
+	if useBVH && len(hitables) > 0 {
+		return NewBVHNode(hitables, l.config.timeStart, l.config.timeEnd), nil
+	}
+
+	return hitables, nil
+}
+
+var shapeKeys = []string{"type", "material", "transforms", "medium", "sampleLight"}
+
+func (l *sceneLoader) shape(node *SceneNode) (Hitable, error) {
+	object := NewSceneObject(node, append(shapeKeys,
+		"center", "center1", "time0", "time1", "radius", "x", "y", "z", "min", "max", "shapes", "bvh",
+		"vertices", "positions", "normals", "uvs", "indices", "file")...)
+	kind := object.str("type")
+
+	if object.err != nil {
+		return nil, object.err
+	}
+
+	var hitable Hitable
+	var err error
+
+	// lights are the parts of the shape to sample light from, when not the whole shape.
+	var lights HitableList
+
+	switch kind {
+	case "sphere":
+		hitable, err = l.sphere(node)
+	case "xyRect":
+		hitable, err = l.rectangle(node, "x", "y", "z")
+	case "xzRect":
+		hitable, err = l.rectangle(node, "x", "z", "y")
+	case "yzRect":
+		hitable, err = l.rectangle(node, "y", "z", "x")
+	case "box":
+		object := NewSceneObject(node, append(shapeKeys, "min", "max")...)
+		p0 := object.vec3("min")
+		p1 := object.vec3("max")
+		material := l.shapeMaterial(object)
+
+		hitable, err = NewBox(p0, p1, material), object.err
+	case "triangle":
+		object := NewSceneObject(node, append(shapeKeys, "vertices", "normals", "uvs")...)
+		hitable, err = l.mesh(object, "vertices", nil)
+	case "mesh":
+		object := NewSceneObject(node, append(shapeKeys, "positions", "normals", "uvs", "indices")...)
+		indices := object.integers("indices")
+		hitable, err = l.mesh(object, "positions", indices)
+	case "group":
+		object := NewSceneObject(node, "type", "transforms", "medium", "sampleLight", "shapes", "bvh")
+		shapes := object.get("shapes")
+		useBVH := object.boolOr("bvh", false)
+
+		if object.err != nil {
+			return nil, object.err
+		}
+
+		hitable, err = l.shapeList(shapes, useBVH, false)
+	case "obj":
+		object := NewSceneObject(node, "type", "transforms", "medium", "sampleLight", "file")
+		file := object.str("file")
+
+		if object.err != nil {
+			return nil, object.err
+		}
+
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(l.dir, file)
+		}
+
+		model, loadErr := LoadOBJ(file, l.materialCount+1)
+		if loadErr != nil {
+			return nil, node.fields["file"].errorf("%v", loadErr)
+		}
+
+		l.materialCount += model.materials
+
+		// Sampling an OBJ samples its emissive parts, so there must be some.
+		if sampleLight, ok := node.fields["sampleLight"]; ok && sampleLight.value == true && len(model.lights) == 0 {
+			return nil, sampleLight.errorf("obj has no emissive materials to sample")
+		}
+
+		hitable, lights = model.hitable, model.lights
+		l.files = append(l.files, model.files...)
+	default:
+		return nil, node.fields["type"].errorf("unknown shape type %q", kind)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return l.decorate(hitable, lights, node)
+}
+
+// decorate applies the transforms, medium and light sampling common to all shapes.
+func (l *sceneLoader) decorate(hitable Hitable, lights HitableList, node *SceneNode) (Hitable, error) {
+	hitable, err := l.transforms(hitable, node)
+	if err != nil {
+		return nil, err
+	}
+
+	if medium, ok := node.fields["medium"]; ok {
+		object := NewSceneObject(medium, "density", "texture")
+		density := object.number("density")
+		texture, err := l.textureField(object, "texture")
+
+		if err != nil {
+			return nil, err
+		}
+
+		if object.err != nil {
+			return nil, object.err
+		}
+
+		if density <= 0 {
+			return nil, medium.fields["density"].errorf("\"density\" should be positive, got %v", density)
+		}
+
+		hitable = NewConstantMedium(hitable, density, texture)
+	}
+
+	if sampleLight, ok := node.fields["sampleLight"]; ok {
+		value, isBool := sampleLight.value.(bool)
+
+		if !isBool {
+			return nil, sampleLight.errorf("\"sampleLight\" should be true or false, got %s", sampleLight.describe())
+		}
+
+		if value && lights == nil {
+			l.lightShapes.add(hitable)
+		} else if value {
+			for _, light := range lights {
+				light, err = l.transforms(light, node)
+				if err != nil {
+					return nil, err
+				}
+
+				l.lightShapes.add(light)
+			}
+		}
+	}
+
+	return hitable, nil
+}
+
+// transforms applies the transforms of a shape in order.
+func (l *sceneLoader) transforms(hitable Hitable, node *SceneNode) (Hitable, error) {
+	transforms, ok := node.fields["transforms"]
+
+	if !ok {
+		return hitable, nil
+	}
+
+	if !transforms.isArray() {
+		return nil, transforms.errorf("expected an array of transforms, got %s", transforms.describe())
+	}
+
+	for _, transform := range transforms.items {
+		var err error
+
+		hitable, err = l.transform(hitable, transform)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return hitable, nil
+}
+
+func (l *sceneLoader) transform(hitable Hitable, node *SceneNode) (Hitable, error) {
+	object := NewSceneObject(node, "translate", "rotateY", "flip")
+
+	if object.err == nil && len(node.keys) != 1 {
+		return nil, node.errorf("a transform should have exactly one of \"translate\", \"rotateY\" or \"flip\"")
+	}
+
+	switch {
+	case object.has("translate"):
+		offset := object.track("translate", 3)
+
+		if offset.animated() {
+			return AnimatedTranslate{hitable, offset, l.midShutter()}, object.err
+		}
+
+		return Translate{hitable, offset[0].value}, object.err
+	case object.has("rotateY"):
+		angle := object.track("rotateY", 1)
+
+		if angle.animated() {
+			return AnimatedRotateY{hitable, angle, l.midShutter()}, object.err
+		}
+
+		return NewRotateY(hitable, angle[0].value.x()), object.err
+	case object.has("flip"):
+		if !object.boolOr("flip", false) {
+			return hitable, object.err
+		}
+
+		return FlipNormals{hitable}, object.err
+	}
+
+	return nil, object.err
+}
+
+// midShutter returns the time halfway through the shutter interval the scene is built
+// for, where moving lights are sampled.
+func (l *sceneLoader) midShutter() float64 {
+	return (l.config.timeStart + l.config.timeEnd) / 2
+}
+
+func (l *sceneLoader) shapeMaterial(object *SceneObject) Material {
+	node := object.get("material")
+
+	if object.err != nil {
+		return nil
+	}
+
+	material, err := l.material(node)
+
+	if err != nil {
+		object.err = err
+	}
+
+	return material
+}
+
+func (l *sceneLoader) sphere(node *SceneNode) (Hitable, error) {
+	object := NewSceneObject(node, append(shapeKeys, "center", "center1", "time0", "time1", "radius")...)
+	center := object.vec3("center")
+	radius := object.number("radius")
+	material := l.shapeMaterial(object)
+
+	if object.err == nil && radius == 0 {
+		return nil, node.fields["radius"].errorf("\"radius\" should not be zero")
+	}
+
+	if object.has("center1") {
+		center1 := object.vec3("center1")
+		time0 := object.numberOr("time0", l.config.timeStart)
+		time1 := object.numberOr("time1", l.config.timeEnd)
+
+		if object.err == nil && time0 == time1 {
+			return nil, node.errorf("a moving sphere needs \"time0\" and \"time1\" to differ")
+		}
+
+		return NewMovingSphere(center, center1, radius, material, time0, time1), object.err
+	}
+
+	return NewStationarySphere(center, radius, material), object.err
+}
+
+// mesh reads a TriangleMesh, or a single Triangle if there are no indices.
+func (l *sceneLoader) mesh(object *SceneObject, positionsKey string, indices []int) (Hitable, error) {
+	positions := object.vectors(positionsKey, 3)
+	normals := object.vectorsOr("normals", 3)
+	uvs := object.vectorsOr("uvs", 2)
+	material := l.shapeMaterial(object)
+
+	if object.err != nil {
+		return nil, object.err
+	}
+
+	node := object.node
+
+	if indices == nil {
+		if len(positions) != 3 {
+			return nil, node.fields[positionsKey].errorf("a triangle needs 3 vertices, got %d", len(positions))
+		}
+
+		indices = []int{0, 1, 2}
+	}
+
+	if len(indices) == 0 || len(indices)%3 != 0 {
+		return nil, node.fields["indices"].errorf("\"indices\" should hold three per triangle, got %d", len(indices))
+	}
+
+	for _, index := range indices {
+		if index < 0 || index >= len(positions) {
+			return nil, node.fields["indices"].errorf("index %d is out of range for %d positions", index, len(positions))
+		}
+	}
+
+	if normals != nil && len(normals) != len(positions) {
+		return nil, node.fields["normals"].errorf("expected %d normals, got %d", len(positions), len(normals))
+	}
+
+	if uvs != nil && len(uvs) != len(positions) {
+		return nil, node.fields["uvs"].errorf("expected %d uvs, got %d", len(positions), len(uvs))
+	}
+
+	mesh := NewTriangleMesh(positions, normals, uvs, indices, material)
+
+	if len(mesh.triangles) == 1 {
+		return mesh.triangles[0], nil
+	}
+
+	return mesh, nil
+}
+
+// rectangle reads an axis-aligned rectangle spanning axes a and b, at position k on the third axis.
+func (l *sceneLoader) rectangle(node *SceneNode, a, b, k string) (Hitable, error) {
+	object := NewSceneObject(node, append(shapeKeys, a, b, k)...)
+	a0, a1 := object.span(a)
+	b0, b1 := object.span(b)
+	position := object.number(k)
+	material := l.shapeMaterial(object)
+
+	if object.err != nil {
+		return nil, object.err
+	}
+
+	switch k {
+	case "z":
+		return XYRectangle{a0, a1, b0, b1, position, material}, nil
+	case "y":
+		return XZRectangle{a0, a1, b0, b1, position, material}, nil
+	}
+
+	return YZRectangle{a0, a1, b0, b1, position, material}, nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestLoadSceneCornellBox(t *testing.T) {
+	scene, err := LoadScene("scenes/cornell_box.json", Config{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if scene.config.width != 500 || scene.config.samples != 1000 || scene.config.fov != 40 {
+		t.Errorf("Settings not loaded: %+v", scene.config)
+	}
+
+	if len(scene.world.(HitableList)) != 9 {
+		t.Errorf("Expected 9 shapes, got %d", len(scene.world.(HitableList)))
+	}
+
+	if len(scene.lightShapes.(HitableList)) != 2 {
+		t.Errorf("Expected 2 light shapes, got %d", len(scene.lightShapes.(HitableList)))
+	}
+
+	var hit Hit
+
+	// Straight at the tall box, the last shape, which is the fifth material defined.
+	if !scene.world.hit(Ray{Vec3{278, 278, -800}, Vec3{0, 0, 1}, 0}, 0.001, math.MaxFloat64, &hit, nil) {
+		t.Fatalf("Expected to hit the tall box")
+	}
+
+	if hit.objectID != 9 || materialID(hit.material) != 5 {
+		t.Errorf("Expected object 9 and material 5, got %d and %d", hit.objectID, materialID(hit.material))
+	}
+}
+
+func loadSceneString(source string) error {
+	root, err := ParseSceneJSON("test.json", []byte(source))
+	if err != nil {
+		return err
+	}
+
+	loader := sceneLoader{
+		config:    Config{from: Vec3{0, 0, 1}},
+		textures:  make(map[string]Texture),
+		materials: make(map[string]Material),
+	}
+
+	_, err = loader.load(root)
+
+	return err
+}
+
+func TestLoadSceneErrors(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{
+			"{\n  \"shapes\": [\n    {\"type\": \"sphere\", \"center\": [0, 0, 0],\n     \"radius\": 1, \"material\": \"missing\"}\n  ]\n}",
+			"test.json:4: unknown material \"missing\"",
+		},
+		{
+			"{\n  \"shapes\": [\n    {\"type\": \"cone\"}\n  ]\n}",
+			"test.json:3: unknown shape type \"cone\"",
+		},
+		{
+			"{\n  \"shapes\": [\n    {\"type\": \"sphere\",\n     \"center\": [0, 0],\n     \"radius\": 1}\n  ]\n}",
+			"test.json:4: \"center\" should be an array of 3 numbers",
+		},
+		{
+			"{\n  \"camera\": {\n    \"fov\": 40,\n    \"zoom\": 2\n  }\n}",
+			"test.json:4: unknown key \"zoom\"",
+		},
+		{
+			"{\n  \"shapes\": [\n    {\"type\": \"sphere\"},\n  ]\n}",
+			"test.json:3: invalid character",
+		},
+		{
+			"{\n  \"shapes\": [\n    {\"type\": \"mesh\", \"material\": {\"type\": \"dielectric\", \"index\": 1.5},\n     \"positions\": [[0, 0, 0], [1, 0, 0], [0, 1, 0]],\n     \"indices\": [0, 1, 3]}\n  ]\n}",
+			"test.json:5: index 3 is out of range for 3 positions",
+		},
+		{
+			"{\n  \"render\": {\"width\": 10}\n}",
+			"test.json:1: missing required key \"shapes\"",
+		},
+		{
+			"{\n  \"camera\": {\"fov\": {\"keys\": [\n    {\"time\": 1, \"value\": 40},\n    {\"time\": 1, \"value\": 50}\n  ]}}\n}",
+			"test.json:4: key times of \"fov\" should increase",
+		},
+		{
+			"{\n  \"materials\": {\"red\": {\"type\": \"metal\", \"albedo\": {\"keys\": [\n    {\"time\": 0, \"value\": [1, 0, 0], \"interpolation\": \"cubic\"}\n  ]}}}\n}",
+			"test.json:3: unknown interpolation \"cubic\"",
+		},
+	}
+
+	for _, test := range tests {
+		err := loadSceneString(test.source)
+
+		if err == nil || !strings.HasPrefix(err.Error(), test.expected) {
+			t.Errorf("Expected error %q, got %v", test.expected, err)
+		}
+	}
+}
+
+func TestLoadSceneAnimation(t *testing.T) {
+	root, err := ParseSceneJSON("test.json", []byte(`{
+  "render": {"frames": [0, 2], "fps": 1},
+  "camera": {
+    "from": {"keys": [{"time": 0, "value": [0, 0, 10]}, {"time": 1, "value": [0, 0, 20], "interpolation": "step"}]},
+    "at": [0, 0, 0], "up": [0, 1, 0], "fov": 40, "shutterAngle": 360
+  },
+  "materials": {
+    "glow": {"type": "light", "emit": {"keys": [{"time": 0, "value": [1, 1, 1]}, {"time": 2, "value": [3, 3, 3]}]}}
+  },
+  "shapes": [
+    {"type": "sphere", "center": [0, 0, 0], "radius": 1, "material": "glow", "sampleLight": true,
+     "transforms": [{"translate": {"keys": [{"time": 0, "value": [0, 0, 0]}, {"time": 2, "value": [4, 0, 0]}]}}]}
+  ]
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loader := sceneLoader{
+		textures:  make(map[string]Texture),
+		materials: make(map[string]Material),
+	}
+
+	scene, err := loader.load(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frames := scene.config.frames()
+
+	if len(frames) != 3 || frames[0].from != (Vec3{0, 0, 15}) || frames[2].from != (Vec3{0, 0, 20}) {
+		t.Errorf("Camera posed at %v", frames)
+	}
+
+	// Halfway through, the light has moved 2 along x and grown twice as bright.
+	var hit Hit
+
+	r := Ray{Vec3{2, 0, 10}, Vec3{0, 0, -1}, 1}
+
+	if !scene.world.hit(r, 0.001, math.MaxFloat64, &hit, nil) {
+		t.Fatalf("Expected to hit the light where it has moved to")
+	}
+
+	if emitted := hit.material.emitted(r, hit, hit.u, hit.v, hit.p); emitted != (Vec3{2, 2, 2}) {
+		t.Errorf("Light emits %v halfway through", emitted)
+	}
+
+	// Built for the middle frame, the light is sampled where it is halfway through it.
+	loader = sceneLoader{
+		textures:  make(map[string]Texture),
+		materials: make(map[string]Material),
+		override:  func(config Config) Config { return config.frame(1) },
+	}
+
+	scene, err = loader.load(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pdf := scene.lightShapes.pdfValue(Vec3{2.5, 0, 10}, Vec3{0, 0, -1}); pdf <= 0 {
+		t.Errorf("Expected to sample the light where it is at 1.5, got pdf %v", pdf)
+	}
+}
+
+func TestLoadSceneOBJWithoutLights(t *testing.T) {
+	file := writeTestFile(t, t.TempDir(), "dark.obj", "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n")
+
+	err := loadSceneString(fmt.Sprintf("{\n  \"shapes\": [\n    {\"type\": \"obj\", \"file\": %q,\n     \"sampleLight\": true}\n  ]\n}", file))
+
+	if expected := "test.json:4: obj has no emissive materials to sample"; err == nil || err.Error() != expected {
+		t.Errorf("Expected error %q, got %v", expected, err)
+	}
+}
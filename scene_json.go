@@ -0,0 +1,572 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// SceneNode is a JSON value from a scene file that remembers the line it was on.
+type SceneNode struct {
+	file   string
+	line   int
+	value  interface{}
+	keys   []string
+	fields map[string]*SceneNode
+	items  []*SceneNode
+}
+
+// ParseSceneJSON parses a scene file into a tree of SceneNodes.
+func ParseSceneJSON(file string, data []byte) (*SceneNode, error) {
+	parser := sceneParser{
+		file:    file,
+		data:    data,
+		decoder: json.NewDecoder(bytes.NewReader(data)),
+	}
+
+	parser.decoder.UseNumber()
+
+	root, err := parser.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := parser.decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("%s:%d: unexpected data after the scene", file, parser.line())
+	}
+
+	return root, nil
+}
+
+type sceneParser struct {
+	file    string
+	data    []byte
+	decoder *json.Decoder
+}
+
+// line returns the line of the token that was just read.
+func (p sceneParser) line() int {
+	offset := int(p.decoder.InputOffset())
+
+	if offset > len(p.data) {
+		offset = len(p.data)
+	}
+
+	return bytes.Count(p.data[:offset], []byte("\n")) + 1
+}
+
+func (p sceneParser) syntaxError(err error) error {
+	var syntaxErr *json.SyntaxError
+
+	if errors.As(err, &syntaxErr) {
+		offset := int(syntaxErr.Offset)
+
+		if offset > len(p.data) {
+			offset = len(p.data)
+		}
+
+		line := bytes.Count(p.data[:offset], []byte("\n")) + 1
+
+		return fmt.Errorf("%s:%d: %v", p.file, line, syntaxErr)
+	}
+
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("%s:%d: unexpected end of file", p.file, p.line())
+	}
+
+	return fmt.Errorf("%s:%d: %v", p.file, p.line(), err)
+}
+
+func (p sceneParser) parse() (*SceneNode, error) {
+	token, err := p.decoder.Token()
+	if err != nil {
+		return nil, p.syntaxError(err)
+	}
+
+	node := &SceneNode{file: p.file, line: p.line()}
+
+	switch token := token.(type) {
+	case json.Delim:
+		if token == '{' {
+			node.fields = make(map[string]*SceneNode)
+
+			for p.decoder.More() {
+				keyToken, err := p.decoder.Token()
+				if err != nil {
+					return nil, p.syntaxError(err)
+				}
+
+				key := keyToken.(string)
+
+				if _, duplicate := node.fields[key]; duplicate {
+					return nil, fmt.Errorf("%s:%d: duplicate key %q", p.file, p.line(), key)
+				}
+
+				value, err := p.parse()
+				if err != nil {
+					return nil, err
+				}
+
+				node.keys = append(node.keys, key)
+				node.fields[key] = value
+			}
+		} else {
+			node.items = make([]*SceneNode, 0)
+
+			for p.decoder.More() {
+				value, err := p.parse()
+				if err != nil {
+					return nil, err
+				}
+
+				node.items = append(node.items, value)
+			}
+		}
+
+		if _, err := p.decoder.Token(); err != nil {
+			return nil, p.syntaxError(err)
+		}
+	case json.Number:
+		number, err := token.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: bad number %s", p.file, node.line, token)
+		}
+
+		node.value = number
+	default:
+		node.value = token
+	}
+
+	return node, nil
+}
+
+// errorf returns an error prefixed with the file and line of the node.
+func (n *SceneNode) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s:%d: %s", n.file, n.line, fmt.Sprintf(format, args...))
+}
+
+func (n *SceneNode) isObject() bool {
+	return n.fields != nil
+}
+
+func (n *SceneNode) isArray() bool {
+	return n.items != nil
+}
+
+func (n *SceneNode) describe() string {
+	switch n.value.(type) {
+	case float64:
+		return "a number"
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	}
+
+	if n.isObject() {
+		return "an object"
+	}
+
+	if n.isArray() {
+		return "an array"
+	}
+
+	return "null"
+}
+
+// SceneObject reads the fields of a JSON object, keeping only the first error.
+type SceneObject struct {
+	node *SceneNode
+	err  error
+}
+
+// NewSceneObject checks that a node is an object with only the allowed keys.
+func NewSceneObject(node *SceneNode, allowed ...string) *SceneObject {
+	object := &SceneObject{node: node}
+
+	if !node.isObject() {
+		object.err = node.errorf("expected an object, got %s", node.describe())
+
+		return object
+	}
+
+	for _, key := range node.keys {
+		if !containsString(allowed, key) {
+			sorted := append([]string(nil), allowed...)
+			sort.Strings(sorted)
+
+			object.err = node.fields[key].errorf("unknown key %q, expected one of %s", key, strings.Join(sorted, ", "))
+
+			return object
+		}
+	}
+
+	return object
+}
+
+func (o *SceneObject) fail(node *SceneNode, format string, args ...interface{}) {
+	if o.err == nil {
+		o.err = node.errorf(format, args...)
+	}
+}
+
+// keep records the error of a nested object, unless there is already one.
+func (o *SceneObject) keep(err error) {
+	if o.err == nil {
+		o.err = err
+	}
+}
+
+func (o *SceneObject) has(key string) bool {
+	if o.err != nil {
+		return false
+	}
+
+	_, ok := o.node.fields[key]
+
+	return ok
+}
+
+// get returns the named field, or nil after recording an error if it is missing.
+func (o *SceneObject) get(key string) *SceneNode {
+	if o.err != nil {
+		return nil
+	}
+
+	node, ok := o.node.fields[key]
+
+	if !ok {
+		o.fail(o.node, "missing required key %q", key)
+
+		return nil
+	}
+
+	return node
+}
+
+func (o *SceneObject) number(key string) float64 {
+	node := o.get(key)
+
+	if node == nil {
+		return 0
+	}
+
+	number, ok := node.value.(float64)
+
+	if !ok {
+		o.fail(node, "%q should be a number, got %s", key, node.describe())
+	}
+
+	return number
+}
+
+func (o *SceneObject) numberOr(key string, fallback float64) float64 {
+	if !o.has(key) {
+		return fallback
+	}
+
+	return o.number(key)
+}
+
+func (o *SceneObject) integerOr(key string, fallback int) int {
+	if !o.has(key) {
+		return fallback
+	}
+
+	number := o.number(key)
+
+	if number != float64(int(number)) {
+		o.fail(o.node.fields[key], "%q should be a whole number, got %v", key, number)
+	}
+
+	return int(number)
+}
+
+func (o *SceneObject) positiveIntegerOr(key string, fallback int) int {
+	if !o.has(key) {
+		return fallback
+	}
+
+	integer := o.integerOr(key, fallback)
+
+	if integer <= 0 {
+		o.fail(o.node.fields[key], "%q should be positive, got %d", key, integer)
+	}
+
+	return integer
+}
+
+func (o *SceneObject) str(key string) string {
+	node := o.get(key)
+
+	if node == nil {
+		return ""
+	}
+
+	str, ok := node.value.(string)
+
+	if !ok {
+		o.fail(node, "%q should be a string, got %s", key, node.describe())
+	}
+
+	return str
+}
+
+func (o *SceneObject) strOr(key string, fallback string) string {
+	if !o.has(key) {
+		return fallback
+	}
+
+	return o.str(key)
+}
+
+func (o *SceneObject) boolOr(key string, fallback bool) bool {
+	if !o.has(key) {
+		return fallback
+	}
+
+	node := o.get(key)
+	b, ok := node.value.(bool)
+
+	if !ok {
+		o.fail(node, "%q should be true or false, got %s", key, node.describe())
+	}
+
+	return b
+}
+
+func (o *SceneObject) numbers(key string, count int) []float64 {
+	node := o.get(key)
+
+	if node == nil {
+		return make([]float64, count)
+	}
+
+	return o.numberArray(node, key, count)
+}
+
+func (o *SceneObject) numberArray(node *SceneNode, key string, count int) []float64 {
+	numbers := make([]float64, count)
+
+	if !node.isArray() || len(node.items) != count {
+		o.fail(node, "%q should be an array of %d numbers", key, count)
+
+		return numbers
+	}
+
+	for i, item := range node.items {
+		number, ok := item.value.(float64)
+
+		if !ok {
+			o.fail(item, "%q should be an array of %d numbers", key, count)
+		}
+
+		numbers[i] = number
+	}
+
+	return numbers
+}
+
+func (o *SceneObject) vec3(key string) Vec3 {
+	e := o.numbers(key, 3)
+
+	return Vec3{e[0], e[1], e[2]}
+}
+
+func (o *SceneObject) vec3Or(key string, fallback Vec3) Vec3 {
+	if !o.has(key) {
+		return fallback
+	}
+
+	return o.vec3(key)
+}
+
+// vectors reads an array of arrays of size numbers each, such as [[0, 1, 2], [3, 4, 5]].
+// Missing components of texture coordinates are left as zero.
+func (o *SceneObject) vectors(key string, size int) []Vec3 {
+	node := o.get(key)
+
+	if node == nil {
+		return nil
+	}
+
+	if !node.isArray() || len(node.items) == 0 {
+		o.fail(node, "%q should be an array of arrays of %d numbers", key, size)
+
+		return nil
+	}
+
+	vectors := make([]Vec3, len(node.items))
+
+	for i, item := range node.items {
+		e := o.numberArray(item, key, size)
+
+		for c := 0; c < size; c++ {
+			vectors[i].inPlaceSet(c, e[c])
+		}
+	}
+
+	return vectors
+}
+
+func (o *SceneObject) vectorsOr(key string, size int) []Vec3 {
+	if !o.has(key) {
+		return nil
+	}
+
+	return o.vectors(key, size)
+}
+
+func (o *SceneObject) integers(key string) []int {
+	node := o.get(key)
+
+	if node == nil {
+		return nil
+	}
+
+	if !node.isArray() {
+		o.fail(node, "%q should be an array of whole numbers", key)
+
+		return nil
+	}
+
+	integers := make([]int, len(node.items))
+
+	for i, item := range node.items {
+		number, ok := item.value.(float64)
+
+		if !ok || number != float64(int(number)) {
+			o.fail(item, "%q should be an array of whole numbers", key)
+		}
+
+		integers[i] = int(number)
+	}
+
+	return integers
+}
+
+// keyframed reports whether a node holds keyframes rather than a plain value.
+func keyframed(node *SceneNode) bool {
+	if node == nil || !node.isObject() {
+		return false
+	}
+
+	_, ok := node.fields["keys"]
+
+	return ok
+}
+
+// track reads a value of size numbers that may be keyframed, as {"keys": [{"time": 0,
+// "value": ...}, ...]} where each key can set the "interpolation" on to the next. A
+// plain value is a Track holding still.
+func (o *SceneObject) track(key string, size int) Track {
+	node := o.get(key)
+
+	if node == nil {
+		return Track{{}}
+	}
+
+	if !keyframed(node) {
+		return Track{{0, o.trackValue(node, key, size), InterpolationLinear}}
+	}
+
+	keyed := NewSceneObject(node, "keys")
+	keys := keyed.get("keys")
+
+	if keyed.err == nil && (!keys.isArray() || len(keys.items) == 0) {
+		keyed.fail(keys, "%q should hold an array of keys", key)
+	}
+
+	if keyed.err != nil {
+		o.keep(keyed.err)
+
+		return Track{{}}
+	}
+
+	track := make(Track, len(keys.items))
+
+	for i, item := range keys.items {
+		object := NewSceneObject(item, "time", "value", "interpolation")
+		track[i].time = object.number("time")
+		track[i].value = o.trackValue(object.get("value"), key, size)
+
+		if object.has("interpolation") {
+			interpolation, err := ParseInterpolation(object.str("interpolation"))
+			if err != nil {
+				object.fail(object.get("interpolation"), "%v", err)
+			}
+
+			track[i].interpolation = interpolation
+		}
+
+		if object.err != nil {
+			o.keep(object.err)
+		} else if i > 0 && track[i].time <= track[i-1].time {
+			o.fail(item, "key times of %q should increase, got %v after %v", key, track[i].time, track[i-1].time)
+		}
+	}
+
+	return track
+}
+
+// trackValue reads a number, or an array of size numbers, of a track.
+func (o *SceneObject) trackValue(node *SceneNode, key string, size int) Vec3 {
+	if node == nil {
+		return Vec3{}
+	}
+
+	if size == 1 {
+		number, ok := node.value.(float64)
+
+		if !ok {
+			o.fail(node, "%q should be a number, got %s", key, node.describe())
+		}
+
+		return Vec3{number, 0, 0}
+	}
+
+	e := o.numberArray(node, key, size)
+
+	return Vec3{e[0], e[1], e[2]}
+}
+
+func (o *SceneObject) numberTrackOr(key string, fallback float64) Track {
+	if !o.has(key) {
+		return Track{{0, Vec3{fallback, 0, 0}, InterpolationLinear}}
+	}
+
+	return o.track(key, 1)
+}
+
+func (o *SceneObject) vec3TrackOr(key string, fallback Vec3) Track {
+	if !o.has(key) {
+		return Track{{0, fallback, InterpolationLinear}}
+	}
+
+	return o.track(key, 3)
+}
+
+// span reads a [min, max] pair.
+func (o *SceneObject) span(key string) (float64, float64) {
+	e := o.numbers(key, 2)
+
+	if o.err == nil && e[0] > e[1] {
+		o.fail(o.node.fields[key], "%q should be [min, max], got [%v, %v]", key, e[0], e[1])
+	}
+
+	return e[0], e[1]
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ShutterKey is how far open the shutter is at a time, as a fraction of the way from
+// opening to closing.
+type ShutterKey struct {
+	time     float64
+	openness float64
+}
+
+// triangleShutter opens steadily to the middle of the exposure and closes again.
+var triangleShutter = []ShutterKey{{0, 0}, {0.5, 1}, {1, 0}}
+
+// ParseShutterCurve parses "box", "triangle", or a custom curve of time:openness pairs
+// such as "0:0,0.2:1,0.8:1,1:0", running from 0 to 1. The box curve, fully open
+// throughout, is nil.
+func ParseShutterCurve(s string) ([]ShutterKey, error) {
+	switch s {
+	case "box":
+		return nil, nil
+	case "triangle":
+		return triangleShutter, nil
+	}
+
+	var keys []ShutterKey
+
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.Split(pair, ":")
+
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("unknown shutter curve %q, expected box, triangle or time:openness pairs", s)
+		}
+
+		var key ShutterKey
+		var err error
+
+		if key.time, err = strconv.ParseFloat(strings.TrimSpace(parts[0]), 64); err != nil {
+			return nil, fmt.Errorf("%q is not a number", parts[0])
+		}
+
+		if key.openness, err = strconv.ParseFloat(strings.TrimSpace(parts[1]), 64); err != nil {
+			return nil, fmt.Errorf("%q is not a number", parts[1])
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, checkShutterCurve(keys)
+}
+
+// checkShutterCurve reports whether the keys make a curve that can be sampled.
+func checkShutterCurve(keys []ShutterKey) error {
+	if keys == nil {
+		return nil
+	}
+
+	if len(keys) < 2 || keys[0].time != 0 || keys[len(keys)-1].time != 1 {
+		return errors.New("a shutter curve must run from time 0 to time 1")
+	}
+
+	open := false
+
+	for i, key := range keys {
+		if i > 0 && key.time <= keys[i-1].time {
+			return errors.New("shutter curve times must increase")
+		}
+
+		if key.openness < 0 {
+			return errors.New("shutter curve openness must not be negative")
+		}
+
+		open = open || key.openness > 0
+	}
+
+	if !open {
+		return errors.New("the shutter curve never opens")
+	}
+
+	return nil
+}
+
+// Shutter chooses the time of each camera ray between opening and closing, more often
+// when its curve is more open. A rolling shutter exposes each row of the image in turn
+// from the top, the sweep taking that fraction of the time. Each row is exposed through
+// the curve for the rest, so a rolling shutter of 1 takes every row in an instant.
+type Shutter struct {
+	open    float64
+	close   float64
+	curve   []ShutterKey
+	totals  []float64
+	rolling float64
+}
+
+// NewShutter returns a Shutter open from open to close. A nil curve stays fully open.
+func NewShutter(open, close float64, curve []ShutterKey, rolling float64) Shutter {
+	shutter := Shutter{open, close, curve, nil, rolling}
+
+	// The running total of the area under each segment of the curve.
+	total := 0.0
+
+	for i := 1; i < len(curve); i++ {
+		total += (curve[i].openness + curve[i-1].openness) / 2 * (curve[i].time - curve[i-1].time)
+		shutter.totals = append(shutter.totals, total)
+	}
+
+	return shutter
+}
+
+// sample returns the time for u in [0, 1) at t up the image from the bottom.
+func (s Shutter) sample(u, t float64) float64 {
+	x := u
+
+	if s.curve != nil {
+		x = s.curveSample(u)
+	}
+
+	if s.rolling != 0 {
+		x = s.rolling*(1-t) + x*(1-s.rolling)
+	}
+
+	return s.open + x*(s.close-s.open)
+}
+
+// curveSample picks a segment of the curve in proportion to its area, then a place
+// within it in proportion to its openness by inverting the integral of the line.
+func (s Shutter) curveSample(u float64) float64 {
+	total := s.totals[len(s.totals)-1]
+	target := math.Min(u*total, math.Nextafter(total, 0))
+	i := sort.Search(len(s.totals), func(i int) bool { return s.totals[i] > target })
+
+	if i > 0 {
+		target -= s.totals[i-1]
+	}
+
+	a := s.curve[i].openness
+	b := s.curve[i+1].openness
+	width := s.curve[i+1].time - s.curve[i].time
+
+	// Solving (b - a) / 2w x² + a x = target for x, in a form that holds when a = b.
+	x := 0.0
+
+	if denominator := a + math.Sqrt(math.Max(a*a+2*(b-a)*target/width, 0)); denominator > 0 {
+		x = 2 * target / denominator
+	}
+
+	return math.Min(s.curve[i].time+math.Min(x, width), math.Nextafter(1, 0))
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseShutterCurve(t *testing.T) {
+	if curve, err := ParseShutterCurve("box"); curve != nil || err != nil {
+		t.Errorf("Expected a nil box curve, got %v, %v", curve, err)
+	}
+
+	curve, err := ParseShutterCurve("0:0, 0.2:1, 0.8:1, 1:0")
+
+	if err != nil || len(curve) != 4 || curve[1] != (ShutterKey{0.2, 1}) {
+		t.Errorf("Parsed %v, %v", curve, err)
+	}
+
+	for _, s := range []string{"fast", "0:1", "0.1:1,1:1", "0:1,0.5:1,0.4:1,1:1", "0:-1,1:1", "0:0,1:0", "0:x,1:1"} {
+		if _, err := ParseShutterCurve(s); err == nil {
+			t.Errorf("Expected an error for %q", s)
+		}
+	}
+}
+
+func TestShutterCurves(t *testing.T) {
+	box := NewShutter(2, 4, nil, 0)
+
+	if time := box.sample(0.25, 0.3); time != 2.5 {
+		t.Errorf("Box shutter gave %v, expected 2.5", time)
+	}
+
+	// Sampling inverts the integral of the curve, which for the triangle is 2x² up to
+	// the middle.
+	triangle := NewShutter(0, 1, triangleShutter, 0)
+	trapezoid := NewShutter(0, 1, []ShutterKey{{0, 0}, {0.2, 1}, {0.8, 1}, {1, 0}}, 0)
+
+	for u := 0.0; u < 1; u += 0.05 {
+		x := triangle.sample(u, 0)
+		cdf := 2 * x * x
+
+		if x > 0.5 {
+			cdf = 1 - 2*(1-x)*(1-x)
+		}
+
+		if math.Abs(cdf-u) > 1e-12 {
+			t.Errorf("Triangle shutter gave %v for %v", x, u)
+		}
+
+		// The trapezoid's area is 0.8, the first tenth of it under the opening ramp.
+		if x := trapezoid.sample(u, 0); u < 0.125 && math.Abs(x*x/0.4/0.8-u) > 1e-12 || u >= 0.125 && u <= 0.875 && math.Abs((x-0.1)/0.8-u) > 1e-12 {
+			t.Errorf("Trapezoid shutter gave %v for %v", x, u)
+		}
+	}
+
+	if x := triangle.sample(0, 0); x != 0 {
+		t.Errorf("Triangle shutter gave %v for 0", x)
+	}
+}
+
+func TestRollingShutter(t *testing.T) {
+	// Taking every row in an instant, the top row is taken as the shutter opens and the
+	// bottom as it closes.
+	instant := NewShutter(1, 3, nil, 1)
+
+	if top, bottom := instant.sample(0.7, 1), instant.sample(0.7, 0); top != 1 || bottom != 3 {
+		t.Errorf("Rows taken at %v at the top and %v at the bottom", top, bottom)
+	}
+
+	rolling := NewShutter(0, 1, nil, 0.5)
+
+	for u := 0.0; u < 1; u += 0.1 {
+		if time := rolling.sample(u, 1); time < 0 || time > 0.5 {
+			t.Errorf("Top row taken at %v", time)
+		}
+
+		if time := rolling.sample(u, 0); time < 0.5 || time > 1 {
+			t.Errorf("Bottom row taken at %v", time)
+		}
+	}
+}
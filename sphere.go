@@ -1,8 +1,6 @@
 package main
 
-import (
-	"math"
-)
+import "math"
 
 // Sphere is a Hitable graphics object.
 type Sphere struct {
@@ -46,7 +44,7 @@ func (s Sphere) center(time float64) Vec3 {
 	return s.centerStart.add((s.centerFinish.subtract(s.centerStart)).multiplyScalar((time - s.timeStart) / (s.timeFinish - s.timeStart)))
 }
 
-func (s Sphere) hit(r Ray, tMin, tMax float64) (bool, *Hit) {
+func (s Sphere) hit(r Ray, tMin, tMax float64, record *Hit, sampler Sampler) bool {
 	oc := r.origin().subtract(s.center(r.time()))
 
 	a := r.direction().dot(r.direction())
@@ -63,7 +61,7 @@ func (s Sphere) hit(r Ray, tMin, tMax float64) (bool, *Hit) {
 
 			u, v := GetSphereUV(p.subtract(s.center(r.time())).divideScalar(s.radius))
 
-			hit := Hit{
+			*record = Hit{
 				t:        temp,
 				p:        p,
 				u:        u,
@@ -72,7 +70,7 @@ func (s Sphere) hit(r Ray, tMin, tMax float64) (bool, *Hit) {
 				material: s.material,
 			}
 
-			return true, &hit
+			return true
 		}
 		temp = (-b + math.Sqrt(b*b-a*c)) / a
 
@@ -81,7 +79,7 @@ func (s Sphere) hit(r Ray, tMin, tMax float64) (bool, *Hit) {
 
 			u, v := GetSphereUV(p.subtract(s.center(r.time())).divideScalar(s.radius))
 
-			hit := Hit{
+			*record = Hit{
 				t:        temp,
 				p:        p,
 				u:        u,
@@ -90,32 +88,43 @@ func (s Sphere) hit(r Ray, tMin, tMax float64) (bool, *Hit) {
 				material: s.material,
 			}
 
-			return true, &hit
+			return true
 		}
 	}
 
-	return false, nil
+	return false
 }
 
 func (s Sphere) boundingBox(t0, t1 float64) (hasBox bool, box *AABB) {
+	// Hollow Spheres have a negative radius to flip their normals.
+	radius := math.Abs(s.radius)
+	extent := Vec3{radius, radius, radius}
+
 	t0Box := AABB{
-		s.center(t0).subtract(Vec3{s.radius, s.radius, s.radius}),
-		s.center(t0).add(Vec3{s.radius, s.radius, s.radius}),
+		s.center(t0).subtract(extent),
+		s.center(t0).add(extent),
 	}
 
 	t1Box := AABB{
-		s.center(t1).subtract(Vec3{s.radius, s.radius, s.radius}),
-		s.center(t1).add(Vec3{s.radius, s.radius, s.radius}),
+		s.center(t1).subtract(extent),
+		s.center(t1).add(extent),
 	}
 
 	return true, SurroundingBox(t0Box, t1Box)
 }
 
 func (s Sphere) pdfValue(o, direction Vec3) float64 {
-	didHit, _ := s.hit(Ray{o, direction, 0.0}, 0.001, math.MaxFloat64)
+	distanceSquared := s.center(0).subtract(o).squaredLength()
+
+	// From inside, every direction hits the Sphere.
+	if distanceSquared <= s.radius*s.radius {
+		return 1 / (4 * math.Pi)
+	}
 
-	if didHit {
-		cosThetaMax := math.Sqrt(1 - s.radius*s.radius/s.center(0).subtract(o).squaredLength())
+	var hit Hit
+
+	if s.hit(Ray{o, direction, 0.0}, 0.001, math.MaxFloat64, &hit, nil) {
+		cosThetaMax := math.Sqrt(1 - s.radius*s.radius/distanceSquared)
 		solidAngle := 2 * math.Pi * (1 - cosThetaMax)
 
 		return 1 / solidAngle
@@ -124,14 +133,18 @@ func (s Sphere) pdfValue(o, direction Vec3) float64 {
 	return 0
 }
 
-func (s Sphere) random(o Vec3) Vec3 {
+func (s Sphere) random(o Vec3, sampler Sampler) Vec3 {
 	direction := s.center(0).subtract(o)
 
 	distanceSquared := direction.squaredLength()
 
+	if distanceSquared <= s.radius*s.radius {
+		return RandomOnUnitSphere(sampler)
+	}
+
 	uvw := Onb{}
 
 	uvw.buildFromW(direction)
 
-	return uvw.local(RandomToSphere(s.radius, distanceSquared))
+	return uvw.local(RandomToSphere(s.radius, distanceSquared, sampler))
 }
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// StereoLayout is how the two eyes of a stereo render are packed into one image.
+type StereoLayout int
+
+// The supported stereo layouts.
+const (
+	StereoNone StereoLayout = iota
+	StereoSideBySide
+	StereoTopBottom
+)
+
+var stereoLayoutNames = []string{"none", "side-by-side", "top-bottom"}
+
+// ParseStereoLayout parses the name of a stereo layout.
+func ParseStereoLayout(s string) (StereoLayout, error) {
+	for i, name := range stereoLayoutNames {
+		if name == s {
+			return StereoLayout(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown stereo layout %q, expected one of %v", s, stereoLayoutNames)
+}
+
+func (l StereoLayout) String() string {
+	if l >= 0 && int(l) < len(stereoLayoutNames) {
+		return stereoLayoutNames[l]
+	}
+
+	return fmt.Sprintf("StereoLayout(%d)", int(l))
+}
+
+// Convergence is how the eyes of a stereo camera are made to agree on the distance at
+// which objects appear level with the screen.
+type Convergence int
+
+// The supported convergence methods. Off-axis eyes look in parallel through windows
+// shifted to overlap at the distance. Toed-in eyes turn to look at a point at it, which
+// is simpler but slants their views apart at the edges.
+const (
+	ConvergenceOffAxis Convergence = iota
+	ConvergenceToeIn
+)
+
+var convergenceNames = []string{"off-axis", "toe-in"}
+
+// ParseConvergence parses the name of a convergence method.
+func ParseConvergence(s string) (Convergence, error) {
+	for i, name := range convergenceNames {
+		if name == s {
+			return Convergence(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown convergence %q, expected one of %v", s, convergenceNames)
+}
+
+func (c Convergence) String() string {
+	if c >= 0 && int(c) < len(convergenceNames) {
+		return convergenceNames[c]
+	}
+
+	return fmt.Sprintf("Convergence(%d)", int(c))
+}
+
+// StereoCamera renders the left and right eyes into the two halves of one image, the
+// left eye on the left or at the top. Filters wider than a pixel blend the eyes a
+// little along the seam.
+type StereoCamera struct {
+	left   Camera
+	right  Camera
+	layout StereoLayout
+}
+
+func (c StereoCamera) getRay(s, t float64, sampler Sampler) (Ray, bool) {
+	if c.layout == StereoTopBottom {
+		if t >= 0.5 {
+			return c.left.getRay(s, 2*t-1, sampler)
+		}
+
+		return c.right.getRay(s, 2*t, sampler)
+	}
+
+	if s < 0.5 {
+		return c.left.getRay(2*s, t, sampler)
+	}
+
+	return c.right.getRay(2*s-1, t, sampler)
+}
+
+// OmniStereoCamera is one eye of an omni-directional stereo panorama. It sends rays as
+// an EquirectangularCamera does, but from a circle eyeSeparation across, each leaving
+// from where the eye would be with the head turned to face it. Toed in, the rays of the
+// two eyes meet at the convergence distance, otherwise they are parallel.
+type OmniStereoCamera struct {
+	EquirectangularCamera
+	eyeOffset   float64
+	convergence float64
+}
+
+// NewOmniStereoCamera returns an OmniStereoCamera for the eye eyeOffset to the right of
+// the center, negative for the left eye. A convergence of zero keeps the rays parallel.
+func NewOmniStereoCamera(from, at, up Vec3, eyeOffset, convergence float64, shutter Shutter) OmniStereoCamera {
+	return OmniStereoCamera{NewEquirectangularCamera(from, at, up, shutter), eyeOffset, convergence}
+}
+
+func (c OmniStereoCamera) getRay(s, t float64, sampler Sampler) (Ray, bool) {
+	r, _ := c.EquirectangularCamera.getRay(s, t, sampler)
+
+	phi := 2 * math.Pi * (s - 0.5)
+	offset := c.toWorld(math.Cos(phi), 0, math.Sin(phi)).multiplyScalar(c.eyeOffset)
+
+	r.a = r.a.add(offset)
+
+	if c.convergence > 0 {
+		r.b = r.b.multiplyScalar(c.convergence).subtract(offset)
+	}
+
+	return r, true
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestStereoEyesConverge(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	config := Config{
+		width:               200,
+		height:              100,
+		from:                Vec3{0, 0, 0},
+		at:                  Vec3{0, 0, -10},
+		up:                  Vec3{0, 1, 0},
+		fov:                 60,
+		stereo:              StereoSideBySide,
+		eyeSeparation:       1,
+		convergenceDistance: 25,
+	}
+
+	for i := range convergenceNames {
+		config.convergence = Convergence(i)
+		camera := config.camera()
+
+		// The center rays of the eyes start apart and meet at the convergence distance.
+		left, _ := camera.getRay(0.25, 0.5, rng)
+		right, _ := camera.getRay(0.75, 0.5, rng)
+
+		if left.origin() != (Vec3{-0.5, 0, 0}) || right.origin() != (Vec3{0.5, 0, 0}) {
+			t.Errorf("%v eyes are at %v and %v", config.convergence, left.origin(), right.origin())
+		}
+
+		meet := Vec3{0, 0, -25}
+
+		for _, r := range []Ray{left, right} {
+			if angle(r.direction(), meet.subtract(r.origin())) > 1e-9 {
+				t.Errorf("%v eye at %v looks along %v, expected towards %v", config.convergence, r.origin(), r.direction(), meet)
+			}
+		}
+	}
+}
+
+func TestStereoTopBottom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	config := Config{
+		width:         100,
+		height:        100,
+		from:          Vec3{0, 0, 0},
+		at:            Vec3{0, 0, -10},
+		up:            Vec3{0, 1, 0},
+		fov:           60,
+		stereo:        StereoTopBottom,
+		eyeSeparation: 1,
+	}
+
+	camera := config.camera()
+	top, _ := camera.getRay(0.5, 0.75, rng)
+	bottom, _ := camera.getRay(0.5, 0.25, rng)
+
+	if top.origin().x() >= 0 || bottom.origin().x() <= 0 {
+		t.Errorf("Expected the left eye at the top, got %v at the top and %v at the bottom", top.origin(), bottom.origin())
+	}
+
+	// Each eye sees a view twice as wide as it is high.
+	if config.aspectRatio() != 2 {
+		t.Errorf("Expected each eye's aspect ratio to be 2, got %v", config.aspectRatio())
+	}
+}
+
+func TestOmniStereo(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	config := Config{
+		width:               200,
+		height:              200,
+		from:                Vec3{0, 0, 0},
+		at:                  Vec3{0, 0, -10},
+		up:                  Vec3{0, 1, 0},
+		projection:          ProjectionEquirectangular,
+		stereo:              StereoTopBottom,
+		eyeSeparation:       2,
+		convergenceDistance: 30,
+	}
+
+	for _, s := range []float64{0, 0.2, 0.5, 0.9} {
+		config.convergence = ConvergenceOffAxis
+		left, _ := config.camera().getRay(s, 0.8, rng)
+		right, _ := config.camera().getRay(s, 0.3, rng)
+
+		// The eyes are either side of the center, across the direction they look in.
+		if gap := left.origin().subtract(right.origin()); gap.length()-2 > 1e-9 || gap.dot(left.direction()) > 1e-9 {
+			t.Errorf("Eyes at %v and %v looking along %v", left.origin(), right.origin(), left.direction())
+		}
+
+		if angle(left.direction(), right.direction()) > 1e-9 {
+			t.Errorf("Off-axis omni-directional eyes should look in parallel, got %v and %v", left.direction(), right.direction())
+		}
+
+		config.convergence = ConvergenceToeIn
+		left, _ = config.camera().getRay(s, 0.8, rng)
+		right, _ = config.camera().getRay(s, 0.3, rng)
+
+		if left.pointAtParameter(1).subtract(right.pointAtParameter(1)).length() > 1e-9 || left.pointAtParameter(1).length()-30 > 1e-9 {
+			t.Errorf("Toed-in omni-directional eyes meet at %v and %v", left.pointAtParameter(1), right.pointAtParameter(1))
+		}
+	}
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"fmt"
 	"image"
+	_ "image/jpeg" // register JPEG for image textures
 	"math"
+	"math/rand"
+	"os"
 )
 
 // Texture represents a programmatic way of determining the color of a point.
@@ -42,9 +46,9 @@ type NoiseTexture struct {
 }
 
 // NewNoiseTexture returns a properly initialized NoiseTexture.
-func NewNoiseTexture(scale float64) NoiseTexture {
+func NewNoiseTexture(scale float64, rng *rand.Rand) NoiseTexture {
 	return NoiseTexture{
-		noise: NewPerlin(),
+		noise: NewPerlin(rng),
 		scale: scale,
 	}
 }
@@ -59,9 +63,9 @@ func (nt NoiseTexture) value(u, v float64, p Vec3) Vec3 {
 type MarbleTexture NoiseTexture
 
 // NewMarbleTexture correctly generates a new MarbleTexture.
-func NewMarbleTexture(scale float64) MarbleTexture {
+func NewMarbleTexture(scale float64, rng *rand.Rand) MarbleTexture {
 	return MarbleTexture{
-		noise: NewPerlin(),
+		noise: NewPerlin(rng),
 		scale: scale,
 	}
 }
@@ -79,6 +83,22 @@ type ImageTexture struct {
 	ny   int
 }
 
+// LoadImage decodes an image file for use in an ImageTexture.
+func LoadImage(filename string) (image.Image, error) {
+	imageFile, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer imageFile.Close()
+
+	img, _, err := image.Decode(imageFile)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	return img, nil
+}
+
 // NewImageTexture correctly instantiates an ImageTexture.
 func NewImageTexture(data image.Image) ImageTexture {
 	return ImageTexture{
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// ToneMap is an operator compressing linear radiance into the displayable range.
+type ToneMap int
+
+// The supported tone-map operators.
+const (
+	ToneMapClamp ToneMap = iota
+	ToneMapReinhard
+	ToneMapExtendedReinhard
+	ToneMapACES
+	ToneMapHable
+)
+
+var toneMapNames = []string{"clamp", "reinhard", "extended-reinhard", "aces", "hable"}
+
+// ParseToneMap parses the name of a tone-map operator.
+func ParseToneMap(s string) (ToneMap, error) {
+	for i, name := range toneMapNames {
+		if name == s {
+			return ToneMap(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown tone map %q, expected one of %v", s, toneMapNames)
+}
+
+func (t ToneMap) String() string {
+	if t >= 0 && int(t) < len(toneMapNames) {
+		return toneMapNames[t]
+	}
+
+	return fmt.Sprintf("ToneMap(%d)", int(t))
+}
+
+// hableWhitePoint is the linear value Hable's curve maps to white.
+const hableWhitePoint = 11.2
+
+// apply maps a linear color, with whitePoint being the luminance the extended Reinhard
+// operator maps to white.
+func (t ToneMap) apply(c Vec3, whitePoint float64) Vec3 {
+	switch t {
+	case ToneMapReinhard:
+		return scaleLuminance(c, func(l float64) float64 {
+			return l / (1 + l)
+		})
+	case ToneMapExtendedReinhard:
+		return scaleLuminance(c, func(l float64) float64 {
+			return l * (1 + l/(whitePoint*whitePoint)) / (1 + l)
+		})
+	case ToneMapACES:
+		return Vec3{aces(c.e0), aces(c.e1), aces(c.e2)}
+	case ToneMapHable:
+		white := hable(hableWhitePoint)
+
+		return Vec3{hable(2*c.e0) / white, hable(2*c.e1) / white, hable(2*c.e2) / white}
+	}
+
+	return c
+}
+
+// scaleLuminance scales the color so that its luminance is mapped by curve, keeping its hue.
+func scaleLuminance(c Vec3, curve func(l float64) float64) Vec3 {
+	l := luminance(c)
+
+	if l <= 0 {
+		return Vec3Zero()
+	}
+
+	return c.multiplyScalar(curve(l) / l)
+}
+
+// luminance weighs the linear channels by the Rec. 709 primaries.
+func luminance(c Vec3) float64 {
+	return 0.2126*c.e0 + 0.7152*c.e1 + 0.0722*c.e2
+}
+
+// aces is Krzysztof Narkowicz's fit of the ACES filmic curve.
+func aces(x float64) float64 {
+	return x * (2.51*x + 0.03) / (x*(2.43*x+0.59) + 0.14)
+}
+
+// hable is John Hable's filmic curve from Uncharted 2.
+func hable(x float64) float64 {
+	const (
+		a = 0.15
+		b = 0.50
+		c = 0.10
+		d = 0.20
+		e = 0.02
+		f = 0.30
+	)
+
+	return (x*(a*x+c*b)+d*e)/(x*(a*x+b)+d*f) - e/f
+}
+
+// srgbOETF encodes a linear value with the sRGB transfer function.
+func srgbOETF(x float64) float64 {
+	if x <= 0.0031308 {
+		return 12.92 * x
+	}
+
+	return 1.055*math.Pow(x, 1/2.4) - 0.055
+}
+
+// maxRadiance caps the radiance handed to the operators. It is far brighter than white,
+// yet small enough for the curves to square, so that infinite highlights come out white.
+const maxRadiance = 1e30
+
+// radiance limits x to [0, maxRadiance], mapping NaN to 0.
+func radiance(x float64) float64 {
+	if !(x > 0) {
+		return 0
+	}
+
+	return math.Min(x, maxRadiance)
+}
+
+// clamp01 limits x to [0, 1], mapping NaN to 0.
+func clamp01(x float64) float64 {
+	if !(x > 0) {
+		return 0
+	}
+
+	return math.Min(x, 1)
+}
+
+// ToneMapImage develops the linear framebuffer, stored top row first, into an 8-bit sRGB
+// image: exposure, then the tone-map operator, the sRGB transfer function and dithering.
+func ToneMapImage(framebuffer []Vec3, config Config) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, config.width, config.height))
+	scale := math.Exp2(config.exposure)
+
+	for j := 0; j < config.height; j++ {
+		for i := 0; i < config.width; i++ {
+			pixel := framebuffer[j*config.width+i].multiplyScalar(scale)
+
+			// NaNs, negative and infinite values would poison the luminance based operators.
+			pixel = Vec3{radiance(pixel.e0), radiance(pixel.e1), radiance(pixel.e2)}
+			pixel = config.toneMap.apply(pixel, config.whitePoint)
+
+			threshold := config.dither.threshold(i, j)
+
+			img.SetNRGBA(i, j, color.NRGBA{
+				quantize(srgbOETF(clamp01(pixel.e0)), threshold),
+				quantize(srgbOETF(clamp01(pixel.e1)), threshold),
+				quantize(srgbOETF(clamp01(pixel.e2)), threshold),
+				0xff,
+			})
+		}
+	}
+
+	return img
+}
+
+// quantize converts a value in [0, 1] to 8 bits, rounding up when its fraction
+// reaches the threshold.
+func quantize(x, threshold float64) uint8 {
+	return uint8(math.Min(math.Floor(x*255+1-threshold), 255))
+}
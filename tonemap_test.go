@@ -0,0 +1,135 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestToneMapOperators(t *testing.T) {
+	for operator := ToneMapClamp; operator <= ToneMapHable; operator++ {
+		if black := operator.apply(Vec3Zero(), 4); black.length() > 1e-9 {
+			t.Errorf("%v maps black to %v", operator, black)
+		}
+
+		previous := -1.0
+
+		for x := 0.0; x < 100; x += 0.125 {
+			value := operator.apply(Vec3{x, x, x}, 4).x()
+
+			if value < previous {
+				t.Errorf("%v is not monotonic at %v", operator, x)
+
+				break
+			}
+
+			previous = value
+		}
+	}
+
+	if white := ToneMapExtendedReinhard.apply(Vec3{4, 4, 4}, 4); math.Abs(white.x()-1) > 1e-9 {
+		t.Errorf("Expected the white point to map to 1, got %v", white)
+	}
+
+	if white := ToneMapHable.apply(Vec3{hableWhitePoint / 2, 0, 0}, 4); math.Abs(white.x()-1) > 1e-9 {
+		t.Errorf("Expected Hable's white point to map to 1, got %v", white)
+	}
+}
+
+func TestSRGBOETF(t *testing.T) {
+	tests := map[float64]float64{0: 0, 0.001: 0.01292, 0.5: 0.735357, 1: 1}
+
+	for linear, expected := range tests {
+		if actual := srgbOETF(linear); math.Abs(actual-expected) > 1e-6 {
+			t.Errorf("srgbOETF(%v) = %v, expected %v", linear, actual, expected)
+		}
+	}
+}
+
+func TestToneMapImageDoesNotWrapOverexposedPixels(t *testing.T) {
+	config := Config{width: 3, height: 1, whitePoint: 4}
+	framebuffer := []Vec3{{15, 1.5, 0.5}, {math.NaN(), -1, 0}, {1, 1, 1}}
+
+	img := ToneMapImage(framebuffer, config)
+
+	if pixel := img.NRGBAAt(0, 0); pixel.R != 255 || pixel.G != 255 || pixel.B != 188 {
+		t.Errorf("Expected an overexposed pixel to clip, got %v", pixel)
+	}
+
+	if pixel := img.NRGBAAt(1, 0); pixel.R != 0 || pixel.G != 0 || pixel.B != 0 {
+		t.Errorf("Expected NaN and negative channels to be black, got %v", pixel)
+	}
+
+	config.exposure = -1
+
+	if pixel := ToneMapImage(framebuffer, config).NRGBAAt(2, 0); pixel.R != 188 {
+		t.Errorf("Expected one stop down to halve the linear value, got %v", pixel)
+	}
+}
+
+func TestToneMapImageWhitensInfiniteHighlights(t *testing.T) {
+	config := Config{width: 2, height: 1, whitePoint: 4}
+	framebuffer := []Vec3{{math.Inf(1), math.Inf(1), math.Inf(1)}, {math.Inf(1), 0, 0}}
+
+	for operator := ToneMapClamp; operator <= ToneMapHable; operator++ {
+		config.toneMap = operator
+		img := ToneMapImage(framebuffer, config)
+
+		if pixel := img.NRGBAAt(0, 0); pixel.R != 255 || pixel.G != 255 || pixel.B != 255 {
+			t.Errorf("Expected %v to map an infinite highlight to white, got %v", operator, pixel)
+		}
+
+		if pixel := img.NRGBAAt(1, 0); pixel.R != 255 {
+			t.Errorf("Expected %v to map an infinite red channel to red, got %v", operator, pixel)
+		}
+	}
+}
+
+func TestDitherThresholds(t *testing.T) {
+	for _, test := range []struct {
+		dither Dither
+		size   int
+	}{{DitherOrdered, bayerSize}, {DitherBlueNoise, blueNoiseSize}} {
+		seen := make(map[float64]bool)
+
+		for j := 0; j < test.size; j++ {
+			for i := 0; i < test.size; i++ {
+				threshold := test.dither.threshold(i, j)
+
+				if threshold <= 0 || threshold >= 1 || seen[threshold] {
+					t.Fatalf("%v threshold %v at (%d, %d) is out of range or repeated", test.dither, threshold, i, j)
+				}
+
+				seen[threshold] = true
+
+				if test.dither.threshold(i+test.size, j+test.size) != threshold {
+					t.Fatalf("%v does not tile", test.dither)
+				}
+			}
+		}
+	}
+}
+
+func TestDitherPreservesAverage(t *testing.T) {
+	config := Config{width: 64, height: 64, whitePoint: 4, dither: DitherBlueNoise}
+	framebuffer := make([]Vec3, config.width*config.height)
+
+	// A value between two 8-bit levels after encoding.
+	level := 100.3 / 255
+
+	for i := range framebuffer {
+		framebuffer[i] = Vec3{math.Pow((level+0.055)/1.055, 2.4), 0, 0}
+	}
+
+	img := ToneMapImage(framebuffer, config)
+	sum := 0.0
+
+	for j := 0; j < config.height; j++ {
+		for i := 0; i < config.width; i++ {
+			sum += float64(img.NRGBAAt(i, j).R)
+		}
+	}
+
+	if average := sum / float64(config.width*config.height); math.Abs(average-100.3) > 0.01 {
+		t.Errorf("Expected dithering to average 100.3, got %v", average)
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// TriangleMesh is a set of Triangles sharing vertex positions, normals and texture coordinates.
+type TriangleMesh struct {
+	positions []Vec3
+	normals   []Vec3
+	uvs       []Vec3
+	indices   []int
+	material  Material
+	triangles HitableList
+	bvh       *BVHNode
+	areas     []float64
+	area      float64
+}
+
+// Triangle is one triangle of a TriangleMesh.
+type Triangle struct {
+	mesh  *TriangleMesh
+	index int
+}
+
+// NewTriangleMesh builds a mesh with a triangle for every three indices into positions.
+// normals and uvs are optional, but if given must have one entry per position. The u and v
+// texture coordinates are stored in x and y.
+func NewTriangleMesh(positions, normals, uvs []Vec3, indices []int, material Material) *TriangleMesh {
+	if len(indices)%3 != 0 || len(indices) == 0 {
+		panic("TriangleMesh needs a positive multiple of three indices")
+	}
+
+	if (normals != nil && len(normals) != len(positions)) || (uvs != nil && len(uvs) != len(positions)) {
+		panic("TriangleMesh needs one normal and texture coordinate per position")
+	}
+
+	for _, index := range indices {
+		if index < 0 || index >= len(positions) {
+			panic("TriangleMesh index out of range")
+		}
+	}
+
+	mesh := &TriangleMesh{
+		positions: positions,
+		normals:   normals,
+		uvs:       uvs,
+		indices:   indices,
+		material:  material,
+	}
+
+	for i := 0; i < len(indices); i += 3 {
+		triangle := Triangle{mesh, i}
+
+		mesh.triangles.add(triangle)
+		mesh.area += triangle.area()
+		mesh.areas = append(mesh.areas, mesh.area)
+	}
+
+	mesh.bvh = NewBVHNode(mesh.triangles, 0, 0)
+
+	return mesh
+}
+
+// NewTriangle returns a single Triangle with its own mesh.
+func NewTriangle(p0, p1, p2 Vec3, material Material) Triangle {
+	mesh := NewTriangleMesh([]Vec3{p0, p1, p2}, nil, nil, []int{0, 1, 2}, material)
+
+	return mesh.triangles[0].(Triangle)
+}
+
+func (m *TriangleMesh) hit(r Ray, tMin, tMax float64, record *Hit, sampler Sampler) bool {
+	return m.bvh.hit(r, tMin, tMax, record, sampler)
+}
+
+func (m *TriangleMesh) boundingBox(t0, t1 float64) (bool, *AABB) {
+	return m.bvh.boundingBox(t0, t1)
+}
+
+// pdfValue is the probability of sampling direction from o by picking a point uniformly on
+// the surface of the mesh, which adds up over every triangle along direction.
+func (m *TriangleMesh) pdfValue(o, direction Vec3) float64 {
+	var buffer [16]Hitable
+
+	pdf := 0.0
+
+	for _, triangle := range m.bvh.crossing(Ray{o, direction, 0}, 0.001, math.MaxFloat64, buffer[:0]) {
+		pdf += triangle.(Triangle).facePdf(o, direction, m.area)
+	}
+
+	return pdf
+}
+
+func (m *TriangleMesh) random(o Vec3, sampler Sampler) Vec3 {
+	target := sampler.Float64() * m.area
+	index := sort.SearchFloat64s(m.areas, target)
+
+	if index >= len(m.triangles) {
+		index = len(m.triangles) - 1
+	}
+
+	return m.triangles[index].random(o, sampler)
+}
+
+func (tri Triangle) vertex(i int) Vec3 {
+	return tri.mesh.positions[tri.mesh.indices[tri.index+i]]
+}
+
+func (tri Triangle) area() float64 {
+	p0 := tri.vertex(0)
+
+	return 0.5 * tri.vertex(1).subtract(p0).cross(tri.vertex(2).subtract(p0)).length()
+}
+
+// hit uses the Möller-Trumbore algorithm, which also gives the barycentric coordinates
+// used to interpolate normals and texture coordinates.
+func (tri Triangle) hit(r Ray, tMin, tMax float64, record *Hit, sampler Sampler) bool {
+	p0 := tri.vertex(0)
+	edge1 := tri.vertex(1).subtract(p0)
+	edge2 := tri.vertex(2).subtract(p0)
+
+	pVec := r.direction().cross(edge2)
+	determinant := edge1.dot(pVec)
+
+	if math.Abs(determinant) < 1e-12 {
+		return false
+	}
+
+	inverseDeterminant := 1 / determinant
+	tVec := r.origin().subtract(p0)
+
+	b1 := tVec.dot(pVec) * inverseDeterminant
+
+	if b1 < 0 || b1 > 1 {
+		return false
+	}
+
+	qVec := tVec.cross(edge1)
+	b2 := r.direction().dot(qVec) * inverseDeterminant
+
+	if b2 < 0 || b1+b2 > 1 {
+		return false
+	}
+
+	t := edge2.dot(qVec) * inverseDeterminant
+
+	if t < tMin || t > tMax {
+		return false
+	}
+
+	b0 := 1 - b1 - b2
+
+	u, v := b1, b2
+	normal := edge1.cross(edge2).unitVector()
+
+	if tri.mesh.uvs != nil {
+		uv := tri.interpolate(tri.mesh.uvs, b0, b1, b2)
+		u, v = uv.x(), uv.y()
+	}
+
+	if tri.mesh.normals != nil {
+		normal = tri.interpolate(tri.mesh.normals, b0, b1, b2).unitVector()
+	}
+
+	*record = Hit{
+		t:        t,
+		p:        r.pointAtParameter(t),
+		u:        u,
+		v:        v,
+		normal:   normal,
+		material: tri.mesh.material,
+	}
+
+	return true
+}
+
+// interpolate blends per-vertex values with barycentric coordinates.
+func (tri Triangle) interpolate(values []Vec3, b0, b1, b2 float64) Vec3 {
+	indices := tri.mesh.indices
+
+	return values[indices[tri.index]].multiplyScalar(b0).
+		add(values[indices[tri.index+1]].multiplyScalar(b1)).
+		add(values[indices[tri.index+2]].multiplyScalar(b2))
+}
+
+func (tri Triangle) boundingBox(t0, t1 float64) (bool, *AABB) {
+	p0 := tri.vertex(0)
+	p1 := tri.vertex(1)
+	p2 := tri.vertex(2)
+
+	// Pad the box so axis-aligned Triangles do not have a flat one.
+	padding := Vec3{0.0001, 0.0001, 0.0001}
+
+	box := AABB{
+		Vec3{
+			math.Min(p0.x(), math.Min(p1.x(), p2.x())),
+			math.Min(p0.y(), math.Min(p1.y(), p2.y())),
+			math.Min(p0.z(), math.Min(p1.z(), p2.z())),
+		}.subtract(padding),
+		Vec3{
+			math.Max(p0.x(), math.Max(p1.x(), p2.x())),
+			math.Max(p0.y(), math.Max(p1.y(), p2.y())),
+			math.Max(p0.z(), math.Max(p1.z(), p2.z())),
+		}.add(padding),
+	}
+
+	return true, &box
+}
+
+func (tri Triangle) pdfValue(o, direction Vec3) float64 {
+	return tri.facePdf(o, direction, tri.area())
+}
+
+// facePdf is the probability of sampling direction from o through the Triangle by picking
+// a point uniformly on a surface of the given area that includes it. The density turns
+// with the geometric normal of the face, not the interpolated one it is shaded with.
+func (tri Triangle) facePdf(o, direction Vec3, area float64) float64 {
+	var hit Hit
+
+	if !tri.hit(Ray{o, direction, 0}, 0.001, math.MaxFloat64, &hit, nil) {
+		return 0
+	}
+
+	p0 := tri.vertex(0)
+	hit.normal = tri.vertex(1).subtract(p0).cross(tri.vertex(2).subtract(p0)).unitVector()
+
+	return solidAnglePdf(hit, direction, area)
+}
+
+// random picks a uniformly distributed point on the Triangle.
+func (tri Triangle) random(o Vec3, sampler Sampler) Vec3 {
+	u, v := Float64Pair(sampler)
+	su := math.Sqrt(u)
+	b1 := 1 - su
+	b2 := v * su
+
+	p0 := tri.vertex(0)
+	point := p0.add(tri.vertex(1).subtract(p0).multiplyScalar(b1)).add(tri.vertex(2).subtract(p0).multiplyScalar(b2))
+
+	return point.subtract(o)
+}
+
+// solidAnglePdf converts the uniform area density of a surface with the given area
+// into a density over directions, for the surface seen at hit along direction.
+func solidAnglePdf(hit Hit, direction Vec3, area float64) float64 {
+	distanceSquared := hit.t * hit.t * direction.squaredLength()
+	cosine := math.Abs(direction.dot(hit.normal) / direction.length())
+
+	if cosine == 0 {
+		return 0
+	}
+
+	return distanceSquared / (cosine * area)
+}
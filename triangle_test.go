@@ -0,0 +1,105 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTriangleHit(t *testing.T) {
+	triangle := NewTriangle(Vec3{0, 0, 0}, Vec3{1, 0, 0}, Vec3{0, 1, 0}, MaterialZero{})
+
+	var hit Hit
+
+	didHit := triangle.hit(Ray{Vec3{0.25, 0.5, 1}, Vec3{0, 0, -1}, 0}, 0.001, math.MaxFloat64, &hit, nil)
+
+	if !didHit {
+		t.Fatalf("Expected a hit")
+	}
+
+	if hit.t != 1 || hit.u != 0.25 || hit.v != 0.5 {
+		t.Errorf("Unexpected hit t=%v u=%v v=%v", hit.t, hit.u, hit.v)
+	}
+
+	if hit.normal != (Vec3{0, 0, 1}) {
+		t.Errorf("Unexpected normal %v", hit.normal)
+	}
+
+	if triangle.hit(Ray{Vec3{0.75, 0.5, 1}, Vec3{0, 0, -1}, 0}, 0.001, math.MaxFloat64, &hit, nil) {
+		t.Errorf("Expected a miss outside the hypotenuse")
+	}
+}
+
+func TestTriangleMeshInterpolation(t *testing.T) {
+	positions := []Vec3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 1, 0}}
+	normals := []Vec3{{0, 0, 1}, {0, 0, 1}, {1, 0, 0}, {1, 0, 0}}
+	uvs := []Vec3{{0, 0, 0}, {2, 0, 0}, {2, 2, 0}, {0, 2, 0}}
+
+	mesh := NewTriangleMesh(positions, normals, uvs, []int{0, 1, 2, 0, 2, 3}, MaterialZero{})
+
+	var hit Hit
+
+	didHit := mesh.hit(Ray{Vec3{0.5, 0.5, 1}, Vec3{0, 0, -1}, 0}, 0.001, math.MaxFloat64, &hit, nil)
+
+	if !didHit {
+		t.Fatalf("Expected a hit")
+	}
+
+	if math.Abs(hit.u-1) > 1e-9 || math.Abs(hit.v-1) > 1e-9 {
+		t.Errorf("Expected interpolated uv (1, 1), got (%v, %v)", hit.u, hit.v)
+	}
+
+	if math.Abs(hit.normal.length()-1) > 1e-9 || hit.normal.x() <= 0 || hit.normal.z() <= 0 {
+		t.Errorf("Expected a blended unit normal, got %v", hit.normal)
+	}
+}
+
+func TestTriangleMeshLightSampling(t *testing.T) {
+	positions := []Vec3{{-1, 2, -1}, {1, 2, -1}, {1, 2, 1}, {-1, 2, 1}}
+	mesh := NewTriangleMesh(positions, nil, nil, []int{0, 1, 2, 0, 2, 3}, MaterialZero{})
+	rng := NewRand(1)
+
+	o := Vec3Zero()
+	rectangle := XZRectangle{-1, 1, -1, 1, 2, MaterialZero{}}
+
+	for i := 0; i < 100; i++ {
+		direction := mesh.random(o, rng)
+
+		if math.Abs(direction.y()-2) > 1e-9 {
+			t.Fatalf("Sampled point off the mesh: %v", direction)
+		}
+
+		expected := rectangle.pdfValue(o, direction)
+		actual := mesh.pdfValue(o, direction)
+
+		if math.Abs(actual-expected) > 1e-9*expected {
+			t.Fatalf("Mesh pdf %v differs from the equivalent rectangle %v", actual, expected)
+		}
+	}
+}
+
+func TestTriangleMeshPdfIntegratesToOne(t *testing.T) {
+	// Two stacked squares, so that some directions cross both, shaded with normals
+	// leaning well away from the faces.
+	positions := []Vec3{
+		{-1, 2, -1}, {1, 2, -1}, {1, 2, 1}, {-1, 2, 1},
+		{-1, 3, -1}, {1, 3, -1}, {1, 3, 1}, {-1, 3, 1},
+	}
+	normals := []Vec3{
+		{1, 1, 0}, {0, 1, 1}, {-1, 1, 0}, {0, 1, -1},
+		{1, 1, 0}, {0, 1, 1}, {-1, 1, 0}, {0, 1, -1},
+	}
+	mesh := NewTriangleMesh(positions, normals, nil, []int{0, 1, 2, 0, 2, 3, 4, 5, 6, 4, 6, 7}, MaterialZero{})
+	rng := NewRand(1)
+
+	const n = 200000
+
+	sum := 0.0
+
+	for i := 0; i < n; i++ {
+		sum += mesh.pdfValue(Vec3Zero(), RandomOnUnitSphere(rng)) * 4 * math.Pi
+	}
+
+	if integral := sum / n; math.Abs(integral-1) > 0.03 {
+		t.Errorf("Mesh pdf integrates to %v over the sphere, expected 1", integral)
+	}
+}
@@ -245,12 +245,25 @@ func (v Vec3) sqrt() Vec3 {
 	}
 }
 
-// RGBA converts to color supported by Go Image library.
+// RGBA converts to color supported by Go Image library, clamping each channel to [0, 1].
 func (v Vec3) RGBA() (r, g, b, a uint32) {
-	r = uint32(v.e0 * 0xffff)
-	g = uint32(v.e1 * 0xffff)
-	b = uint32(v.e2 * 0xffff)
+	r = colorChannel(v.e0)
+	g = colorChannel(v.e1)
+	b = colorChannel(v.e2)
 	a = 0xffff
 
 	return
 }
+
+// colorChannel converts a channel to 16 bits. NaNs become black.
+func colorChannel(value float64) uint32 {
+	if !(value > 0) {
+		return 0
+	}
+
+	if value >= 1 {
+		return 0xffff
+	}
+
+	return uint32(value * 0xffff)
+}
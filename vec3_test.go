@@ -1,6 +1,9 @@
 package main
 
-import "testing"
+import (
+	"math"
+	"testing"
+)
 
 func TestGet(t *testing.T) {
 	expected := []float64{2.0, 4.0, 6.0}
@@ -18,3 +21,11 @@ func TestGet(t *testing.T) {
 		}
 	}
 }
+
+func TestRGBAClamps(t *testing.T) {
+	r, g, b, a := Vec3{15, -1, math.NaN()}.RGBA()
+
+	if r != 0xffff || g != 0 || b != 0 || a != 0xffff {
+		t.Errorf("Expected clamped channels, got %v %v %v %v", r, g, b, a)
+	}
+}